@@ -0,0 +1,167 @@
+// Command mcapi-local serves every /v1 route of the minecraft API from a single
+// local process, so the website can be developed against a laptop without
+// Docker or an AWS account.
+//
+// By default the handlers run against the in-memory fakes from mcapitest, with
+// a simulated EC2 instance that boots and shuts down on its own. Pass -aws to
+// run them against real AWS using the same environment variables as the
+// deployed lambdas.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"mcapi"
+	"mcapi/handlers/addtowhitelist"
+	"mcapi/handlers/admincommand"
+	"mcapi/handlers/backupserver"
+	"mcapi/handlers/confirmlink"
+	"mcapi/handlers/createbackup"
+	"mcapi/handlers/createlinkcode"
+	"mcapi/handlers/getbackups"
+	"mcapi/handlers/getkey"
+	"mcapi/handlers/getlink"
+	"mcapi/handlers/getlogins"
+	"mcapi/handlers/getrestore"
+	"mcapi/handlers/getserverstatus"
+	"mcapi/handlers/getservertimer"
+	"mcapi/handlers/getwhitelist"
+	"mcapi/handlers/logoutusers"
+	"mcapi/handlers/markserverstarted"
+	"mcapi/handlers/removefromwhitelist"
+	"mcapi/handlers/restorebackup"
+	"mcapi/handlers/startserver"
+	"mcapi/handlers/stopserver"
+	"mcapi/handlers/updatetimer"
+	"mcapi/handlers/upsertlogin"
+	"mcapi/mcapitest"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// withoutContext adapts handlers that do not take a context
+func withoutContext(handle func(events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error)) HandlerFunc {
+	return func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		return handle(request)
+	}
+}
+
+// routes mounts every handler on the resource paths from template.yaml
+func routes(cfg *mcapi.Config, clients *mcapi.Clients, store mcapi.StateStore) []Route {
+	stop := &stopserver.Handler{Config: cfg, Clients: clients, State: store}
+	restore := &restorebackup.Handler{Config: cfg, Clients: clients, State: store}
+	return []Route{
+		{"GET", "/status", withoutContext((&getserverstatus.Handler{Config: cfg, Clients: clients, State: store}).Handle)},
+		{"POST", "/start", withoutContext((&startserver.Handler{Config: cfg, Clients: clients, State: store}).Handle)},
+		{"POST", "/stop", func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+			// an API Gateway request unmarshals into an Event without a source
+			return stop.Handle(stopserver.Event{APIGatewayProxyRequest: request})
+		}},
+		{"POST", "/markStarted", withoutContext((&markserverstarted.Handler{Config: cfg, Clients: clients, State: store}).Handle)},
+		{"GET", "/getKey", withoutContext((&getkey.Handler{Config: cfg}).Handle)},
+		{"GET", "/timer", withoutContext((&getservertimer.Handler{Config: cfg, Clients: clients, State: store}).Handle)},
+		{"POST", "/updateTimer", withoutContext((&updatetimer.Handler{Config: cfg, Clients: clients, State: store}).Handle)},
+		{"POST", "/upsertLogin", (&upsertlogin.Handler{Config: cfg, Clients: clients}).Handle},
+		{"POST", "/getLogins", (&getlogins.Handler{Config: cfg, Clients: clients}).Handle},
+		{"POST", "/logoutUsers", (&logoutusers.Handler{Config: cfg, Clients: clients}).Handle},
+		{"GET", "/backups", withoutContext((&getbackups.Handler{Config: cfg, Clients: clients}).Handle)},
+		{"POST", "/backups", withoutContext((&createbackup.Handler{Config: cfg, Clients: clients, State: store}).Handle)},
+		{"POST", "/admin/{action}", withoutContext((&admincommand.Handler{Config: cfg, Clients: clients, State: store}).Handle)},
+		{"POST", "/backups/{id}/restore", func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+			return restore.Handle(ctx, restorebackup.Event{APIGatewayProxyRequest: request})
+		}},
+		{"GET", "/restores/{id}", withoutContext((&getrestore.Handler{Config: cfg, State: store}).Handle)},
+		{"GET", "/whitelist", withoutContext((&getwhitelist.Handler{Config: cfg, Clients: clients}).Handle)},
+		{"POST", "/whitelist", withoutContext((&addtowhitelist.Handler{Config: cfg, Clients: clients, State: store}).Handle)},
+		{"DELETE", "/whitelist/{username}", withoutContext((&removefromwhitelist.Handler{Config: cfg, Clients: clients, State: store}).Handle)},
+		{"GET", "/link", withoutContext((&getlink.Handler{Config: cfg, Clients: clients}).Handle)},
+		{"POST", "/link", withoutContext((&createlinkcode.Handler{Config: cfg, Clients: clients}).Handle)},
+		{"POST", "/link/confirm", withoutContext((&confirmlink.Handler{Config: cfg, Clients: clients}).Handle)},
+	}
+}
+
+// localConfig returns the environment config with anything unset filled in
+// from the test config, so the fakes work with an empty environment. State is
+// kept in memory unless the environment picks another backend.
+func localConfig(origin string) *mcapi.Config {
+	cfg := mcapi.LoadConfig()
+	defaults := mcapitest.Config()
+	fill := func(v *string, d string) {
+		if *v == "" {
+			*v = d
+		}
+	}
+	fill(&cfg.ServerID, defaults.ServerID)
+	fill(&cfg.TimerKeyName, defaults.TimerKeyName)
+	fill(&cfg.ServerStatusKeyName, defaults.ServerStatusKeyName)
+	fill(&cfg.LifecycleKeyName, defaults.LifecycleKeyName)
+	fill(&cfg.SessionKeyName, defaults.SessionKeyName)
+	fill(&cfg.RestoreKeyName, defaults.RestoreKeyName)
+	fill(&cfg.CloudwatchRuleName, defaults.CloudwatchRuleName)
+	fill(&cfg.StopServerArn, defaults.StopServerArn)
+	fill(&cfg.UserLoginTableName, defaults.UserLoginTableName)
+	fill(&cfg.APIKey, defaults.APIKey)
+	fill(&cfg.StateBackend, "memory")
+	cfg.CloudfrontOrigin = origin
+	return cfg
+}
+
+func main() {
+	addr := flag.String("addr", "localhost:8080", "address to listen on")
+	stage := flag.String("stage", "v1", "API stage name routes are served under")
+	origin := flag.String("origin", "*", "CORS origin returned by every route")
+	useAWS := flag.Bool("aws", false, "call real AWS instead of the in-memory fakes")
+	stateFile := flag.String("state-file", "", "keep server state in this JSON file instead of the configured backend")
+	bootDelay := flag.Duration("boot-delay", 10*time.Second, "how long the simulated instance takes to boot or shut down")
+	flag.Parse()
+
+	var cfg *mcapi.Config
+	var clients *mcapi.Clients
+	var fakes *mcapitest.Clients
+	if *useAWS {
+		cfg = mcapi.LoadConfig()
+		cfg.CloudfrontOrigin = *origin
+		clients = mcapi.NewClients(cfg)
+	} else {
+		cfg = localConfig(*origin)
+		fakes = mcapitest.NewClients()
+		fakes.EC2.SetState(cfg.ServerID, "stopped")
+		fakes.EC2.SetVolume(cfg.ServerID, "/dev/xvda", "vol-0123456789abcdef0")
+		fakes.EC2.SetAddress(cfg.ServerID, "127.0.0.1", "localhost")
+		clients = fakes.Clients()
+	}
+	if *stateFile != "" {
+		cfg.StateBackend = "file"
+		cfg.StateFile = *stateFile
+	}
+	store, err := mcapi.NewStateStore(cfg, clients)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if fakes != nil {
+		sim := &Simulator{
+			Config:      cfg,
+			Fakes:       fakes,
+			State:       store,
+			Stop:        &stopserver.Handler{Config: cfg, Clients: clients, State: store},
+			Restore:     &restorebackup.Handler{Config: cfg, Clients: clients, State: store},
+			MarkStarted: &markserverstarted.Handler{Config: cfg, Clients: clients, State: store},
+			Backup:      &backupserver.Handler{Config: cfg, Clients: clients, State: store},
+			BootDelay:   *bootDelay,
+		}
+		go sim.Run(context.Background())
+	}
+
+	router := &Router{Stage: *stage, Origin: *origin, Routes: routes(cfg, clients, store)}
+	fmt.Printf("serving /%s on http://%s (aws: %t)\n", *stage, *addr, *useAWS)
+	if err := http.ListenAndServe(*addr, router); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"mcapi"
+	"mcapi/handlers/backupserver"
+	"mcapi/handlers/markserverstarted"
+	"mcapi/handlers/restorebackup"
+	"mcapi/handlers/stopserver"
+	"mcapi/mcapitest"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// newServer starts a local server on fakes with a stopped instance. The caller
+// closes it.
+func newServer() (*httptest.Server, *Simulator) {
+	cfg := localConfig("*")
+	fakes := mcapitest.NewClients()
+	fakes.EC2.SetState(cfg.ServerID, "stopped")
+	fakes.EC2.SetVolume(cfg.ServerID, "/dev/xvda", "vol-0123456789abcdef0")
+	fakes.EC2.SetAddress(cfg.ServerID, "127.0.0.1", "localhost")
+	clients := fakes.Clients()
+	store := mcapi.NewMemoryStateStore()
+	sim := &Simulator{
+		Config:      cfg,
+		Fakes:       fakes,
+		State:       store,
+		Stop:        &stopserver.Handler{Config: cfg, Clients: clients, State: store},
+		Restore:     &restorebackup.Handler{Config: cfg, Clients: clients, State: store},
+		MarkStarted: &markserverstarted.Handler{Config: cfg, Clients: clients, State: store},
+		Backup:      &backupserver.Handler{Config: cfg, Clients: clients, State: store},
+		BootDelay:   time.Second,
+	}
+	srv := httptest.NewServer(&Router{Stage: "v1", Origin: "*", Routes: routes(cfg, clients, store)})
+	return srv, sim
+}
+
+func do(t *testing.T, srv *httptest.Server, method, path, body string) (int, string, http.Header) {
+	t.Helper()
+	return doAs(t, srv, nil, method, path, body)
+}
+
+// doAs sends the request with an unsigned token carrying claims, like a
+// signed in website user
+func doAs(t *testing.T, srv *httptest.Server, claims map[string]string, method, path, body string) (int, string, http.Header) {
+	t.Helper()
+	req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims != nil {
+		payload, err := json.Marshal(claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer e30."+base64.RawURLEncoding.EncodeToString(payload)+".sig")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, string(b), resp.Header
+}
+
+func TestRouter(t *testing.T) {
+	srv, _ := newServer()
+	defer srv.Close()
+	tests := []struct {
+		method     string
+		path       string
+		body       string
+		statusCode int
+		want       string
+	}{
+		{"GET", "/v1/status", "", 200, "stopped"},
+		{"GET", "/v1/status?format=envelope", "", 200, `"data":{"instanceState":"stopped",`},
+		{"GET", "/v1/timer?format=envelope", "", 200, `"data":{"active":false,`},
+		{"GET", "/v1/getKey", "", 200, "test-api-key"},
+		{"POST", "/v1/getLogins", "", 200, "null"},
+		{"POST", "/v1/upsertLogin", `{"Username": "steve", "Version": "v1", "LoginTime": 1}`, 200, "Attributes"},
+		{"POST", "/v1/getLogins", `{"Usernames": ["steve"]}`, 200, `"Username":"steve"`},
+		{"POST", "/v1/logoutUsers", "", 200, `[{"Username":"steve","Version":"v1","LoginTime":1,"LogoutTime":`},
+		{"POST", "/v1/logoutUsers", "", 200, "[]"},
+		{"GET", "/v1/backups", "", 200, "[]"},
+		{"POST", "/v1/backups", "", 200, `"trigger":"request"`},
+		{"POST", "/v1/backups/snap-nope/restore", "", 404, "snap-nope"},
+		{"GET", "/v1/backups/snap-nope/restore", "", 405, "Method Not Allowed"},
+		{"GET", "/v1/restores/nope", "", 404, "Could not find restore nope"},
+		{"GET", "/v1/timer", "", 200, "No active session"},
+		{"POST", "/v1/admin/list", "", 409, "Server is stopped, not started"},
+		{"POST", "/v1/admin/op", `{"player": "Steve"}`, 404, "Unknown action"},
+		{"GET", "/v1/whitelist", "", 200, "[]"},
+		{"POST", "/v1/whitelist", `{"username": "Steve"}`, 200, `"synced":false`},
+		{"GET", "/v1/whitelist", "", 200, `[{"username":"Steve",`},
+		{"DELETE", "/v1/whitelist/steve", "", 200, `"username":"Steve"`},
+		{"DELETE", "/v1/whitelist/steve", "", 404, "steve is not whitelisted"},
+		{"GET", "/v1/start", "", 405, "Method Not Allowed"},
+		{"GET", "/v1/nope", "", 404, "Missing Authentication Token"},
+		{"GET", "/status", "", 404, ""},
+		{"OPTIONS", "/v1/start", "", 200, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			statusCode, body, headers := do(t, srv, tt.method, tt.path, tt.body)
+			if statusCode != tt.statusCode {
+				t.Errorf("status = %d, want %d (body %q)", statusCode, tt.statusCode, body)
+			}
+			if !strings.Contains(body, tt.want) {
+				t.Errorf("body = %q, want it to contain %q", body, tt.want)
+			}
+			if tt.statusCode != 404 || strings.HasPrefix(tt.path, "/v1") {
+				if got := headers.Get("Access-Control-Allow-Origin"); got != "*" {
+					t.Errorf("Access-Control-Allow-Origin = %q, want *", got)
+				}
+			}
+		})
+	}
+}
+
+func TestLinking(t *testing.T) {
+	srv, _ := newServer()
+	defer srv.Close()
+	alice := map[string]string{"sub": "sub-alice", "cognito:username": "alice"}
+
+	if statusCode, body, _ := doAs(t, srv, alice, "GET", "/v1/link", ""); statusCode != 404 {
+		t.Fatalf("link before linking = %d %q, want 404", statusCode, body)
+	}
+	if statusCode, body, _ := do(t, srv, "POST", "/v1/link", ""); statusCode != 403 {
+		t.Fatalf("code without a user = %d %q, want 403", statusCode, body)
+	}
+	statusCode, body, _ := doAs(t, srv, alice, "POST", "/v1/link", "")
+	if statusCode != 200 {
+		t.Fatalf("code = %d %q, want 200", statusCode, body)
+	}
+	var code mcapi.LinkCode
+	if err := json.Unmarshal([]byte(body), &code); err != nil {
+		t.Fatalf("body %q: %v", body, err)
+	}
+
+	confirm := `{"code": "` + code.Code + `", "uuid": "069a79f4-44e9-4726-a5be-fca90e38aaf5", "username": "Steve"}`
+	if statusCode, body, _ := do(t, srv, "POST", "/v1/link/confirm", confirm); statusCode != 200 {
+		t.Fatalf("confirm = %d %q, want 200", statusCode, body)
+	}
+	if statusCode, body, _ := do(t, srv, "POST", "/v1/link/confirm", confirm); statusCode != 404 {
+		t.Errorf("confirming again = %d %q, want 404", statusCode, body)
+	}
+	if statusCode, body, _ := doAs(t, srv, alice, "GET", "/v1/link", ""); statusCode != 200 || !strings.Contains(body, `"username":"Steve"`) {
+		t.Errorf("link = %d %q, want Steve", statusCode, body)
+	}
+}
+
+func TestTokenClaims(t *testing.T) {
+	tests := []struct {
+		authorization string
+		want          string
+	}{
+		{"Bearer e30.eyJzdWIiOiJzdWItYWxpY2UifQ.sig", "sub-alice"},
+		{"e30.eyJzdWIiOiJzdWItYWxpY2UifQ.sig", "sub-alice"},
+		{"", ""},
+		{"Bearer not-a-token", ""},
+		{"Bearer e30.!!!.sig", ""},
+	}
+	for _, tt := range tests {
+		claims := tokenClaims(tt.authorization)
+		got, _ := claims["sub"].(string)
+		if got != tt.want || (claims == nil) != (tt.want == "") {
+			t.Errorf("tokenClaims(%q) = %v, want sub %q", tt.authorization, claims, tt.want)
+		}
+	}
+}
+
+func TestServerLifecycle(t *testing.T) {
+	srv, sim := newServer()
+	defer srv.Close()
+	now := time.Now()
+	sim.Step(now)
+
+	if statusCode, body, _ := do(t, srv, "POST", "/v1/start", ""); statusCode != 200 || body != "success" {
+		t.Fatalf("start = %d %q", statusCode, body)
+	}
+	sim.Step(now)
+	if _, body, _ := do(t, srv, "GET", "/v1/status", ""); body != "pending" {
+		t.Errorf("status while booting = %q, want pending", body)
+	}
+	sim.Step(now.Add(time.Second))
+	if _, body, _ := do(t, srv, "GET", "/v1/status", ""); body != "running" {
+		t.Errorf("status once booted = %q, want running", body)
+	}
+	_, body, _ := do(t, srv, "GET", "/v1/status?format=envelope", "")
+	if !strings.Contains(body, `"serviceStatus":"started","publicIp":"127.0.0.1"`) || !strings.Contains(body, `"ping":{"version":"1.20.1"`) {
+		t.Errorf("status details once booted = %q, want the service started and answering at 127.0.0.1", body)
+	}
+	if statusCode, body, _ := do(t, srv, "POST", "/v1/admin/say", `{"message": "hello"}`); statusCode != 200 {
+		t.Errorf("say once booted = %d %q, want 200", statusCode, body)
+	}
+	// the whitelist is synced once the server has started
+	if got := fmt.Sprint(sim.Fakes.RCON.Commands()); got != "[whitelist list say hello]" {
+		t.Errorf("RCON commands = %s, want [whitelist list say hello]", got)
+	}
+	if statusCode, body, _ := do(t, srv, "POST", "/v1/start", ""); statusCode != 200 || body != "Server is already started" {
+		t.Errorf("second start = %d %q, want a no-op", statusCode, body)
+	}
+
+	// the scheduled stop fires at the stop time, which the handler checks
+	// against the real clock, so expire the timer before stepping past it
+	at, ok := sim.Fakes.Scheduler.At()
+	if !ok {
+		t.Fatal("stop not scheduled")
+	}
+	sim.State.Put(sim.Config.TimerKeyName, strconv.FormatInt(now.Unix()-1, 10))
+	sim.Step(at)
+	if _, body, _ := do(t, srv, "GET", "/v1/status", ""); body != "stopping" {
+		t.Errorf("status after scheduled stop = %q, want stopping", body)
+	}
+	if statusCode, _, _ := do(t, srv, "POST", "/v1/start", ""); statusCode != 409 {
+		t.Errorf("start while instance is stopping = %d, want 409", statusCode)
+	}
+	sim.Step(at.Add(time.Second))
+	if _, body, _ := do(t, srv, "GET", "/v1/status", ""); body != "stopped" {
+		t.Errorf("status once shut down = %q, want stopped", body)
+	}
+	if _, body, _ := do(t, srv, "GET", "/v1/backups", ""); !strings.Contains(body, `"stopReason":"scheduled"`) {
+		t.Errorf("backups once shut down = %q, want a backup of the session", body)
+	}
+}
+
+func TestRequestedStop(t *testing.T) {
+	srv, sim := newServer()
+	defer srv.Close()
+	now := time.Now()
+	do(t, srv, "POST", "/v1/start", "")
+	sim.Step(now)
+	sim.Step(now.Add(time.Second))
+
+	// the stop is handed over and runs on the next step, like an
+	// asynchronous invocation would shortly after
+	if statusCode, body, _ := do(t, srv, "POST", "/v1/stop", ""); statusCode != 202 || body != "success" {
+		t.Fatalf("stop = %d %q, want 202", statusCode, body)
+	}
+	if _, body, _ := do(t, srv, "GET", "/v1/status", ""); body != "running" {
+		t.Errorf("status once stop is accepted = %q, want running", body)
+	}
+	sim.Step(now.Add(2 * time.Second))
+	if _, body, _ := do(t, srv, "GET", "/v1/status", ""); body != "stopping" {
+		t.Errorf("status once stop has run = %q, want stopping", body)
+	}
+	if got, _ := sim.State.Get(sim.Config.LifecycleKeyName); got != "stopped" {
+		t.Errorf("lifecycle once stop has run = %q, want stopped", got)
+	}
+}
+
+func TestRestore(t *testing.T) {
+	srv, sim := newServer()
+	defer srv.Close()
+	sim.Fakes.EC2.SetVolume(sim.Config.ServerID, "/dev/xvda", "vol-world")
+	sim.Fakes.EC2.AddSnapshot(&ec2.Snapshot{
+		SnapshotId: aws.String("snap-1"),
+		StartTime:  aws.Time(time.Now().Add(-time.Hour)),
+		State:      aws.String(ec2.SnapshotStateCompleted),
+		Tags:       []*ec2.Tag{{Key: aws.String(mcapi.BackupTagKey), Value: aws.String(sim.Config.ServerID)}},
+	})
+
+	statusCode, body, _ := do(t, srv, "POST", "/v1/backups/snap-1/restore?format=envelope", "")
+	if statusCode != 202 {
+		t.Fatalf("restore = %d %q, want 202", statusCode, body)
+	}
+	var accepted struct {
+		Data mcapi.Restore `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(body), &accepted); err != nil {
+		t.Fatalf("body %q: %v", body, err)
+	}
+	poll := "/v1/restores/" + accepted.Data.ID
+	if _, body, _ := do(t, srv, "GET", poll, ""); !strings.Contains(body, `"status":"restoring"`) {
+		t.Errorf("restore before the swap ran = %q, want restoring", body)
+	}
+	if statusCode, _, _ := do(t, srv, "POST", "/v1/start", ""); statusCode != 409 {
+		t.Errorf("start while restoring = %d, want 409", statusCode)
+	}
+
+	// the swap is handed over and runs on the next step
+	sim.Step(time.Now())
+	if _, body, _ := do(t, srv, "GET", poll, ""); !strings.Contains(body, `"status":"restored"`) || !strings.Contains(body, `"previousVolumeId":"vol-world"`) {
+		t.Errorf("restore once the swap ran = %q, want restored", body)
+	}
+	if got, _ := sim.State.Get(sim.Config.LifecycleKeyName); got != "stopped" {
+		t.Errorf("lifecycle once restored = %q, want stopped", got)
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"mcapi"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// HandlerFunc is the common shape every lambda handler is adapted to
+type HandlerFunc func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error)
+
+// Route mounts a handler on an API Gateway style resource path. Path segments
+// written as {name} match any value and are passed as path parameters.
+type Route struct {
+	Method   string
+	Resource string
+	Handle   HandlerFunc
+}
+
+// Router translates HTTP requests into API Gateway proxy requests and
+// dispatches them to the matching route, the way API Gateway does for the
+// deployed stack
+type Router struct {
+	Stage  string
+	Origin string
+	Routes []Route
+}
+
+// match returns the route for the method and path (without stage) along with
+// its path parameters. allowed reports whether any route matched the path at
+// all, regardless of method.
+func (rt *Router) match(method, path string) (route *Route, params map[string]string, allowed bool) {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for i := range rt.Routes {
+		r := &rt.Routes[i]
+		p, ok := matchResource(r.Resource, segments)
+		if !ok {
+			continue
+		}
+		allowed = true
+		if r.Method == method {
+			return r, p, true
+		}
+	}
+	return nil, nil, allowed
+}
+
+// matchResource matches the path segments against a resource path
+func matchResource(resource string, segments []string) (map[string]string, bool) {
+	parts := strings.Split(strings.Trim(resource, "/"), "/")
+	if len(parts) != len(segments) {
+		return nil, false
+	}
+	params := map[string]string{}
+	for i, part := range parts {
+		if strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}") {
+			params[part[1:len(part)-1]] = segments[i]
+			continue
+		}
+		if part != segments[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+// ServeHTTP implements http.Handler
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	prefix := "/" + rt.Stage
+	if !strings.HasPrefix(r.URL.Path, prefix+"/") {
+		http.NotFound(w, r)
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, prefix)
+
+	route, params, allowed := rt.match(r.Method, path)
+	switch {
+	case !allowed:
+		writeJSONMessage(w, rt.Origin, http.StatusNotFound, "Missing Authentication Token")
+		return
+	case r.Method == http.MethodOptions:
+		// CORS preflight, answered by API Gateway itself when deployed
+		writeResponse(w, mcapi.NewResponse(rt.Origin, http.StatusOK, ""))
+		return
+	case route == nil:
+		writeJSONMessage(w, rt.Origin, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+
+	request, err := proxyRequest(r, route.Resource, rt.Stage, params)
+	if err != nil {
+		writeJSONMessage(w, rt.Origin, http.StatusBadRequest, err.Error())
+		return
+	}
+	start := time.Now()
+	resp, err := route.Handle(r.Context(), request)
+	fmt.Println("[Router]", r.Method, r.URL.Path, resp.StatusCode, time.Since(start))
+	if err != nil {
+		// a lambda error surfaces as a bare 502 from API Gateway
+		fmt.Println("[Router]", err)
+		writeJSONMessage(w, rt.Origin, http.StatusBadGateway, "Internal server error")
+		return
+	}
+	writeResponse(w, resp)
+}
+
+// proxyRequest builds the proxy request API Gateway would send for r
+func proxyRequest(r *http.Request, resource, stage string, params map[string]string) (events.APIGatewayProxyRequest, error) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return events.APIGatewayProxyRequest{}, err
+	}
+	path := strings.TrimPrefix(r.URL.Path, "/"+stage)
+
+	request := events.APIGatewayProxyRequest{
+		Resource:          resource,
+		Path:              path,
+		HTTPMethod:        r.Method,
+		Headers:           lastValues(r.Header),
+		MultiValueHeaders: r.Header,
+		PathParameters:    params,
+		Body:              string(body),
+		RequestContext: events.APIGatewayProxyRequestContext{
+			Stage:        stage,
+			RequestID:    requestID(),
+			ResourcePath: resource,
+			HTTPMethod:   r.Method,
+			Identity: events.APIGatewayRequestIdentity{
+				SourceIP:  r.RemoteAddr,
+				UserAgent: r.UserAgent(),
+				APIKey:    r.Header.Get("x-api-key"),
+			},
+		},
+	}
+	if claims := tokenClaims(r.Header.Get("Authorization")); claims != nil {
+		request.RequestContext.Authorizer = map[string]interface{}{"claims": claims}
+	}
+	if query := r.URL.Query(); len(query) > 0 {
+		request.QueryStringParameters = lastValues(query)
+		request.MultiValueQueryStringParameters = query
+	}
+	return request, nil
+}
+
+// lastValues flattens multi value maps the way API Gateway does, keeping the
+// last value of each key
+func lastValues(values map[string][]string) map[string]string {
+	flat := map[string]string{}
+	for k, v := range values {
+		if len(v) > 0 {
+			flat[k] = v[len(v)-1]
+		}
+	}
+	return flat
+}
+
+// tokenClaims returns the claims of the JWT in an Authorization header, the
+// way the Cognito authorizer passes them on, or nil if there is none. The token
+// is not verified, so any user can be played locally.
+func tokenClaims(authorization string) map[string]interface{} {
+	parts := strings.Split(strings.TrimPrefix(authorization, "Bearer "), ".")
+	if len(parts) != 3 {
+		return nil
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return nil
+	}
+	var claims map[string]interface{}
+	if json.Unmarshal(payload, &claims) != nil {
+		return nil
+	}
+	return claims
+}
+
+// requestID returns a random ID for the request context
+func requestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// writeResponse writes a proxy response to w
+func writeResponse(w http.ResponseWriter, resp events.APIGatewayProxyResponse) {
+	for k, v := range resp.Headers {
+		w.Header().Set(k, v)
+	}
+	for k, values := range resp.MultiValueHeaders {
+		for _, v := range values {
+			w.Header().Add(k, v)
+		}
+	}
+	body := []byte(resp.Body)
+	if resp.IsBase64Encoded {
+		decoded, err := base64.StdEncoding.DecodeString(resp.Body)
+		if err == nil {
+			body = decoded
+		}
+	}
+	statusCode := resp.StatusCode
+	if statusCode == 0 {
+		statusCode = http.StatusOK
+	}
+	w.WriteHeader(statusCode)
+	w.Write(body)
+}
+
+// writeJSONMessage writes an API Gateway style {"message": ...} error
+func writeJSONMessage(w http.ResponseWriter, origin string, statusCode int, msg string) {
+	b, _ := json.Marshal(map[string]string{"message": msg})
+	resp := mcapi.NewResponse(origin, statusCode, string(b))
+	resp.Headers["Content-Type"] = "application/json"
+	writeResponse(w, resp)
+}
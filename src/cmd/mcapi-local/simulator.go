@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"mcapi"
+	"mcapi/handlers/backupserver"
+	"mcapi/handlers/markserverstarted"
+	"mcapi/handlers/restorebackup"
+	"mcapi/handlers/stopserver"
+	"mcapi/mcapitest"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// Simulator plays the parts of the deployed stack that are not handlers: EC2
+// moving the instance between states, the EC2 host calling /markStarted and
+// answering pings once booted, the scheduled stop invoking stopServer and the
+// instance stopping invoking backupServer, and lambda running the invocations
+// handlers hand their long running work to.
+type Simulator struct {
+	Config      *mcapi.Config
+	Fakes       *mcapitest.Clients
+	State       mcapi.StateStore
+	Stop        *stopserver.Handler
+	Restore     *restorebackup.Handler
+	MarkStarted *markserverstarted.Handler
+	Backup      *backupserver.Handler
+	BootDelay   time.Duration
+
+	state string
+	since time.Time
+	fired time.Time
+}
+
+// Run steps the simulation every second until ctx is done
+func (s *Simulator) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.Step(now)
+		}
+	}
+}
+
+// invoke runs an invocation a handler queued, picking the handler by the
+// source of its event
+func (s *Simulator) invoke(invocation mcapitest.Invocation) {
+	var source struct {
+		Source string `json:"source"`
+	}
+	if err := json.Unmarshal(invocation.Payload, &source); err != nil {
+		fmt.Println("[Simulator]", "invalid invocation:", err)
+		return
+	}
+	switch source.Source {
+	case stopserver.StopSource:
+		var event stopserver.Event
+		json.Unmarshal(invocation.Payload, &event)
+		resp, err := s.Stop.Handle(event)
+		fmt.Println("[Simulator]", "requested stop:", resp.StatusCode, resp.Body, err)
+	case restorebackup.RestoreSource:
+		var event restorebackup.Event
+		json.Unmarshal(invocation.Payload, &event)
+		resp, err := s.Restore.Handle(context.Background(), event)
+		fmt.Println("[Simulator]", "restore:", resp.StatusCode, resp.Body, err)
+	default:
+		fmt.Println("[Simulator]", "no handler for invocation from", source.Source)
+	}
+}
+
+// Step advances the simulation to now
+func (s *Simulator) Step(now time.Time) {
+	for _, invocation := range s.Fakes.Invoker.Take() {
+		s.invoke(invocation)
+	}
+
+	// fire the scheduled stop first so it shows up as a state change. Like the
+	// real schedule, it only fires once for a given time.
+	if at, ok := s.Fakes.Scheduler.At(); ok && !now.Before(at) && !at.Equal(s.fired) {
+		s.fired = at
+		resp, err := s.Stop.Handle(stopserver.Event{Source: "aws.events"})
+		fmt.Println("[Simulator]", "scheduled stop:", resp.StatusCode, resp.Body, err)
+	}
+
+	state := s.Fakes.EC2.State(s.Config.ServerID)
+	if state != s.state {
+		s.state = state
+		s.since = now
+	}
+	if now.Sub(s.since) >= s.BootDelay {
+		switch state {
+		case ec2.InstanceStateNamePending:
+			fmt.Println("[Simulator]", "instance booted, marking service as started")
+			s.Fakes.EC2.SetState(s.Config.ServerID, ec2.InstanceStateNameRunning)
+			s.Fakes.Pinger.SetResult(&mcapi.PingResult{Version: "1.20.1", Protocol: 763, MOTD: "A Minecraft Server", PlayersMax: 20})
+			resp, err := s.MarkStarted.Handle(events.APIGatewayProxyRequest{})
+			fmt.Println("[Simulator]", "mark started:", resp.StatusCode, resp.Body, err)
+		case ec2.InstanceStateNameStopping:
+			fmt.Println("[Simulator]", "instance stopped")
+			s.Fakes.Pinger.SetResult(nil)
+			s.Fakes.EC2.SetState(s.Config.ServerID, ec2.InstanceStateNameStopped)
+			detail, _ := json.Marshal(backupserver.Detail{InstanceID: s.Config.ServerID, State: ec2.InstanceStateNameStopped})
+			backup, err := s.Backup.Handle(events.CloudWatchEvent{Source: "aws.ec2", Detail: detail})
+			fmt.Println("[Simulator]", "backup:", backup.SnapshotID, err)
+		}
+	}
+}
@@ -0,0 +1,15 @@
+package main
+
+import (
+	"mcapi"
+	"mcapi/handlers/createbackup"
+
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+func main() {
+	cfg := mcapi.LoadConfig()
+	clients := mcapi.NewClients(cfg)
+	h := &createbackup.Handler{Config: cfg, Clients: clients, State: mcapi.MustStateStore(cfg, clients)}
+	lambda.Start(h.Handle)
+}
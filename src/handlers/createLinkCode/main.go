@@ -0,0 +1,14 @@
+package main
+
+import (
+	"mcapi"
+	"mcapi/handlers/createlinkcode"
+
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+func main() {
+	cfg := mcapi.LoadConfig()
+	h := &createlinkcode.Handler{Config: cfg, Clients: mcapi.NewClients(cfg)}
+	lambda.Start(h.Handle)
+}
@@ -0,0 +1,14 @@
+package main
+
+import (
+	"mcapi"
+	"mcapi/handlers/getlink"
+
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+func main() {
+	cfg := mcapi.LoadConfig()
+	h := &getlink.Handler{Config: cfg, Clients: mcapi.NewClients(cfg)}
+	lambda.Start(h.Handle)
+}
@@ -0,0 +1,15 @@
+package main
+
+import (
+	"mcapi"
+	"mcapi/handlers/getrestore"
+
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+func main() {
+	cfg := mcapi.LoadConfig()
+	clients := mcapi.NewClients(cfg)
+	h := &getrestore.Handler{Config: cfg, State: mcapi.MustStateStore(cfg, clients)}
+	lambda.Start(h.Handle)
+}
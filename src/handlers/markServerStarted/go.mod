@@ -1,8 +1,11 @@
 require (
 	github.com/aws/aws-lambda-go v1.13.3
 	github.com/aws/aws-sdk-go v1.32.11
+	mcapi v0.0.0
 )
 
 module markServerStarted
 
 go 1.13
+
+replace mcapi => ../../internal/mcapi
@@ -0,0 +1,427 @@
+package mcapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+)
+
+// Tags on backup snapshots. BackupTagKey holds the server instance ID and is
+// what backups are found by; the others describe the session backed up.
+const (
+	BackupTagKey       = "minecraft:server"
+	backupSessionStart = "minecraft:sessionStart"
+	backupSessionStop  = "minecraft:sessionStop"
+	backupStopReason   = "minecraft:stopReason"
+	backupExtensions   = "minecraft:extensions"
+	backupTrigger      = "minecraft:trigger"
+	restoredFrom       = "minecraft:restoredFrom"
+)
+
+// What a backup was taken for
+const (
+	// BackupOnStop backups are taken once the server has stopped
+	BackupOnStop = "stop"
+	// BackupOnRequest backups are taken on demand through the API
+	BackupOnRequest = "request"
+)
+
+// Backup is a snapshot of the server's world volume
+type Backup struct {
+	SnapshotID string `json:"snapshotId"`
+	VolumeID   string `json:"volumeId"`
+	// StartTime is the unix timestamp the snapshot was taken at
+	StartTime int64  `json:"startTime"`
+	State     string `json:"state"`
+	Progress  string `json:"progress"`
+	SizeGiB   int64  `json:"sizeGiB"`
+	// Trigger is what the backup was taken for: stop or request. It is empty
+	// for backups taken before it was tagged.
+	Trigger string `json:"trigger,omitempty"`
+	// Session is the session the backup was taken after. It is empty for
+	// sessions started before they were tracked.
+	Session Session `json:"session"`
+}
+
+// tagValue returns the value of the tag with key, or ""
+func tagValue(tags []*ec2.Tag, key string) string {
+	for _, t := range tags {
+		if aws.StringValue(t.Key) == key {
+			return aws.StringValue(t.Value)
+		}
+	}
+	return ""
+}
+
+// newBackup creates and returns new Backup describing snapshot
+func newBackup(snapshot *ec2.Snapshot) Backup {
+	b := Backup{
+		SnapshotID: aws.StringValue(snapshot.SnapshotId),
+		VolumeID:   aws.StringValue(snapshot.VolumeId),
+		StartTime:  aws.TimeValue(snapshot.StartTime).Unix(),
+		State:      aws.StringValue(snapshot.State),
+		Progress:   aws.StringValue(snapshot.Progress),
+		SizeGiB:    aws.Int64Value(snapshot.VolumeSize),
+		Trigger:    tagValue(snapshot.Tags, backupTrigger),
+	}
+	b.Session.StartTime, _ = strconv.ParseInt(tagValue(snapshot.Tags, backupSessionStart), 10, 64)
+	b.Session.StopTime, _ = strconv.ParseInt(tagValue(snapshot.Tags, backupSessionStop), 10, 64)
+	b.Session.StopReason = tagValue(snapshot.Tags, backupStopReason)
+	b.Session.Extensions, _ = strconv.Atoi(tagValue(snapshot.Tags, backupExtensions))
+	return b
+}
+
+// worldAttachment is where the world volume is attached to the server
+type worldAttachment struct {
+	InstanceState    string
+	AvailabilityZone string
+	Device           string
+	VolumeID         string
+}
+
+// describeWorld returns the attachment of the EBS volume attached to the
+// server as cfg.WorldDevice, or as its root device if that is unset
+func describeWorld(cfg *Config, svc ec2iface.EC2API) (worldAttachment, error) {
+	result, err := svc.DescribeInstances(&ec2.DescribeInstancesInput{
+		InstanceIds: []*string{aws.String(cfg.ServerID)},
+	})
+	if err != nil {
+		return worldAttachment{}, err
+	}
+	for _, r := range result.Reservations {
+		for _, i := range r.Instances {
+			world := worldAttachment{Device: cfg.WorldDevice}
+			if world.Device == "" {
+				world.Device = aws.StringValue(i.RootDeviceName)
+			}
+			if i.State != nil {
+				world.InstanceState = aws.StringValue(i.State.Name)
+			}
+			if i.Placement != nil {
+				world.AvailabilityZone = aws.StringValue(i.Placement.AvailabilityZone)
+			}
+			for _, m := range i.BlockDeviceMappings {
+				if aws.StringValue(m.DeviceName) == world.Device && m.Ebs != nil {
+					world.VolumeID = aws.StringValue(m.Ebs.VolumeId)
+					return world, nil
+				}
+			}
+			return world, NewError(CodeNotFound, "Could not find volume %s of instance %s", world.Device, cfg.ServerID)
+		}
+	}
+	return worldAttachment{}, NewError(CodeNotFound, "Could not find instance with ID %s", cfg.ServerID)
+}
+
+// WorldVolume returns the ID of the EBS volume attached to the server as
+// cfg.WorldDevice, or as its root device if that is unset
+func WorldVolume(cfg *Config, svc ec2iface.EC2API) (string, error) {
+	world, err := describeWorld(cfg, svc)
+	if err != nil {
+		return "", err
+	}
+	return world.VolumeID, nil
+}
+
+// CreateBackup snapshots the server's world volume, tagging the snapshot with
+// what it was taken for (BackupOnStop or BackupOnRequest) and the session it
+// follows
+func CreateBackup(cfg *Config, svc ec2iface.EC2API, session Session, trigger string) (Backup, error) {
+	volumeID, err := WorldVolume(cfg, svc)
+	if err != nil {
+		return Backup{}, err
+	}
+	fmt.Println("[CreateBackup]", "snapshotting volume", volumeID)
+	tags := []*ec2.Tag{
+		{Key: aws.String("Name"), Value: aws.String("minecraft world")},
+		{Key: aws.String(BackupTagKey), Value: aws.String(cfg.ServerID)},
+		{Key: aws.String(backupSessionStart), Value: aws.String(strconv.FormatInt(session.StartTime, 10))},
+		{Key: aws.String(backupSessionStop), Value: aws.String(strconv.FormatInt(session.StopTime, 10))},
+		{Key: aws.String(backupExtensions), Value: aws.String(strconv.Itoa(session.Extensions))},
+		{Key: aws.String(backupTrigger), Value: aws.String(trigger)},
+	}
+	if session.StopReason != "" {
+		tags = append(tags, &ec2.Tag{Key: aws.String(backupStopReason), Value: aws.String(session.StopReason)})
+	}
+	snapshot, err := svc.CreateSnapshot(&ec2.CreateSnapshotInput{
+		VolumeId:    aws.String(volumeID),
+		Description: aws.String(fmt.Sprintf("Minecraft world of %s after the session started at %d", cfg.ServerID, session.StartTime)),
+		TagSpecifications: []*ec2.TagSpecification{{
+			ResourceType: aws.String(ec2.ResourceTypeSnapshot),
+			Tags:         tags,
+		}},
+	})
+	if err != nil {
+		return Backup{}, err
+	}
+	return newBackup(snapshot), nil
+}
+
+// ListBackups returns the server's backups, newest first
+func ListBackups(cfg *Config, svc ec2iface.EC2API) ([]Backup, error) {
+	input := &ec2.DescribeSnapshotsInput{
+		OwnerIds: []*string{aws.String("self")},
+		Filters: []*ec2.Filter{{
+			Name:   aws.String("tag:" + BackupTagKey),
+			Values: []*string{aws.String(cfg.ServerID)},
+		}},
+	}
+	backups := []Backup{}
+	err := svc.DescribeSnapshotsPages(input, func(page *ec2.DescribeSnapshotsOutput, last bool) bool {
+		for _, s := range page.Snapshots {
+			backups = append(backups, newBackup(s))
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(backups, func(a, b int) bool {
+		return backups[a].StartTime > backups[b].StartTime
+	})
+	return backups, nil
+}
+
+// GetBackup returns the server's backup with the snapshot ID, or a NOT_FOUND
+// error if there is no such backup of the server
+func GetBackup(cfg *Config, svc ec2iface.EC2API, snapshotID string) (Backup, error) {
+	result, err := svc.DescribeSnapshots(&ec2.DescribeSnapshotsInput{
+		OwnerIds:    []*string{aws.String("self")},
+		SnapshotIds: []*string{aws.String(snapshotID)},
+		Filters: []*ec2.Filter{{
+			Name:   aws.String("tag:" + BackupTagKey),
+			Values: []*string{aws.String(cfg.ServerID)},
+		}},
+	})
+	if err != nil {
+		return Backup{}, err
+	}
+	if len(result.Snapshots) < 1 {
+		return Backup{}, NewError(CodeNotFound, "Could not find backup %s of %s", snapshotID, cfg.ServerID)
+	}
+	return newBackup(result.Snapshots[0]), nil
+}
+
+// Restore statuses. A restore is restoring until the swap is done or has
+// failed.
+const (
+	RestoreRestoring = "restoring"
+	RestoreRestored  = "restored"
+	RestoreFailed    = "failed"
+)
+
+// RestoreTimeout is how long a restore may take from the request, the longest
+// Lambda runs the asynchronous invocation swapping the volume. A restore still
+// restoring after that was cut short without ending.
+const RestoreTimeout = 15 * time.Minute
+
+// Restore describes a backup restored onto the server
+type Restore struct {
+	// ID identifies the restore to poll its status with
+	ID         string `json:"id"`
+	Status     string `json:"status"`
+	SnapshotID string `json:"snapshotId"`
+	Device     string `json:"device"`
+	// VolumeID is the volume created from the backup, now attached to the
+	// server
+	VolumeID string `json:"volumeId"`
+	// PreviousVolumeID is the volume it replaced. It is left detached, to be
+	// deleted by hand once the restored world checks out.
+	PreviousVolumeID string `json:"previousVolumeId"`
+	// Error is why the restore failed, if it did
+	Error string `json:"error,omitempty"`
+	// StartedAt is the unix timestamp the restore was requested at
+	StartedAt int64 `json:"startedAt"`
+}
+
+// GetRestore returns the latest restore, or a NOT_FOUND error if it is not the
+// restore with the ID
+func GetRestore(cfg *Config, store StateStore, id string) (Restore, error) {
+	var restore Restore
+	value, err := store.Get(cfg.RestoreKeyName)
+	if errors.Is(err, ErrStateNotFound) {
+		return restore, NewError(CodeNotFound, "Could not find restore %s", id)
+	}
+	if err != nil {
+		return restore, err
+	}
+	err = json.Unmarshal([]byte(value), &restore)
+	if err != nil {
+		return restore, fmt.Errorf("invalid restore %q: %w", value, err)
+	}
+	if restore.ID != id {
+		return Restore{}, NewError(CodeNotFound, "Could not find restore %s", id)
+	}
+	return restore, nil
+}
+
+// endStaleRestore moves a server left restoring to stopped if its restore is
+// over: the restore ended without the server being moved back, was never
+// recorded, or was cut short by the invocation timing out, in which case it is
+// recorded as failed. It returns the lifecycle state the server is then in.
+func endStaleRestore(cfg *Config, store StateStore, now time.Time) (Lifecycle, error) {
+	var restore Restore
+	value, err := store.Get(cfg.RestoreKeyName)
+	if err != nil && !errors.Is(err, ErrStateNotFound) {
+		return "", err
+	}
+	if err == nil && json.Unmarshal([]byte(value), &restore) == nil &&
+		restore.Status == RestoreRestoring && now.Before(time.Unix(restore.StartedAt, 0).Add(RestoreTimeout)) {
+		return LifecycleRestoring, nil
+	}
+	if restore.Status == RestoreRestoring {
+		restore.Status = RestoreFailed
+		restore.Error = fmt.Sprintf("Restore timed out after %s", RestoreTimeout)
+		err = PutRestore(cfg, store, restore)
+		if err != nil {
+			return "", err
+		}
+	}
+	fmt.Println("[endStaleRestore]", "restore", restore.ID, "is", restore.Status, "but server is still restoring")
+	err = swapLifecycle(cfg, store, LifecycleRestoring, LifecycleStopped)
+	if err != nil {
+		return "", err
+	}
+	return LifecycleStopped, nil
+}
+
+// PutRestore stores the restore as JSON, replacing the previous one
+func PutRestore(cfg *Config, store StateStore, restore Restore) error {
+	b, err := json.Marshal(restore)
+	if err != nil {
+		return err
+	}
+	return store.Put(cfg.RestoreKeyName, string(b))
+}
+
+// RestoreBackup creates a volume from the backup and swaps it in for the
+// server's world volume. The instance must be stopped, and the backup
+// completed; the swap is refused with a CONFLICT error otherwise. Waiting for
+// the volumes gives up once ctx is done. If the swap fails once the new volume
+// is created, the new volume is deleted, and if it cannot be attached the
+// previous one is attached again.
+func RestoreBackup(ctx aws.Context, cfg *Config, svc ec2iface.EC2API, backup Backup) (Restore, error) {
+	if backup.State != ec2.SnapshotStateCompleted {
+		return Restore{}, NewError(CodeConflict, "Backup %s is %s, not completed", backup.SnapshotID, backup.State)
+	}
+	world, err := describeWorld(cfg, svc)
+	if err != nil {
+		return Restore{}, err
+	}
+	if world.InstanceState != ec2.InstanceStateNameStopped {
+		return Restore{}, NewError(CodeConflict, "Backups cannot be restored while the instance is %s", world.InstanceState)
+	}
+	restore := Restore{SnapshotID: backup.SnapshotID, Device: world.Device, PreviousVolumeID: world.VolumeID}
+
+	// keep the volume type of the world being replaced
+	volumes, err := svc.DescribeVolumes(&ec2.DescribeVolumesInput{VolumeIds: []*string{aws.String(world.VolumeID)}})
+	if err != nil {
+		return restore, err
+	}
+	input := &ec2.CreateVolumeInput{
+		SnapshotId:       aws.String(backup.SnapshotID),
+		AvailabilityZone: aws.String(world.AvailabilityZone),
+		TagSpecifications: []*ec2.TagSpecification{{
+			ResourceType: aws.String(ec2.ResourceTypeVolume),
+			Tags: []*ec2.Tag{
+				{Key: aws.String("Name"), Value: aws.String("minecraft world")},
+				{Key: aws.String(restoredFrom), Value: aws.String(backup.SnapshotID)},
+			},
+		}},
+	}
+	if len(volumes.Volumes) > 0 {
+		input.VolumeType = volumes.Volumes[0].VolumeType
+	}
+	fmt.Println("[RestoreBackup]", "creating volume from", backup.SnapshotID, "in", world.AvailabilityZone)
+	volume, err := svc.CreateVolume(input)
+	if err != nil {
+		return restore, err
+	}
+	restore.VolumeID = aws.StringValue(volume.VolumeId)
+	err = swapWorld(ctx, cfg, svc, world, restore.VolumeID)
+	if err != nil {
+		fmt.Println("[RestoreBackup]", "deleting", restore.VolumeID)
+		_, derr := svc.DeleteVolume(&ec2.DeleteVolumeInput{VolumeId: volume.VolumeId})
+		if derr != nil {
+			fmt.Println("WARNING: could not delete", restore.VolumeID, ":", derr)
+		} else {
+			restore.VolumeID = ""
+		}
+		return restore, err
+	}
+	return restore, nil
+}
+
+// swapWorld detaches the world volume and attaches volumeID in its place, once
+// it is available
+func swapWorld(ctx aws.Context, cfg *Config, svc ec2iface.EC2API, world worldAttachment, volumeID string) error {
+	err := svc.WaitUntilVolumeAvailableWithContext(ctx, &ec2.DescribeVolumesInput{VolumeIds: []*string{aws.String(volumeID)}})
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("[RestoreBackup]", "detaching", world.VolumeID, "from", world.Device)
+	_, err = svc.DetachVolume(&ec2.DetachVolumeInput{
+		InstanceId: aws.String(cfg.ServerID),
+		VolumeId:   aws.String(world.VolumeID),
+	})
+	if err != nil {
+		return err
+	}
+	err = svc.WaitUntilVolumeAvailableWithContext(ctx, &ec2.DescribeVolumesInput{VolumeIds: []*string{aws.String(world.VolumeID)}})
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("[RestoreBackup]", "attaching", volumeID, "as", world.Device)
+	_, err = svc.AttachVolume(&ec2.AttachVolumeInput{
+		InstanceId: aws.String(cfg.ServerID),
+		VolumeId:   aws.String(volumeID),
+		Device:     aws.String(world.Device),
+	})
+	if err != nil {
+		// put the previous world back rather than leave the server without one
+		_, rerr := svc.AttachVolume(&ec2.AttachVolumeInput{
+			InstanceId: aws.String(cfg.ServerID),
+			VolumeId:   aws.String(world.VolumeID),
+			Device:     aws.String(world.Device),
+		})
+		if rerr != nil {
+			fmt.Println("WARNING: could not reattach", world.VolumeID, ":", rerr)
+		}
+		return err
+	}
+	return nil
+}
+
+// PruneBackups deletes the backups beyond the cfg.BackupRetention newest, and
+// those older than cfg.BackupMaxAge if set, returning the backups deleted.
+// Backups taken on request count the same as the others. The newest backup is
+// always kept.
+func PruneBackups(cfg *Config, svc ec2iface.EC2API, now time.Time) ([]Backup, error) {
+	backups, err := ListBackups(cfg, svc)
+	if err != nil {
+		return nil, err
+	}
+	deleted := []Backup{}
+	for n, b := range backups {
+		tooMany := cfg.BackupRetention > 0 && n >= cfg.BackupRetention
+		tooOld := cfg.BackupMaxAge > 0 && now.Sub(time.Unix(b.StartTime, 0)) > cfg.BackupMaxAge
+		if n == 0 || !(tooMany || tooOld) {
+			continue
+		}
+		fmt.Println("[PruneBackups]", "deleting", b.SnapshotID, "taken at", b.StartTime)
+		_, err = svc.DeleteSnapshot(&ec2.DeleteSnapshotInput{SnapshotId: aws.String(b.SnapshotID)})
+		if err != nil {
+			return deleted, err
+		}
+		deleted = append(deleted, b)
+	}
+	return deleted, nil
+}
@@ -0,0 +1,223 @@
+package mcapi_test
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"mcapi"
+	"mcapi/mcapitest"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+)
+
+// snapshot returns a backup snapshot of the server taken age ago
+func snapshot(id string, age time.Duration) *ec2.Snapshot {
+	return &ec2.Snapshot{
+		SnapshotId: aws.String(id),
+		VolumeId:   aws.String("vol-world"),
+		StartTime:  aws.Time(time.Now().Add(-age)),
+		State:      aws.String(ec2.SnapshotStateCompleted),
+		Tags:       []*ec2.Tag{{Key: aws.String(mcapi.BackupTagKey), Value: aws.String(mcapitest.InstanceID)}},
+	}
+}
+
+func TestWorldVolume(t *testing.T) {
+	svc := mcapitest.NewFakeEC2()
+	svc.SetState(mcapitest.InstanceID, "stopped")
+	svc.SetVolume(mcapitest.InstanceID, "/dev/xvda", "vol-root")
+	svc.SetVolume(mcapitest.InstanceID, "/dev/sdf", "vol-world")
+
+	cfg := mcapitest.Config()
+	for device, want := range map[string]string{"": "vol-root", "/dev/sdf": "vol-world", "/dev/sdz": ""} {
+		cfg.WorldDevice = device
+		got, err := mcapi.WorldVolume(cfg, svc)
+		if got != want || (want == "") != (err != nil) {
+			t.Errorf("WorldVolume for %q = %q, %v, want %q", device, got, err, want)
+		}
+	}
+
+	cfg.ServerID = "i-unknown"
+	if _, err := mcapi.WorldVolume(cfg, svc); mcapi.Classify(err).Code != mcapi.CodeNotFound {
+		t.Errorf("WorldVolume of unknown instance = %v, want NOT_FOUND", err)
+	}
+}
+
+func TestCreateBackup(t *testing.T) {
+	cfg := mcapitest.Config()
+	svc := mcapitest.NewFakeEC2()
+	svc.SetState(cfg.ServerID, "stopped")
+	svc.SetVolume(cfg.ServerID, "/dev/xvda", "vol-root")
+	svc.AddSnapshot(&ec2.Snapshot{SnapshotId: aws.String("snap-other"), StartTime: aws.Time(time.Now())})
+
+	session := mcapi.Session{StartTime: 1000, Extensions: 2, StopTime: 5000, StopReason: "scheduled"}
+	backup, err := mcapi.CreateBackup(cfg, svc, session, mcapi.BackupOnRequest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if backup.VolumeID != "vol-root" || !reflect.DeepEqual(backup.Session, session) || backup.Trigger != mcapi.BackupOnRequest {
+		t.Errorf("backup = %+v, want of vol-root on request after %+v", backup, session)
+	}
+
+	backups, err := mcapi.ListBackups(cfg, svc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 1 || backups[0].SnapshotID != backup.SnapshotID || !reflect.DeepEqual(backups[0].Session, session) {
+		t.Errorf("ListBackups = %+v, want only %+v", backups, backup)
+	}
+
+	got, err := mcapi.GetBackup(cfg, svc, backup.SnapshotID)
+	if err != nil || got.SnapshotID != backup.SnapshotID {
+		t.Errorf("GetBackup = %+v, %v, want %+v", got, err, backup)
+	}
+	if _, err := mcapi.GetBackup(cfg, svc, "snap-other"); mcapi.Classify(err).Code != mcapi.CodeNotFound {
+		t.Errorf("GetBackup of another volume's snapshot = %v, want NOT_FOUND", err)
+	}
+}
+
+// refusingEC2 refuses to attach any volume but the one in the way, as if the
+// restored volume were broken
+type refusingEC2 struct {
+	*mcapitest.FakeEC2
+	allow string
+}
+
+func (r *refusingEC2) AttachVolume(input *ec2.AttachVolumeInput) (*ec2.VolumeAttachment, error) {
+	if aws.StringValue(input.VolumeId) != r.allow {
+		return nil, awserr.New("UnauthorizedOperation", "denied", nil)
+	}
+	return r.FakeEC2.AttachVolume(input)
+}
+
+func TestRestoreBackup(t *testing.T) {
+	tests := []struct {
+		name    string
+		state   string
+		pending bool
+		fail    string
+		refuse  bool
+		expired bool
+		code    mcapi.ErrorCode
+	}{
+		{name: "swaps the world", state: "stopped"},
+		{name: "instance running", state: "running", code: mcapi.CodeConflict},
+		{name: "backup pending", state: "stopped", pending: true, code: mcapi.CodeConflict},
+		{name: "volume not created", state: "stopped", fail: "CreateVolume", code: mcapi.CodeForbidden},
+		{name: "attach fails", state: "stopped", refuse: true, code: mcapi.CodeForbidden},
+		{name: "out of time", state: "stopped", expired: true, code: mcapi.CodeAWS},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := mcapitest.Config()
+			svc := mcapitest.NewFakeEC2()
+			svc.SetState(cfg.ServerID, tt.state)
+			svc.SetVolume(cfg.ServerID, "/dev/xvda", "vol-world")
+			svc.AddSnapshot(snapshot("snap-1", time.Hour))
+			if tt.fail != "" {
+				svc.Fail(tt.fail, awserr.New("UnauthorizedOperation", "denied", nil))
+			}
+			backup, err := mcapi.GetBackup(cfg, svc, "snap-1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.pending {
+				backup.State = ec2.SnapshotStatePending
+			}
+
+			var api ec2iface.EC2API = svc
+			if tt.refuse {
+				api = &refusingEC2{FakeEC2: svc, allow: "vol-world"}
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.expired {
+				cancel()
+			}
+
+			restore, err := mcapi.RestoreBackup(ctx, cfg, api, backup)
+			world := svc.Volume(cfg.ServerID, "/dev/xvda")
+			if tt.code != "" {
+				if err == nil || mcapi.Classify(err).Code != tt.code {
+					t.Fatalf("RestoreBackup error = %v, want %s", err, tt.code)
+				}
+				if world != "vol-world" {
+					t.Errorf("world volume = %q after failing, want vol-world", world)
+				}
+				if restore.VolumeID != "" || svc.Detached("vol-00000000000000001") != nil {
+					t.Errorf("restore = %+v after failing, want the new volume deleted", restore)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if world != restore.VolumeID || restore.PreviousVolumeID != "vol-world" || restore.Device != "/dev/xvda" {
+				t.Errorf("restore = %+v with %s attached, want vol-world swapped out", restore, world)
+			}
+			v := svc.Detached("vol-world")
+			if v == nil || aws.StringValue(v.State) != ec2.VolumeStateAvailable {
+				t.Errorf("previous volume = %+v, want kept detached", v)
+			}
+		})
+	}
+}
+
+func TestPruneBackups(t *testing.T) {
+	day := 24 * time.Hour
+	tests := []struct {
+		name     string
+		keep     int
+		maxAge   time.Duration
+		snapshot []*ec2.Snapshot
+		want     []string
+	}{
+		{
+			name:     "keeps the newest",
+			keep:     2,
+			snapshot: []*ec2.Snapshot{snapshot("snap-3", 3*day), snapshot("snap-1", day), snapshot("snap-2", 2*day)},
+			want:     []string{"snap-1", "snap-2"},
+		},
+		{
+			name:     "drops old backups",
+			keep:     5,
+			maxAge:   7 * day,
+			snapshot: []*ec2.Snapshot{snapshot("snap-1", day), snapshot("snap-2", 10*day)},
+			want:     []string{"snap-1"},
+		},
+		{
+			name:     "always keeps the latest",
+			keep:     5,
+			maxAge:   7 * day,
+			snapshot: []*ec2.Snapshot{snapshot("snap-1", 20*day), snapshot("snap-2", 30*day)},
+			want:     []string{"snap-1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := mcapitest.Config()
+			cfg.BackupRetention, cfg.BackupMaxAge = tt.keep, tt.maxAge
+			svc := mcapitest.NewFakeEC2()
+			for _, s := range tt.snapshot {
+				svc.AddSnapshot(s)
+			}
+			if _, err := mcapi.PruneBackups(cfg, svc, time.Now()); err != nil {
+				t.Fatal(err)
+			}
+			backups, _ := mcapi.ListBackups(cfg, svc)
+			var got []string
+			for _, b := range backups {
+				got = append(got, b.SnapshotID)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("kept %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
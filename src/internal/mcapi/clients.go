@@ -0,0 +1,66 @@
+package mcapi
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudwatchevents"
+	"github.com/aws/aws-sdk-go/service/cloudwatchevents/cloudwatcheventsiface"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
+)
+
+// Clients holds the AWS service clients used by the handlers, along with the
+// services built on them. Handlers only depend on the interfaces, so tests can
+// swap in the in-memory fakes from mcapitest.
+type Clients struct {
+	EC2       ec2iface.EC2API
+	SSM       ssmiface.SSMAPI
+	Events    cloudwatcheventsiface.CloudWatchEventsAPI
+	DynamoDB  dynamodbiface.DynamoDBAPI
+	Scheduler Scheduler
+	Commands  CommandRunner
+	Pinger    Pinger
+	RCON      RCON
+	Resolver  Resolver
+	Invoker   Invoker
+}
+
+// NewSession creates and returns new AWS session. The configured region is
+// used when set, otherwise the SDK falls back to the lambda's AWS_REGION.
+func NewSession(cfg *Config) *session.Session {
+	config := &aws.Config{}
+	if cfg.Region != "" {
+		config.Region = aws.String(cfg.Region)
+	}
+	sess := session.Must(session.NewSession(config))
+	fmt.Println("[NewSession]", "Created session")
+	return sess
+}
+
+// NewClients creates and returns new Clients sharing a single AWS session.
+// Service clients are cheap to create and make no calls until used.
+func NewClients(cfg *Config) *Clients {
+	sess := NewSession(cfg)
+	events := cloudwatchevents.New(sess)
+	ssmClient := ssm.New(sess)
+	dynamoClient := dynamodb.New(sess)
+	return &Clients{
+		EC2:       ec2.New(sess),
+		SSM:       ssmClient,
+		Events:    events,
+		DynamoDB:  dynamoClient,
+		Scheduler: NewEventsScheduler(cfg, events),
+		Commands:  NewSSMCommandRunner(cfg, ssmClient),
+		Pinger:    NewServerListPinger(cfg),
+		RCON:      NewRCONClient(cfg, ssmClient),
+		Resolver:  NewResolver(cfg, dynamoClient),
+		Invoker:   NewLambdaInvoker(lambda.New(sess)),
+	}
+}
@@ -0,0 +1,83 @@
+package mcapi
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
+)
+
+// CommandRunner runs commands on the server instance
+type CommandRunner interface {
+	// Run runs commands through the command document and waits up to timeout
+	// for them to finish. Documents that take no commands are given none.
+	Run(document string, commands []string, timeout time.Duration) error
+}
+
+// DefaultPollInterval is how often SSMCommandRunner checks on a command
+const DefaultPollInterval = 2 * time.Second
+
+// SSMCommandRunner runs commands on the server instance with SSM Run Command
+type SSMCommandRunner struct {
+	SSM          ssmiface.SSMAPI
+	InstanceID   string
+	PollInterval time.Duration
+}
+
+// NewSSMCommandRunner creates and returns new SSMCommandRunner for the
+// configured server instance
+func NewSSMCommandRunner(cfg *Config, svc ssmiface.SSMAPI) *SSMCommandRunner {
+	return &SSMCommandRunner{SSM: svc, InstanceID: cfg.ServerID, PollInterval: DefaultPollInterval}
+}
+
+// Run implements CommandRunner. A command still running at the timeout is
+// cancelled.
+func (r *SSMCommandRunner) Run(document string, commands []string, timeout time.Duration) error {
+	input := &ssm.SendCommandInput{
+		DocumentName: aws.String(document),
+		InstanceIds:  []*string{aws.String(r.InstanceID)},
+	}
+	if len(commands) > 0 {
+		input.Parameters = map[string][]*string{"commands": aws.StringSlice(commands)}
+	}
+	fmt.Println("[SSMCommandRunner]", "sending", document, commands)
+	sent, err := r.SSM.SendCommand(input)
+	if err != nil {
+		return err
+	}
+	commandID := sent.Command.CommandId
+
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		time.Sleep(r.PollInterval)
+		invocation, err := r.SSM.GetCommandInvocation(&ssm.GetCommandInvocationInput{
+			CommandId:  commandID,
+			InstanceId: aws.String(r.InstanceID),
+		})
+		if AWSErrorCode(err) == ssm.ErrCodeInvocationDoesNotExist {
+			// the invocation shows up shortly after the command is sent
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		status := aws.StringValue(invocation.Status)
+		switch status {
+		case ssm.CommandInvocationStatusPending, ssm.CommandInvocationStatusInProgress, ssm.CommandInvocationStatusDelayed:
+			continue
+		case ssm.CommandInvocationStatusSuccess:
+			fmt.Println("[SSMCommandRunner]", "command", aws.StringValue(commandID), "succeeded")
+			return nil
+		}
+		return fmt.Errorf("command %s %s: %s", aws.StringValue(commandID), status, aws.StringValue(invocation.StandardErrorContent))
+	}
+
+	fmt.Println("[SSMCommandRunner]", "command", aws.StringValue(commandID), "timed out, cancelling")
+	_, err = r.SSM.CancelCommand(&ssm.CancelCommandInput{CommandId: commandID})
+	if err != nil {
+		fmt.Println("[SSMCommandRunner]", "could not cancel command:", err)
+	}
+	return fmt.Errorf("command %s did not finish within %s", aws.StringValue(commandID), timeout)
+}
@@ -0,0 +1,62 @@
+package mcapi_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"mcapi"
+	"mcapi/mcapitest"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ssm"
+)
+
+func TestSSMCommandRunner(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   string
+		polls    int
+		fail     error
+		commands []string
+		err      string
+		cancel   bool
+	}{
+		{name: "succeeds", status: ssm.CommandInvocationStatusSuccess, polls: 2, commands: []string{"systemctl stop minecraft"}},
+		{name: "document without commands", status: ssm.CommandInvocationStatusSuccess},
+		{name: "fails", status: ssm.CommandInvocationStatusFailed, err: "Failed"},
+		{name: "times out", status: ssm.CommandInvocationStatusSuccess, polls: 1000, err: "did not finish", cancel: true},
+		{name: "cannot be sent", fail: awserr.New(ssm.ErrCodeInvalidInstanceId, "not connected", nil), err: "not connected"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := mcapitest.NewFakeSSM()
+			svc.SetCommandResult(tt.status, tt.polls)
+			svc.Fail("SendCommand", tt.fail)
+			r := mcapi.NewSSMCommandRunner(mcapitest.Config(), svc)
+			r.PollInterval = time.Millisecond
+
+			err := r.Run("AWS-RunShellScript", tt.commands, 50*time.Millisecond)
+			if tt.err == "" && err != nil {
+				t.Fatalf("Run: %v", err)
+			}
+			if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Fatalf("Run error = %v, want it to contain %q", err, tt.err)
+			}
+			if svc.Called("CancelCommand") != tt.cancel {
+				t.Errorf("cancelled = %t, want %t", svc.Called("CancelCommand"), tt.cancel)
+			}
+			if tt.fail != nil {
+				return
+			}
+			sent := svc.Commands()
+			if len(sent) != 1 || aws.StringValue(sent[0].InstanceIds[0]) != mcapitest.InstanceID {
+				t.Fatalf("sent %v, want one command to the server", sent)
+			}
+			if got := aws.StringValueSlice(sent[0].Parameters["commands"]); strings.Join(got, ";") != strings.Join(tt.commands, ";") {
+				t.Errorf("commands = %v, want %v", got, tt.commands)
+			}
+		})
+	}
+}
@@ -0,0 +1,265 @@
+// Package mcapi holds the pieces shared by every minecraft API lambda handler:
+// configuration, response builders, error mapping and AWS client/parameter
+// helpers.
+package mcapi
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Session defaults, used when the environment does not set them
+const (
+	// DefaultSessionLength is 1:59 hours, giving the scheduled stop a minute
+	// of buffer on a two hour session
+	DefaultSessionLength = 119 * time.Minute
+	// DefaultSessionExtension is how much a session is extended by default
+	DefaultSessionExtension = 30 * time.Minute
+	// DefaultMaxSession caps the stop time at two hours from now
+	DefaultMaxSession = 120 * time.Minute
+	// DefaultGracePeriod is how long a scheduled stop is put off by while
+	// players are online
+	DefaultGracePeriod = 15 * time.Minute
+	// DefaultMaxGraceExtensions is how many times a scheduled stop is put off
+	// before the server is stopped anyway
+	DefaultMaxGraceExtensions = 4
+	// DefaultShutdownTimeout is how long stopServer waits for the server to
+	// shut down before stopping the instance anyway
+	DefaultShutdownTimeout = 60 * time.Second
+	// DefaultBackupRetention is how many backups are kept
+	DefaultBackupRetention = 5
+	// DefaultServerPort is the port minecraft servers listen on
+	DefaultServerPort = 25565
+	// DefaultPingTimeout is how long the status probe waits for the server
+	DefaultPingTimeout = 3 * time.Second
+	// DefaultRCONPort is the port minecraft servers listen for RCON on
+	DefaultRCONPort = 25575
+	// DefaultRCONTimeout is how long an RCON command may take
+	DefaultRCONTimeout = 5 * time.Second
+	// DefaultLinkCodeTTL is how long an account link code can be redeemed
+	DefaultLinkCodeTTL = 10 * time.Minute
+	// DefaultProfileCacheTTL is how long a player's UUID is cached for.
+	// Names can only change every 30 days, so a day rarely goes stale.
+	DefaultProfileCacheTTL = 24 * time.Hour
+)
+
+// DefaultShutdownWarnings are how long before a scheduled stop players are
+// warned of it
+var DefaultShutdownWarnings = []time.Duration{10 * time.Minute, 5 * time.Minute, time.Minute}
+
+// Policies for a scheduled stop that finds players online
+const (
+	// OnlinePolicyExtend puts the stop off by the grace period, up to the max
+	// grace extensions
+	OnlinePolicyExtend = "extend"
+	// OnlinePolicyStop stops the server anyway, logging a warning
+	OnlinePolicyStop = "stop"
+)
+
+// Config is the environment configuration shared by the handlers. Values are
+// set as lambda environment variables in template.yaml.
+type Config struct {
+	Region              string
+	ServerID            string
+	CloudfrontOrigin    string
+	TimerKeyName        string
+	ServerStatusKeyName string
+	CloudwatchRuleName  string
+	StopServerArn       string
+	UserLoginTableName  string
+	APIKey              string
+	// FunctionName is the name of the running lambda function, which hands
+	// long running work to an asynchronous invocation of itself
+	FunctionName string
+	// LifecycleKeyName is the state key holding the server's Lifecycle
+	LifecycleKeyName string
+	// SessionKeyName is the state key holding the current Session
+	SessionKeyName string
+	// RestoreKeyName is the state key holding the latest Restore
+	RestoreKeyName string
+	// StateBackend selects the StateStore holding the server status and stop
+	// timer: ssm (default), dynamodb, memory or file
+	StateBackend string
+	// StateFile is the path of the file backend's JSON file
+	StateFile string
+	// ResponseFormat is the response format used when a request does not ask
+	// for one: legacy (default) or envelope
+	ResponseFormat string
+	// SessionLength is how long the server runs after /start before it stops
+	// on its own, unless the request asks for less
+	SessionLength time.Duration
+	// SessionExtension is how much the session is extended by at a time
+	SessionExtension time.Duration
+	// MaxSession caps how far from now the stop time can be set
+	MaxSession time.Duration
+	// OnlinePolicy is what a scheduled stop does when players are online:
+	// extend (default) or stop
+	OnlinePolicy string
+	// GracePeriod is how long the extend policy puts the stop off by
+	GracePeriod time.Duration
+	// MaxGraceExtensions bounds how many times a session's stop is put off
+	MaxGraceExtensions int
+	// IdleTimeout is how long the server runs with nobody online before it is
+	// stopped early. Zero disables the idle stop.
+	IdleTimeout time.Duration
+	// ShutdownDocument is the SSM command document stopServer runs on the
+	// instance to shut the minecraft server down gracefully before stopping
+	// it. Empty skips the graceful shutdown.
+	ShutdownDocument string
+	// ShutdownCommand is the command passed to the shutdown document, for
+	// documents taking commands such as AWS-RunShellScript
+	ShutdownCommand string
+	// ShutdownTimeout is how long the graceful shutdown may take
+	ShutdownTimeout time.Duration
+	// WorldDevice is the device name of the volume holding the world, which
+	// is backed up after each session. Empty picks the root device.
+	WorldDevice string
+	// BackupRetention is how many backups are kept
+	BackupRetention int
+	// BackupMaxAge is how long backups are kept. Zero keeps them regardless
+	// of age.
+	BackupMaxAge time.Duration
+	// ServerAddress is the host players connect to, pinged to check the
+	// server is up. Empty pings the instance's public IP.
+	ServerAddress string
+	// ServerPort is the port the minecraft server listens on
+	ServerPort int
+	// PingTimeout is how long the status probe waits for the server
+	PingTimeout time.Duration
+	// RCONPort is the port the minecraft server listens for RCON on
+	RCONPort int
+	// RCONPasswordParameter is the name of the SSM SecureString parameter
+	// holding the server's rcon.password. Empty disables the admin commands.
+	RCONPasswordParameter string
+	// RCONTimeout is how long an RCON command may take, connecting included
+	RCONTimeout time.Duration
+	// ShutdownWarnings are how long before a scheduled stop it is broadcast to
+	// the players, longest first. Empty disables the warnings.
+	ShutdownWarnings []time.Duration
+	// BroadcastCommand is the command passed to the shutdown document to
+	// broadcast a message when RCON is not configured, with {message} standing
+	// for the shell quoted message. Empty broadcasts over RCON only.
+	BroadcastCommand string
+	// SyncWhitelist makes markServerStarted replace the server's whitelist
+	// with the one kept in the login table. On unless set to false.
+	SyncWhitelist bool
+	// LinkCodeTTL is how long an account link code can be redeemed in game
+	LinkCodeTTL time.Duration
+	// OfflineMode resolves player names to the UUIDs an offline mode server
+	// gives them, rather than asking Mojang
+	OfflineMode bool
+	// ProfileCacheTTL is how long a player's UUID resolved through Mojang is
+	// cached in the login table
+	ProfileCacheTTL time.Duration
+}
+
+// intEnv returns the environment variable name as a number, or fallback if it
+// is unset or not a positive number. Setting it to the fallback is always
+// valid, which is how an optional value defaulting to zero is turned off.
+func intEnv(name string, fallback int) int {
+	value := os.Getenv(name)
+	if value == "" || value == strconv.Itoa(fallback) {
+		return fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		fmt.Println("[LoadConfig]", "ignoring invalid", name, "of", value)
+		return fallback
+	}
+	return n
+}
+
+// minutesEnv returns the environment variable name as a number of minutes, or
+// fallback if it is unset or not a positive number
+func minutesEnv(name string, fallback time.Duration) time.Duration {
+	return time.Duration(intEnv(name, int(fallback/time.Minute))) * time.Minute
+}
+
+// minutesListEnv returns the environment variable name as a comma separated
+// list of minutes, longest first, or fallback if it is unset. Invalid entries
+// are ignored, so 0 turns the list off.
+func minutesListEnv(name string, fallback []time.Duration) []time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	var durations []time.Duration
+	seen := map[int]bool{}
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		n, err := strconv.Atoi(field)
+		if err != nil || n <= 0 {
+			if field != "0" {
+				fmt.Println("[LoadConfig]", "ignoring invalid", name, "entry", field)
+			}
+			continue
+		}
+		if !seen[n] {
+			seen[n] = true
+			durations = append(durations, time.Duration(n)*time.Minute)
+		}
+	}
+	sort.Slice(durations, func(i, j int) bool { return durations[i] > durations[j] })
+	return durations
+}
+
+// LoadConfig creates and returns new Config read from the environment
+func LoadConfig() *Config {
+	cfg := &Config{
+		Region:                os.Getenv("Region"),
+		ServerID:              os.Getenv("ServerId"),
+		CloudfrontOrigin:      os.Getenv("CloudfrontOrigin"),
+		TimerKeyName:          os.Getenv("TimerKeyName"),
+		ServerStatusKeyName:   os.Getenv("ServerStatusKeyName"),
+		LifecycleKeyName:      os.Getenv("LifecycleKeyName"),
+		SessionKeyName:        os.Getenv("SessionKeyName"),
+		RestoreKeyName:        os.Getenv("RestoreKeyName"),
+		CloudwatchRuleName:    os.Getenv("CloudwatchRuleName"),
+		StopServerArn:         os.Getenv("StopServerArn"),
+		UserLoginTableName:    os.Getenv("UserLoginTableName"),
+		APIKey:                os.Getenv("ApiKey"),
+		FunctionName:          os.Getenv("AWS_LAMBDA_FUNCTION_NAME"),
+		StateBackend:          os.Getenv("StateBackend"),
+		StateFile:             os.Getenv("StateFile"),
+		ResponseFormat:        os.Getenv("ResponseFormat"),
+		SessionLength:         minutesEnv("SessionMinutes", DefaultSessionLength),
+		SessionExtension:      minutesEnv("ExtensionMinutes", DefaultSessionExtension),
+		MaxSession:            minutesEnv("MaxSessionMinutes", DefaultMaxSession),
+		OnlinePolicy:          os.Getenv("OnlinePolicy"),
+		GracePeriod:           minutesEnv("GraceMinutes", DefaultGracePeriod),
+		MaxGraceExtensions:    intEnv("MaxGraceExtensions", DefaultMaxGraceExtensions),
+		IdleTimeout:           minutesEnv("IdleMinutes", 0),
+		ShutdownDocument:      os.Getenv("ShutdownDocument"),
+		ShutdownCommand:       os.Getenv("ShutdownCommand"),
+		ShutdownTimeout:       time.Duration(intEnv("ShutdownTimeoutSeconds", int(DefaultShutdownTimeout/time.Second))) * time.Second,
+		WorldDevice:           os.Getenv("WorldDevice"),
+		BackupRetention:       intEnv("BackupRetentionCount", DefaultBackupRetention),
+		BackupMaxAge:          time.Duration(intEnv("BackupRetentionDays", 0)) * 24 * time.Hour,
+		ServerAddress:         os.Getenv("ServerAddress"),
+		ServerPort:            intEnv("ServerPort", DefaultServerPort),
+		PingTimeout:           time.Duration(intEnv("PingTimeoutSeconds", int(DefaultPingTimeout/time.Second))) * time.Second,
+		RCONPort:              intEnv("RCONPort", DefaultRCONPort),
+		RCONPasswordParameter: os.Getenv("RCONPasswordParameter"),
+		RCONTimeout:           time.Duration(intEnv("RCONTimeoutSeconds", int(DefaultRCONTimeout/time.Second))) * time.Second,
+		ShutdownWarnings:      minutesListEnv("ShutdownWarningMinutes", DefaultShutdownWarnings),
+		BroadcastCommand:      os.Getenv("BroadcastCommand"),
+		SyncWhitelist:         os.Getenv("SyncWhitelist") != "false",
+		LinkCodeTTL:           minutesEnv("LinkCodeMinutes", DefaultLinkCodeTTL),
+		OfflineMode:           os.Getenv("OfflineMode") == "true",
+		ProfileCacheTTL:       time.Duration(intEnv("ProfileCacheHours", int(DefaultProfileCacheTTL/time.Hour))) * time.Hour,
+	}
+	if cfg.SessionLength > cfg.MaxSession {
+		fmt.Println("[LoadConfig]", "session length", cfg.SessionLength, "is over the max, using", cfg.MaxSession)
+		cfg.SessionLength = cfg.MaxSession
+	}
+	fmt.Println("[LoadConfig]", "region:", cfg.Region, "origin:", cfg.CloudfrontOrigin)
+	return cfg
+}
+
+// StopTargetID is the target ID of the stopServer lambda on the scheduled stop
+// rule
+const StopTargetID = "stopServerScheduledStopLambdaTarget"
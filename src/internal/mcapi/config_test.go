@@ -0,0 +1,107 @@
+package mcapi_test
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"mcapi"
+)
+
+// setenv sets the environment variable for a test, returning a func restoring
+// its previous value
+func setenv(t *testing.T, name, value string) func() {
+	previous, set := os.LookupEnv(name)
+	if err := os.Setenv(name, value); err != nil {
+		t.Fatal(err)
+	}
+	return func() {
+		if set {
+			os.Setenv(name, previous)
+		} else {
+			os.Unsetenv(name)
+		}
+	}
+}
+
+func TestLoadConfigSession(t *testing.T) {
+	tests := []struct {
+		name                   string
+		env                    map[string]string
+		length, extension, max time.Duration
+	}{
+		{"defaults", nil, mcapi.DefaultSessionLength, mcapi.DefaultSessionExtension, mcapi.DefaultMaxSession},
+		{
+			"configured",
+			map[string]string{"SessionMinutes": "60", "ExtensionMinutes": "15", "MaxSessionMinutes": "90"},
+			60 * time.Minute, 15 * time.Minute, 90 * time.Minute,
+		},
+		{
+			"invalid values fall back",
+			map[string]string{"SessionMinutes": "two hours", "ExtensionMinutes": "-5"},
+			mcapi.DefaultSessionLength, mcapi.DefaultSessionExtension, mcapi.DefaultMaxSession,
+		},
+		{
+			"session capped at max",
+			map[string]string{"SessionMinutes": "240"},
+			mcapi.DefaultMaxSession, mcapi.DefaultSessionExtension, mcapi.DefaultMaxSession,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range []string{"SessionMinutes", "ExtensionMinutes", "MaxSessionMinutes"} {
+				defer setenv(t, name, tt.env[name])()
+			}
+			cfg := mcapi.LoadConfig()
+			if cfg.SessionLength != tt.length || cfg.SessionExtension != tt.extension || cfg.MaxSession != tt.max {
+				t.Errorf("got %s/%s/%s, want %s/%s/%s", cfg.SessionLength, cfg.SessionExtension, cfg.MaxSession, tt.length, tt.extension, tt.max)
+			}
+		})
+	}
+}
+
+func TestLoadConfigGrace(t *testing.T) {
+	defer setenv(t, "OnlinePolicy", "stop")()
+	defer setenv(t, "GraceMinutes", "10")()
+	defer setenv(t, "MaxGraceExtensions", "0")()
+	cfg := mcapi.LoadConfig()
+	if cfg.OnlinePolicy != mcapi.OnlinePolicyStop {
+		t.Errorf("online policy = %q, want %q", cfg.OnlinePolicy, mcapi.OnlinePolicyStop)
+	}
+	if cfg.GracePeriod != 10*time.Minute {
+		t.Errorf("grace period = %s, want 10m", cfg.GracePeriod)
+	}
+	if cfg.MaxGraceExtensions != mcapi.DefaultMaxGraceExtensions {
+		t.Errorf("max grace extensions = %d, want default %d", cfg.MaxGraceExtensions, mcapi.DefaultMaxGraceExtensions)
+	}
+}
+
+func TestLoadConfigIdle(t *testing.T) {
+	for value, want := range map[string]time.Duration{"": 0, "0": 0, "20": 20 * time.Minute, "-1": 0} {
+		restore := setenv(t, "IdleMinutes", value)
+		if got := mcapi.LoadConfig().IdleTimeout; got != want {
+			t.Errorf("IdleMinutes %q: idle timeout = %s, want %s", value, got, want)
+		}
+		restore()
+	}
+}
+
+func TestLoadConfigShutdownWarnings(t *testing.T) {
+	tests := []struct {
+		value string
+		want  []time.Duration
+	}{
+		{"", mcapi.DefaultShutdownWarnings},
+		{"0", nil},
+		{"1,15, 5", []time.Duration{15 * time.Minute, 5 * time.Minute, time.Minute}},
+		{"5,x,5,-2", []time.Duration{5 * time.Minute}},
+	}
+	for _, tt := range tests {
+		restore := setenv(t, "ShutdownWarningMinutes", tt.value)
+		if got := mcapi.LoadConfig().ShutdownWarnings; !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ShutdownWarningMinutes %q: warnings = %v, want %v", tt.value, got, tt.want)
+		}
+		restore()
+	}
+}
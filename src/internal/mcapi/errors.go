@@ -0,0 +1,175 @@
+package mcapi
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+// ErrorCode is the machine readable code of an API error
+type ErrorCode string
+
+// Error codes returned in the response envelope
+const (
+	// CodeInvalidRequest means the request body or parameters were invalid
+	CodeInvalidRequest ErrorCode = "INVALID_REQUEST"
+	// CodeForbidden means AWS denied the lambda's role the call it made
+	CodeForbidden ErrorCode = "FORBIDDEN"
+	// CodeNotFound means the requested resource or state does not exist
+	CodeNotFound ErrorCode = "NOT_FOUND"
+	// CodeConflict means the request does not fit the current state, such as
+	// starting an instance that is stopping
+	CodeConflict ErrorCode = "CONFLICT"
+	// CodeThrottled means AWS throttled the call and it may be retried later
+	CodeThrottled ErrorCode = "THROTTLED"
+	// CodeAWS means a call to AWS failed for any other reason
+	CodeAWS ErrorCode = "AWS_ERROR"
+	// CodeUnavailable means the minecraft server itself could not be reached
+	// or refused the request, such as failing RCON authentication
+	CodeUnavailable ErrorCode = "SERVER_UNAVAILABLE"
+	// CodeInternal means anything else went wrong
+	CodeInternal ErrorCode = "INTERNAL_ERROR"
+)
+
+// statuses maps error codes to the HTTP status they are returned with
+var statuses = map[ErrorCode]int{
+	CodeInvalidRequest: 400,
+	CodeForbidden:      403,
+	CodeNotFound:       404,
+	CodeConflict:       409,
+	CodeThrottled:      429,
+	CodeAWS:            502,
+	CodeUnavailable:    503,
+	CodeInternal:       500,
+}
+
+// Status returns the HTTP status code errors with code c are returned with
+func (c ErrorCode) Status() int {
+	if status, ok := statuses[c]; ok {
+		return status
+	}
+	return 500
+}
+
+// awsErrorCodes maps the AWS error codes the handlers can run into to the
+// error code they are reported with. Unlisted AWS errors are reported as
+// AWS_ERROR.
+var awsErrorCodes = map[string]ErrorCode{
+	// bad input that made it past our own validation
+	"ValidationException":         CodeInvalidRequest,
+	"ValidationError":             CodeInvalidRequest,
+	"InvalidParameterValue":       CodeInvalidRequest,
+	"InvalidParameterException":   CodeInvalidRequest,
+	"InvalidParameterCombination": CodeInvalidRequest,
+	"MissingParameter":            CodeInvalidRequest,
+	"InvalidInstanceID.Malformed": CodeInvalidRequest,
+	"SerializationException":      CodeInvalidRequest,
+
+	// IAM denials and credential problems
+	"UnauthorizedOperation":       CodeForbidden,
+	"AuthFailure":                 CodeForbidden,
+	"AccessDenied":                CodeForbidden,
+	"AccessDeniedException":       CodeForbidden,
+	"UnrecognizedClientException": CodeForbidden,
+	"InvalidClientTokenId":        CodeForbidden,
+	"ExpiredToken":                CodeForbidden,
+	"ExpiredTokenException":       CodeForbidden,
+
+	// missing resources
+	"ParameterNotFound":          CodeNotFound,
+	"ResourceNotFoundException":  CodeNotFound,
+	"InvalidInstanceID.NotFound": CodeNotFound,
+	"InvalidVolume.NotFound":     CodeNotFound,
+	"InvalidSnapshot.NotFound":   CodeNotFound,
+
+	// requests that do not fit the current state
+	"IncorrectInstanceState":          CodeConflict,
+	"IncorrectState":                  CodeConflict,
+	"ConditionalCheckFailedException": CodeConflict,
+	"TransactionConflictException":    CodeConflict,
+	"ConcurrentModificationException": CodeConflict,
+	"TransactionConflict":             CodeConflict, // transaction cancellation reason
+	"ParameterAlreadyExists":          CodeConflict,
+	"ResourceInUseException":          CodeConflict,
+	"InvalidDocumentVersion":          CodeConflict,
+	"InvalidInstanceId":               CodeConflict, // SSM: instance not running or not managed
+
+	// throttling and quotas
+	"Throttling":                             CodeThrottled,
+	"ThrottlingException":                    CodeThrottled,
+	"ThrottledException":                     CodeThrottled,
+	"RequestLimitExceeded":                   CodeThrottled,
+	"TooManyUpdates":                         CodeThrottled,
+	"LimitExceededException":                 CodeThrottled,
+	"ProvisionedThroughputExceededException": CodeThrottled,
+	"RequestLimitExceededException":          CodeThrottled,
+	"TooManyRequestsException":               CodeThrottled,
+	// transaction cancellation reasons
+	"ThrottlingError":               CodeThrottled,
+	"ProvisionedThroughputExceeded": CodeThrottled,
+}
+
+// Error is an error carrying the API error code it should be reported with
+type Error struct {
+	Code    ErrorCode
+	Message string
+	Err     error
+}
+
+// Error implements error
+func (e *Error) Error() string {
+	if e.Message == "" && e.Err != nil {
+		return e.Err.Error()
+	}
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+// Unwrap returns the underlying error
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// NewError creates and returns new Error with a formatted message
+func NewError(code ErrorCode, format string, args ...interface{}) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// InvalidRequest wraps err, typically from parsing a request body, as an
+// INVALID_REQUEST error
+func InvalidRequest(err error) *Error {
+	return &Error{Code: CodeInvalidRequest, Err: err}
+}
+
+// AWSErrorCode returns the AWS error code carried by err, or an empty string
+// if err did not come from the AWS SDK. Wrapped errors are unwrapped.
+func AWSErrorCode(err error) string {
+	var aerr awserr.Error
+	if errors.As(err, &aerr) {
+		return aerr.Code()
+	}
+	return ""
+}
+
+// Classify returns the Error describing err. Errors that are not already an
+// Error are classified by what they wrap, AWS errors by their error code.
+func Classify(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	if errors.Is(err, ErrStateNotFound) {
+		return &Error{Code: CodeNotFound, Err: err}
+	}
+	awsCode := AWSErrorCode(err)
+	if awsCode == "" {
+		return &Error{Code: CodeInternal, Err: err}
+	}
+	if code, ok := awsErrorCodes[awsCode]; ok {
+		return &Error{Code: code, Err: err}
+	}
+	return &Error{Code: CodeAWS, Err: err}
+}
@@ -0,0 +1,8 @@
+require (
+	github.com/aws/aws-lambda-go v1.13.3
+	github.com/aws/aws-sdk-go v1.32.11
+)
+
+module mcapi
+
+go 1.13
@@ -0,0 +1,50 @@
+// Package addtowhitelist whitelists a player on the minecraft server, on
+// behalf of the website user asking.
+package addtowhitelist
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"mcapi"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// Body to marshal json request into
+type Body struct {
+	Username string `json:"username"`
+	// UUID is the player's UUID, optional
+	UUID string `json:"uuid"`
+}
+
+// Handler whitelists players using the injected clients
+type Handler struct {
+	Config  *mcapi.Config
+	Clients *mcapi.Clients
+	State   mcapi.StateStore
+}
+
+// Handle is main entry point to lambda function. Whitelisting a player again
+// replaces their entry.
+func (h *Handler) Handle(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	respond := mcapi.NewResponder(h.Config, request)
+
+	var body Body
+	err := json.Unmarshal([]byte(request.Body), &body)
+	if err != nil {
+		return respond.Error(mcapi.InvalidRequest(err)), nil
+	}
+	entry, err := mcapi.NewWhitelistEntry(body.Username, body.UUID, mcapi.CognitoUser(request), time.Now())
+	if err != nil {
+		return respond.Error(err), nil
+	}
+
+	fmt.Println("Whitelisting", entry.Username, "for", entry.CognitoUser, "...")
+	change, err := mcapi.AddToWhitelist(h.Config, h.Clients, h.State, entry)
+	if err != nil {
+		return respond.Error(err), nil
+	}
+	return respond.OK(change), nil
+}
@@ -0,0 +1,90 @@
+package addtowhitelist
+
+import (
+	"encoding/json"
+	"testing"
+
+	"mcapi"
+	"mcapi/mcapitest"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+func TestHandle(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		lifecycle  string
+		fail       error
+		statusCode int
+		want       mcapi.WhitelistChange
+		commands   int
+	}{
+		{
+			name:       "pushed to the started server",
+			body:       `{"username": "Steve", "uuid": "069A79F444E94726A5BEFCA90E38AAF5"}`,
+			lifecycle:  "started",
+			statusCode: 200,
+			want: mcapi.WhitelistChange{
+				WhitelistEntry: mcapi.WhitelistEntry{Username: "Steve", UUID: "069a79f4-44e9-4726-a5be-fca90e38aaf5", CognitoUser: "alice"},
+				Synced:         true,
+			},
+			commands: 1,
+		},
+		{
+			name:       "stored while stopped",
+			body:       `{"username": "Steve"}`,
+			lifecycle:  "stopped",
+			statusCode: 200,
+			want:       mcapi.WhitelistChange{WhitelistEntry: mcapi.WhitelistEntry{Username: "Steve", CognitoUser: "alice"}},
+		},
+		{name: "invalid username", body: `{"username": "Steve; op Steve"}`, statusCode: 400},
+		{name: "invalid uuid", body: `{"username": "Steve", "uuid": "nope"}`, statusCode: 400},
+		{name: "invalid body", body: `{`, statusCode: 400},
+		{name: "storing fails", body: `{"username": "Steve"}`, fail: awserr.New("AccessDeniedException", "denied", nil), statusCode: 403},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := mcapitest.Config()
+			c := mcapitest.NewClients()
+			c.EC2.SetState(cfg.ServerID, "running")
+			c.SSM.Set(cfg.LifecycleKeyName, tt.lifecycle)
+			c.DynamoDB.Fail("PutItem", tt.fail)
+			h := &Handler{Config: cfg, Clients: c.Clients(), State: mcapi.NewSSMStateStore(cfg, c.SSM)}
+
+			resp, err := h.Handle(events.APIGatewayProxyRequest{
+				Body: tt.body,
+				RequestContext: events.APIGatewayProxyRequestContext{
+					Authorizer: map[string]interface{}{
+						"claims": map[string]interface{}{"cognito:username": "alice"},
+					},
+				},
+			})
+			if err != nil {
+				t.Fatalf("Handle returned error: %v", err)
+			}
+			if resp.StatusCode != tt.statusCode {
+				t.Fatalf("status = %d, want %d (body %q)", resp.StatusCode, tt.statusCode, resp.Body)
+			}
+			if got := len(c.RCON.Commands()); got != tt.commands {
+				t.Errorf("RCON commands = %v, want %d", c.RCON.Commands(), tt.commands)
+			}
+			if tt.statusCode != 200 {
+				return
+			}
+			var got mcapi.WhitelistChange
+			if err := json.Unmarshal([]byte(resp.Body), &got); err != nil {
+				t.Fatalf("body %q: %v", resp.Body, err)
+			}
+			got.AddedAt = 0
+			if got != tt.want {
+				t.Errorf("change = %+v, want %+v", got, tt.want)
+			}
+			entries, _ := mcapi.GetWhitelist(cfg, c.DynamoDB)
+			if len(entries) != 1 || entries[0].Username != "Steve" {
+				t.Errorf("whitelist = %+v, want Steve", entries)
+			}
+		})
+	}
+}
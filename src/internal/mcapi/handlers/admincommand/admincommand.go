@@ -0,0 +1,189 @@
+// Package admincommand runs a fixed set of admin actions on the console of the
+// running minecraft server over RCON. Players whitelisted this way are kept in
+// the login table like those whitelisted through addtowhitelist.
+package admincommand
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"mcapi"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// Body to marshal json request into. Which fields are needed depends on the
+// action.
+type Body struct {
+	Player  string `json:"player"`
+	Message string `json:"message"`
+	Reason  string `json:"reason"`
+}
+
+// Result is the outcome of an admin action
+type Result struct {
+	Action  string `json:"action"`
+	Command string `json:"command"`
+	// Output is what the server answered the command with
+	Output string `json:"output"`
+}
+
+// LegacyBody implements mcapi.Legacy, returning the command output
+func (r Result) LegacyBody() string {
+	return r.Output
+}
+
+// maxTextLength bounds messages and kick reasons
+const maxTextLength = 256
+
+// player returns the validated player name of the body
+func (b Body) player() (string, error) {
+	if !mcapi.IsPlayerName(b.Player) {
+		return "", mcapi.NewError(mcapi.CodeInvalidRequest, "player must be a minecraft player name, got %q", b.Player)
+	}
+	return b.Player, nil
+}
+
+// text validates free text passed to a command: it must fit on one line, so
+// it cannot smuggle in another command
+func text(field, value string, required bool) (string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" && required {
+		return "", mcapi.NewError(mcapi.CodeInvalidRequest, "missing %s", field)
+	}
+	if len(value) > maxTextLength {
+		return "", mcapi.NewError(mcapi.CodeInvalidRequest, "%s is longer than %d bytes", field, maxTextLength)
+	}
+	for _, r := range value {
+		if unicode.IsControl(r) {
+			return "", mcapi.NewError(mcapi.CodeInvalidRequest, "%s must not contain control characters", field)
+		}
+	}
+	return value, nil
+}
+
+// actions maps the allowed actions to the console command they run
+var actions = map[string]func(Body) (string, error){
+	"say": func(b Body) (string, error) {
+		message, err := text("message", b.Message, true)
+		if err != nil {
+			return "", err
+		}
+		return "say " + message, nil
+	},
+	"save-all": func(Body) (string, error) {
+		return "save-all", nil
+	},
+	"whitelist-add": func(b Body) (string, error) {
+		player, err := b.player()
+		if err != nil {
+			return "", err
+		}
+		return "whitelist add " + player, nil
+	},
+	"kick": func(b Body) (string, error) {
+		player, err := b.player()
+		if err != nil {
+			return "", err
+		}
+		reason, err := text("reason", b.Reason, false)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace("kick " + player + " " + reason), nil
+	},
+	"list": func(Body) (string, error) {
+		return "list", nil
+	},
+}
+
+// Actions returns the names of the allowed actions, sorted
+func Actions() []string {
+	var names []string
+	for name := range actions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Handler runs admin actions using the injected clients
+type Handler struct {
+	Config  *mcapi.Config
+	Clients *mcapi.Clients
+	State   mcapi.StateStore
+}
+
+// command returns the console command the request asks for, along with the
+// body it was built from
+func command(action, requestBody string) (string, Body, error) {
+	var body Body
+	build, ok := actions[action]
+	if !ok {
+		return "", body, mcapi.NewError(mcapi.CodeNotFound, "Unknown action %q, want one of %s", action, strings.Join(Actions(), ", "))
+	}
+	if requestBody != "" {
+		err := json.Unmarshal([]byte(requestBody), &body)
+		if err != nil {
+			return "", body, mcapi.InvalidRequest(err)
+		}
+	}
+	cmd, err := build(body)
+	return cmd, body, err
+}
+
+// whitelistAdd whitelists the player the way /whitelist does, keeping them in
+// the login table so the next sync does not remove them again
+func (h *Handler) whitelistAdd(respond *mcapi.Responder, request events.APIGatewayProxyRequest, body Body) (events.APIGatewayProxyResponse, error) {
+	entry, err := mcapi.NewWhitelistEntry(body.Player, "", mcapi.CognitoUser(request), time.Now())
+	if err != nil {
+		return respond.Error(err), nil
+	}
+	fmt.Println("Whitelisting", entry.Username, "for", entry.CognitoUser, "...")
+	change, err := mcapi.AddToWhitelist(h.Config, h.Clients, h.State, entry)
+	if err != nil {
+		return respond.Error(err), nil
+	}
+	return respond.OK(change), nil
+}
+
+// Handle is main entry point to lambda function. The action is the {action}
+// path parameter.
+func (h *Handler) Handle(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	respond := mcapi.NewResponder(h.Config, request)
+
+	action := request.PathParameters["action"]
+	cmd, body, err := command(action, request.Body)
+	if err != nil {
+		return respond.Error(err), nil
+	}
+	if action == "whitelist-add" {
+		return h.whitelistAdd(respond, request, body)
+	}
+
+	lifecycle, err := mcapi.GetLifecycle(h.Config, h.State)
+	if err != nil {
+		return respond.Error(err), nil
+	}
+	fmt.Println("lifecycle:", lifecycle)
+	if lifecycle != mcapi.LifecycleStarted {
+		err = mcapi.NewError(mcapi.CodeConflict, "Server is %s, not started", lifecycle)
+		return respond.Error(err), nil
+	}
+
+	address, err := mcapi.RCONAddress(h.Config, h.Clients.EC2)
+	if err != nil {
+		return respond.Error(err), nil
+	}
+	fmt.Println("Running", action, "on", address, "...")
+	output, err := h.Clients.RCON.Command(address, cmd)
+	if err != nil {
+		return respond.Error(err), nil
+	}
+	fmt.Println("output:", output)
+	return respond.OK(Result{Action: action, Command: cmd, Output: output}), nil
+}
@@ -0,0 +1,153 @@
+package admincommand
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"mcapi"
+	"mcapi/mcapitest"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestHandle(t *testing.T) {
+	cfg := mcapitest.Config()
+	tests := []struct {
+		name       string
+		action     string
+		body       string
+		lifecycle  string
+		statusCode int
+		command    string
+	}{
+		{name: "say", action: "say", body: `{"message": " Restarting in 5 minutes "}`, statusCode: 200, command: "say Restarting in 5 minutes"},
+		{name: "save-all", action: "save-all", statusCode: 200, command: "save-all"},
+		{name: "kick", action: "kick", body: `{"player": "griefer", "reason": "griefing"}`, statusCode: 200, command: "kick griefer griefing"},
+		{name: "kick without reason", action: "kick", body: `{"player": "griefer"}`, statusCode: 200, command: "kick griefer"},
+		{name: "list", action: "list", statusCode: 200, command: "list"},
+		{name: "unknown action", action: "op", body: `{"player": "Steve"}`, statusCode: 404},
+		{name: "missing message", action: "say", statusCode: 400},
+		{name: "message smuggling a command", action: "say", body: `{"message": "hi\nop Steve"}`, statusCode: 400},
+		{name: "message too long", action: "say", body: `{"message": "` + strings.Repeat("a", 300) + `"}`, statusCode: 400},
+		{name: "invalid player", action: "whitelist-add", body: `{"player": "Steve; op Steve"}`, statusCode: 400},
+		{name: "invalid body", action: "kick", body: `{`, statusCode: 400},
+		{name: "server stopped", action: "list", lifecycle: "stopped", statusCode: 409},
+		{name: "server starting", action: "list", lifecycle: "starting", statusCode: 409},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := mcapitest.NewClients()
+			c.EC2.SetState(cfg.ServerID, "running")
+			c.EC2.SetAddress(cfg.ServerID, "203.0.113.7", "")
+			lifecycle := tt.lifecycle
+			if lifecycle == "" {
+				lifecycle = "started"
+			}
+			c.SSM.Set(cfg.LifecycleKeyName, lifecycle)
+			c.RCON.SetOutput(tt.command, "done")
+			h := &Handler{Config: cfg, Clients: c.Clients(), State: mcapi.NewSSMStateStore(cfg, c.SSM)}
+
+			resp, err := h.Handle(events.APIGatewayProxyRequest{
+				PathParameters:        map[string]string{"action": tt.action},
+				Body:                  tt.body,
+				QueryStringParameters: map[string]string{"format": "envelope"},
+			})
+			if err != nil {
+				t.Fatalf("Handle returned error: %v", err)
+			}
+			if resp.StatusCode != tt.statusCode {
+				t.Fatalf("status = %d, want %d (body %q)", resp.StatusCode, tt.statusCode, resp.Body)
+			}
+			commands := c.RCON.Commands()
+			if tt.statusCode != 200 {
+				if len(commands) != 0 {
+					t.Errorf("ran %v, want nothing", commands)
+				}
+				return
+			}
+			if len(commands) != 1 || commands[0] != tt.command {
+				t.Fatalf("ran %v, want [%s]", commands, tt.command)
+			}
+			if addresses := c.RCON.Addresses(); addresses[0] != "10.0.0.7:25575" {
+				t.Errorf("ran at %s, want 10.0.0.7:25575", addresses[0])
+			}
+			var envelope struct{ Data Result }
+			if err := json.Unmarshal([]byte(resp.Body), &envelope); err != nil {
+				t.Fatalf("body %q: %v", resp.Body, err)
+			}
+			want := Result{Action: tt.action, Command: tt.command, Output: "done"}
+			if envelope.Data != want {
+				t.Errorf("result = %+v, want %+v", envelope.Data, want)
+			}
+		})
+	}
+}
+
+func TestHandleWhitelistAdd(t *testing.T) {
+	cfg := mcapitest.Config()
+	tests := []struct {
+		name      string
+		lifecycle string
+		commands  string
+		synced    bool
+	}{
+		{name: "started", lifecycle: "started", commands: "[whitelist add Steve_1]", synced: true},
+		{name: "stopped", lifecycle: "stopped", commands: "[]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := mcapitest.NewClients()
+			c.EC2.SetState(cfg.ServerID, "running")
+			c.SSM.Set(cfg.LifecycleKeyName, tt.lifecycle)
+			h := &Handler{Config: cfg, Clients: c.Clients(), State: mcapi.NewSSMStateStore(cfg, c.SSM)}
+
+			resp, err := h.Handle(events.APIGatewayProxyRequest{
+				PathParameters:        map[string]string{"action": "whitelist-add"},
+				Body:                  `{"player": "Steve_1"}`,
+				QueryStringParameters: map[string]string{"format": "envelope"},
+			})
+			if err != nil {
+				t.Fatalf("Handle returned error: %v", err)
+			}
+			if resp.StatusCode != 200 {
+				t.Fatalf("status = %d, want 200 (body %q)", resp.StatusCode, resp.Body)
+			}
+			if got := fmt.Sprint(c.RCON.Commands()); got != tt.commands {
+				t.Errorf("ran %s, want %s", got, tt.commands)
+			}
+			var envelope struct{ Data mcapi.WhitelistChange }
+			if err := json.Unmarshal([]byte(resp.Body), &envelope); err != nil {
+				t.Fatalf("body %q: %v", resp.Body, err)
+			}
+			if envelope.Data.Username != "Steve_1" || envelope.Data.Synced != tt.synced {
+				t.Errorf("change = %+v, want Steve_1 synced %t", envelope.Data, tt.synced)
+			}
+			// kept in the table, so the next sync does not remove them again
+			entries, err := mcapi.GetWhitelist(cfg, c.DynamoDB)
+			if err != nil || len(entries) != 1 || entries[0].Username != "Steve_1" {
+				t.Errorf("whitelist = %+v, %v, want Steve_1 stored", entries, err)
+			}
+		})
+	}
+}
+
+func TestHandleRCONFails(t *testing.T) {
+	cfg := mcapitest.Config()
+	c := mcapitest.NewClients()
+	c.EC2.SetState(cfg.ServerID, "running")
+	c.EC2.SetAddress(cfg.ServerID, "203.0.113.7", "")
+	c.SSM.Set(cfg.LifecycleKeyName, "started")
+	c.RCON.Fail("Command", mcapi.NewError(mcapi.CodeUnavailable, "RCON authentication failed"))
+	h := &Handler{Config: cfg, Clients: c.Clients(), State: mcapi.NewSSMStateStore(cfg, c.SSM)}
+
+	resp, err := h.Handle(events.APIGatewayProxyRequest{PathParameters: map[string]string{"action": "list"}})
+	if err != nil {
+		t.Fatalf("Handle returned error: %v", err)
+	}
+	if resp.StatusCode != 503 || resp.Body != "RCON authentication failed" {
+		t.Errorf("response = %d %q, want 503 RCON authentication failed", resp.StatusCode, resp.Body)
+	}
+}
@@ -0,0 +1,63 @@
+// Package backupserver backs up the world of the minecraft server once its
+// instance has stopped, pruning backups past the retention policy.
+package backupserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"mcapi"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// Detail is the detail of an EC2 instance state-change notification
+type Detail struct {
+	InstanceID string `json:"instance-id"`
+	State      string `json:"state"`
+}
+
+// Handler backs up the minecraft server using the injected AWS clients
+type Handler struct {
+	Config  *mcapi.Config
+	Clients *mcapi.Clients
+	State   mcapi.StateStore
+}
+
+// Handle is main entry point to lambda function. It returns the backup taken,
+// or an empty backup for events about other instances or states.
+func (h *Handler) Handle(event events.CloudWatchEvent) (mcapi.Backup, error) {
+	var detail Detail
+	err := json.Unmarshal(event.Detail, &detail)
+	if err != nil {
+		return mcapi.Backup{}, err
+	}
+	fmt.Println("instance", detail.InstanceID, "is", detail.State)
+	if detail.InstanceID != h.Config.ServerID || detail.State != ec2.InstanceStateNameStopped {
+		fmt.Println("Not the server stopping, nothing to back up")
+		return mcapi.Backup{}, nil
+	}
+
+	// servers stopped outside of the API have no session to describe
+	session, err := mcapi.GetSession(h.Config, h.State)
+	if err != nil && !errors.Is(err, mcapi.ErrStateNotFound) {
+		return mcapi.Backup{}, err
+	}
+	backup, err := mcapi.CreateBackup(h.Config, h.Clients.EC2, session, mcapi.BackupOnStop)
+	if err != nil {
+		return mcapi.Backup{}, err
+	}
+	fmt.Println("Backed up world as", backup.SnapshotID)
+
+	// failing here must not fail the event, or the retry would take another
+	// backup
+	deleted, err := mcapi.PruneBackups(h.Config, h.Clients.EC2, time.Now())
+	if err != nil {
+		fmt.Println("WARNING: could not prune backups:", err)
+	}
+	fmt.Println("Pruned", len(deleted), "backups")
+	return backup, nil
+}
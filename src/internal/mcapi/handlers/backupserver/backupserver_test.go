@@ -0,0 +1,124 @@
+package backupserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"mcapi"
+	"mcapi/mcapitest"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// stateChange returns the state-change notification of instanceID
+func stateChange(instanceID, state string) events.CloudWatchEvent {
+	detail, _ := json.Marshal(Detail{InstanceID: instanceID, State: state})
+	return events.CloudWatchEvent{Source: "aws.ec2", DetailType: "EC2 Instance State-change Notification", Detail: detail}
+}
+
+func TestHandle(t *testing.T) {
+	cfg := mcapitest.Config()
+	ended := mcapi.Session{StartTime: 1000, Extensions: 1, StopTime: 9000, StopReason: "scheduled"}
+	stored := `{"startTime": 1000, "extensions": 1, "stopTime": 9000, "stopReason": "scheduled"}`
+	tests := []struct {
+		name     string
+		event    events.CloudWatchEvent
+		stored   string
+		setup    func(c *mcapitest.Clients)
+		err      bool
+		snapshot bool
+		session  mcapi.Session
+		kept     int
+	}{
+		{
+			name:     "backs up a stopped server",
+			event:    stateChange(cfg.ServerID, "stopped"),
+			stored:   stored,
+			snapshot: true,
+			session:  ended,
+			kept:     1,
+		},
+		{
+			name:   "prunes old backups",
+			event:  stateChange(cfg.ServerID, "stopped"),
+			stored: stored,
+			setup: func(c *mcapitest.Clients) {
+				for n := 0; n < cfg.BackupRetention; n++ {
+					c.EC2.AddSnapshot(&ec2.Snapshot{
+						SnapshotId: aws.String(fmt.Sprintf("snap-old%d", n)),
+						StartTime:  aws.Time(time.Now().Add(-time.Duration(n+1) * time.Hour)),
+						Tags:       []*ec2.Tag{{Key: aws.String(mcapi.BackupTagKey), Value: aws.String(cfg.ServerID)}},
+					})
+				}
+			},
+			snapshot: true,
+			session:  ended,
+			kept:     cfg.BackupRetention,
+		},
+		{
+			name:   "pruning fails",
+			event:  stateChange(cfg.ServerID, "stopped"),
+			stored: stored,
+			setup: func(c *mcapitest.Clients) {
+				c.EC2.Fail("DescribeSnapshots", awserr.New("RequestLimitExceeded", "slow down", nil))
+			},
+			snapshot: true,
+			session:  ended,
+		},
+		{
+			name:     "stopped outside the API",
+			event:    stateChange(cfg.ServerID, "stopped"),
+			snapshot: true,
+			kept:     1,
+		},
+		{name: "another instance", event: stateChange("i-other", "stopped"), stored: stored},
+		{name: "not stopped yet", event: stateChange(cfg.ServerID, "stopping"), stored: stored},
+		{
+			name:   "snapshot fails",
+			event:  stateChange(cfg.ServerID, "stopped"),
+			stored: stored,
+			setup: func(c *mcapitest.Clients) {
+				c.EC2.Fail("CreateSnapshot", awserr.New("SnapshotCreationPerVolumeRateExceeded", "slow down", nil))
+			},
+			err: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := mcapitest.NewClients()
+			c.EC2.SetState(cfg.ServerID, "stopped")
+			c.EC2.SetVolume(cfg.ServerID, "/dev/xvda", "vol-world")
+			if tt.stored != "" {
+				c.SSM.Set(cfg.SessionKeyName, tt.stored)
+			}
+			if tt.setup != nil {
+				tt.setup(c)
+			}
+			h := &Handler{Config: cfg, Clients: c.Clients(), State: mcapi.NewSSMStateStore(cfg, c.SSM)}
+
+			backup, err := h.Handle(tt.event)
+			if (err != nil) != tt.err {
+				t.Fatalf("Handle error = %v, want error %t", err, tt.err)
+			}
+			if !tt.snapshot {
+				if backup.SnapshotID != "" || len(c.EC2.Snapshots()) != 0 {
+					t.Errorf("backed up as %q, want no backup", backup.SnapshotID)
+				}
+				return
+			}
+			if backup.SnapshotID == "" || backup.VolumeID != "vol-world" || !reflect.DeepEqual(backup.Session, tt.session) {
+				t.Errorf("backup = %+v, want of vol-world after %+v", backup, tt.session)
+			}
+			if tt.kept > 0 && len(c.EC2.Snapshots()) != tt.kept {
+				t.Errorf("kept %d snapshots, want %d", len(c.EC2.Snapshots()), tt.kept)
+			}
+		})
+	}
+}
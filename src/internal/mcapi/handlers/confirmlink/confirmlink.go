@@ -0,0 +1,56 @@
+// Package confirmlink redeems a link code typed in game. It is called by the
+// minecraft server with the API key, reporting the player who typed the code.
+package confirmlink
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"mcapi"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// Body to marshal json request into
+type Body struct {
+	Code string `json:"code"`
+	// UUID and Username identify the player who typed the code
+	UUID     string `json:"uuid"`
+	Username string `json:"username"`
+}
+
+// Handler redeems link codes using the injected AWS clients
+type Handler struct {
+	Config  *mcapi.Config
+	Clients *mcapi.Clients
+}
+
+// Handle is main entry point to lambda function
+func (h *Handler) Handle(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	respond := mcapi.NewResponder(h.Config, request)
+
+	var body Body
+	err := json.Unmarshal([]byte(request.Body), &body)
+	if err != nil {
+		return respond.Error(mcapi.InvalidRequest(err)), nil
+	}
+	if body.Code == "" {
+		return respond.Error(mcapi.NewError(mcapi.CodeInvalidRequest, "code is required")), nil
+	}
+	if !mcapi.IsPlayerName(body.Username) {
+		return respond.Error(mcapi.NewError(mcapi.CodeInvalidRequest, "username must be a minecraft player name, got %q", body.Username)), nil
+	}
+	uuid, err := mcapi.NormalizeUUID(body.UUID)
+	if err != nil {
+		return respond.Error(err), nil
+	}
+
+	fmt.Println("Redeeming link code for", body.Username, "...")
+	link, err := mcapi.RedeemLinkCode(h.Config, h.Clients.DynamoDB, body.Code, uuid, body.Username, time.Now())
+	if err != nil {
+		return respond.Error(err), nil
+	}
+	fmt.Println(link.Username, "linked to", link.CognitoUser)
+	return respond.OK(link), nil
+}
@@ -0,0 +1,80 @@
+package confirmlink
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"mcapi"
+	"mcapi/mcapitest"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestHandle(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string // {code} is replaced with the code
+		statusCode int
+		want       mcapi.Link
+	}{
+		{
+			name:       "redeemed",
+			body:       `{"code": "{code}", "uuid": "069A79F444E94726A5BEFCA90E38AAF5", "username": "Steve"}`,
+			statusCode: 200,
+			want:       mcapi.Link{Sub: "sub-alice", CognitoUser: "alice", UUID: "069a79f4-44e9-4726-a5be-fca90e38aaf5", Username: "Steve"},
+		},
+		{
+			name:       "unknown code",
+			body:       `{"code": "NOPE", "uuid": "069a79f4-44e9-4726-a5be-fca90e38aaf5", "username": "Steve"}`,
+			statusCode: 404,
+		},
+		{
+			name:       "missing code",
+			body:       `{"uuid": "069a79f4-44e9-4726-a5be-fca90e38aaf5", "username": "Steve"}`,
+			statusCode: 400,
+		},
+		{
+			name:       "invalid username",
+			body:       `{"code": "{code}", "uuid": "069a79f4-44e9-4726-a5be-fca90e38aaf5", "username": "Steve; op Steve"}`,
+			statusCode: 400,
+		},
+		{
+			name:       "invalid uuid",
+			body:       `{"code": "{code}", "uuid": "nope", "username": "Steve"}`,
+			statusCode: 400,
+		},
+		{name: "invalid body", body: `{`, statusCode: 400},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := mcapitest.Config()
+			c := mcapitest.NewClients()
+			code, err := mcapi.CreateLinkCode(cfg, c.DynamoDB, "sub-alice", "alice", time.Now())
+			if err != nil {
+				t.Fatal(err)
+			}
+			h := &Handler{Config: cfg, Clients: c.Clients()}
+
+			resp, err := h.Handle(events.APIGatewayProxyRequest{Body: strings.Replace(tt.body, "{code}", code.Code, -1)})
+			if err != nil {
+				t.Fatalf("Handle returned error: %v", err)
+			}
+			if resp.StatusCode != tt.statusCode {
+				t.Fatalf("status = %d, want %d (body %q)", resp.StatusCode, tt.statusCode, resp.Body)
+			}
+			if tt.statusCode != 200 {
+				return
+			}
+			var got mcapi.Link
+			if err := json.Unmarshal([]byte(resp.Body), &got); err != nil {
+				t.Fatalf("body %q: %v", resp.Body, err)
+			}
+			got.LinkedAt = 0
+			if got != tt.want {
+				t.Errorf("link = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+// Package createbackup backs up the world of the minecraft server on demand.
+package createbackup
+
+import (
+	"errors"
+	"fmt"
+
+	"mcapi"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// Handler backs up the minecraft server using the injected AWS clients
+type Handler struct {
+	Config  *mcapi.Config
+	Clients *mcapi.Clients
+	State   mcapi.StateStore
+}
+
+// Handle is main entry point to lambda function. Backups of a running server
+// are taken as the world is on disk at that moment, without asking the game
+// to save first.
+func (h *Handler) Handle(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	respond := mcapi.NewResponder(h.Config, request)
+
+	// the backup is tagged with the current session, or the last one if the
+	// server is stopped
+	session, err := mcapi.GetSession(h.Config, h.State)
+	if err != nil && !errors.Is(err, mcapi.ErrStateNotFound) {
+		return respond.Error(err), nil
+	}
+	fmt.Println("Backing up world of", h.Config.ServerID, "...")
+	backup, err := mcapi.CreateBackup(h.Config, h.Clients.EC2, session, mcapi.BackupOnRequest)
+	if err != nil {
+		return respond.Error(err), nil
+	}
+	fmt.Println("Backed up world as", backup.SnapshotID)
+	return respond.OK(backup), nil
+}
@@ -0,0 +1,78 @@
+package createbackup
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"mcapi"
+	"mcapi/mcapitest"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+func TestHandle(t *testing.T) {
+	cfg := mcapitest.Config()
+	tests := []struct {
+		name       string
+		stored     string
+		fail       map[string]error
+		statusCode int
+		session    mcapi.Session
+	}{
+		{
+			name:       "backs up the running session",
+			stored:     `{"startTime": 1000, "extensions": 2}`,
+			statusCode: 200,
+			session:    mcapi.Session{StartTime: 1000, Extensions: 2},
+		},
+		{name: "no session", statusCode: 200},
+		{
+			name:       "instance lookup fails",
+			fail:       map[string]error{"DescribeInstances": awserr.New("UnauthorizedOperation", "denied", nil)},
+			statusCode: 403,
+		},
+		{
+			name:       "snapshot fails",
+			fail:       map[string]error{"CreateSnapshot": awserr.New("SnapshotCreationPerVolumeRateExceeded", "slow down", nil)},
+			statusCode: 502,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := mcapitest.NewClients()
+			c.EC2.SetState(cfg.ServerID, "running")
+			c.EC2.SetVolume(cfg.ServerID, "/dev/xvda", "vol-world")
+			if tt.stored != "" {
+				c.SSM.Set(cfg.SessionKeyName, tt.stored)
+			}
+			for op, err := range tt.fail {
+				c.EC2.Fail(op, err)
+			}
+			h := &Handler{Config: cfg, Clients: c.Clients(), State: mcapi.NewSSMStateStore(cfg, c.SSM)}
+
+			resp, err := h.Handle(events.APIGatewayProxyRequest{})
+			if err != nil {
+				t.Fatalf("Handle returned error: %v", err)
+			}
+			if resp.StatusCode != tt.statusCode {
+				t.Fatalf("status = %d, want %d (body %q)", resp.StatusCode, tt.statusCode, resp.Body)
+			}
+			if tt.statusCode != 200 {
+				if len(c.EC2.Snapshots()) != 0 {
+					t.Errorf("took %d snapshots, want none", len(c.EC2.Snapshots()))
+				}
+				return
+			}
+			var backup mcapi.Backup
+			if err := json.Unmarshal([]byte(resp.Body), &backup); err != nil {
+				t.Fatalf("body %q: %v", resp.Body, err)
+			}
+			if backup.VolumeID != "vol-world" || backup.Trigger != mcapi.BackupOnRequest || !reflect.DeepEqual(backup.Session, tt.session) {
+				t.Errorf("backup = %+v, want of vol-world on request during %+v", backup, tt.session)
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+// Package createlinkcode hands the website user asking a one-time code to
+// type in game, linking their minecraft account to them.
+package createlinkcode
+
+import (
+	"fmt"
+	"time"
+
+	"mcapi"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// Handler creates link codes using the injected AWS clients
+type Handler struct {
+	Config  *mcapi.Config
+	Clients *mcapi.Clients
+}
+
+// Handle is main entry point to lambda function. Asking again hands out
+// another code, and the earlier ones keep working until they expire.
+func (h *Handler) Handle(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	respond := mcapi.NewResponder(h.Config, request)
+	cognitoUser := mcapi.CognitoUser(request)
+	fmt.Println("Creating link code for", cognitoUser, "...")
+	code, err := mcapi.CreateLinkCode(h.Config, h.Clients.DynamoDB, mcapi.CognitoSub(request), cognitoUser, time.Now())
+	if err != nil {
+		return respond.Error(err), nil
+	}
+	fmt.Println("link code expires:", code.Expires)
+	return respond.OK(code), nil
+}
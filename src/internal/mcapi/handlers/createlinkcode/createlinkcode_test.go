@@ -0,0 +1,67 @@
+package createlinkcode
+
+import (
+	"encoding/json"
+	"testing"
+
+	"mcapi"
+	"mcapi/mcapitest"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+func TestHandle(t *testing.T) {
+	tests := []struct {
+		name       string
+		claims     map[string]interface{}
+		fail       error
+		statusCode int
+	}{
+		{
+			name:       "signed in user",
+			claims:     map[string]interface{}{"sub": "sub-alice", "cognito:username": "alice"},
+			statusCode: 200,
+		},
+		{name: "not signed in", statusCode: 403},
+		{
+			name:       "storing fails",
+			claims:     map[string]interface{}{"sub": "sub-alice", "cognito:username": "alice"},
+			fail:       awserr.New("AccessDeniedException", "denied", nil),
+			statusCode: 403,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := mcapitest.Config()
+			c := mcapitest.NewClients()
+			c.DynamoDB.Fail("PutItem", tt.fail)
+			h := &Handler{Config: cfg, Clients: c.Clients()}
+
+			request := events.APIGatewayProxyRequest{}
+			if tt.claims != nil {
+				request.RequestContext.Authorizer = map[string]interface{}{"claims": tt.claims}
+			}
+			resp, err := h.Handle(request)
+			if err != nil {
+				t.Fatalf("Handle returned error: %v", err)
+			}
+			if resp.StatusCode != tt.statusCode {
+				t.Fatalf("status = %d, want %d (body %q)", resp.StatusCode, tt.statusCode, resp.Body)
+			}
+			if tt.statusCode != 200 {
+				return
+			}
+			var code mcapi.LinkCode
+			if err := json.Unmarshal([]byte(resp.Body), &code); err != nil {
+				t.Fatalf("body %q: %v", resp.Body, err)
+			}
+			if len(code.Code) != 8 || code.CognitoUser != "alice" || code.Expires == 0 {
+				t.Errorf("code = %+v", code)
+			}
+			if got := len(c.DynamoDB.Items(cfg.UserLoginTableName)); got != 1 {
+				t.Errorf("stored %d items, want 1", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,28 @@
+// Package getbackups lists the backups of the minecraft server world.
+package getbackups
+
+import (
+	"fmt"
+
+	"mcapi"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// Handler lists backups using the injected AWS clients
+type Handler struct {
+	Config  *mcapi.Config
+	Clients *mcapi.Clients
+}
+
+// Handle is main entry point to lambda function
+func (h *Handler) Handle(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	respond := mcapi.NewResponder(h.Config, request)
+	fmt.Println("Listing backups of", h.Config.ServerID, "...")
+	backups, err := mcapi.ListBackups(h.Config, h.Clients.EC2)
+	if err != nil {
+		return respond.Error(err), nil
+	}
+	fmt.Println("backups:", len(backups))
+	return respond.OK(backups), nil
+}
@@ -0,0 +1,62 @@
+package getbackups
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"mcapi"
+	"mcapi/mcapitest"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+func TestHandle(t *testing.T) {
+	cfg := mcapitest.Config()
+	tag := []*ec2.Tag{{Key: aws.String(mcapi.BackupTagKey), Value: aws.String(cfg.ServerID)}}
+	tests := []struct {
+		name       string
+		fail       error
+		statusCode int
+		want       []string
+	}{
+		{name: "newest first", statusCode: 200, want: []string{"snap-new", "snap-old"}},
+		{name: "listing fails", fail: awserr.New("UnauthorizedOperation", "denied", nil), statusCode: 403},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := mcapitest.NewClients()
+			c.EC2.AddSnapshot(&ec2.Snapshot{SnapshotId: aws.String("snap-old"), StartTime: aws.Time(time.Now().Add(-time.Hour)), Tags: tag})
+			c.EC2.AddSnapshot(&ec2.Snapshot{SnapshotId: aws.String("snap-new"), StartTime: aws.Time(time.Now()), Tags: tag})
+			c.EC2.AddSnapshot(&ec2.Snapshot{SnapshotId: aws.String("snap-other"), StartTime: aws.Time(time.Now())})
+			c.EC2.Fail("DescribeSnapshots", tt.fail)
+			h := &Handler{Config: cfg, Clients: c.Clients()}
+
+			resp, err := h.Handle(events.APIGatewayProxyRequest{})
+			if err != nil {
+				t.Fatalf("Handle returned error: %v", err)
+			}
+			if resp.StatusCode != tt.statusCode {
+				t.Fatalf("status = %d, want %d (body %q)", resp.StatusCode, tt.statusCode, resp.Body)
+			}
+			if tt.statusCode != 200 {
+				return
+			}
+			var backups []mcapi.Backup
+			if err := json.Unmarshal([]byte(resp.Body), &backups); err != nil {
+				t.Fatalf("body %q: %v", resp.Body, err)
+			}
+			if len(backups) != len(tt.want) {
+				t.Fatalf("backups = %+v, want %v", backups, tt.want)
+			}
+			for n, b := range backups {
+				if b.SnapshotID != tt.want[n] {
+					t.Errorf("backup %d = %s, want %s", n, b.SnapshotID, tt.want[n])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,21 @@
+// Package getkey returns the API key needed by the other API calls.
+package getkey
+
+import (
+	"fmt"
+
+	"mcapi"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// Handler returns the configured API key
+type Handler struct {
+	Config *mcapi.Config
+}
+
+// Handle is main entry point to lambda function
+func (h *Handler) Handle(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	fmt.Println("Event:", request)
+	return mcapi.NewResponder(h.Config, request).OK(h.Config.APIKey), nil
+}
@@ -0,0 +1,33 @@
+// Package getlink returns the minecraft account linked to the website user
+// asking.
+package getlink
+
+import (
+	"fmt"
+
+	"mcapi"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// Handler looks up links using the injected AWS clients
+type Handler struct {
+	Config  *mcapi.Config
+	Clients *mcapi.Clients
+}
+
+// Handle is main entry point to lambda function
+func (h *Handler) Handle(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	respond := mcapi.NewResponder(h.Config, request)
+	sub := mcapi.CognitoSub(request)
+	if sub == "" {
+		return respond.Error(mcapi.NewError(mcapi.CodeForbidden, "Looking up a linked account needs a signed in website user")), nil
+	}
+	fmt.Println("Looking up account linked to", mcapi.CognitoUser(request), "...")
+	link, err := mcapi.GetLinkBySub(h.Config, h.Clients.DynamoDB, sub)
+	if err != nil {
+		return respond.Error(err), nil
+	}
+	fmt.Println("linked to:", link.Username)
+	return respond.OK(link), nil
+}
@@ -0,0 +1,64 @@
+package getlink
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"mcapi"
+	"mcapi/mcapitest"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestHandle(t *testing.T) {
+	tests := []struct {
+		name       string
+		sub        string
+		statusCode int
+		want       string
+	}{
+		{name: "linked", sub: "sub-alice", statusCode: 200, want: "Steve"},
+		{name: "not linked", sub: "sub-bob", statusCode: 404},
+		{name: "not signed in", statusCode: 403},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := mcapitest.Config()
+			c := mcapitest.NewClients()
+			code, err := mcapi.CreateLinkCode(cfg, c.DynamoDB, "sub-alice", "alice", time.Now())
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = mcapi.RedeemLinkCode(cfg, c.DynamoDB, code.Code, "069a79f4-44e9-4726-a5be-fca90e38aaf5", "Steve", time.Now())
+			if err != nil {
+				t.Fatal(err)
+			}
+			h := &Handler{Config: cfg, Clients: c.Clients()}
+
+			request := events.APIGatewayProxyRequest{}
+			if tt.sub != "" {
+				request.RequestContext.Authorizer = map[string]interface{}{
+					"claims": map[string]interface{}{"sub": tt.sub},
+				}
+			}
+			resp, err := h.Handle(request)
+			if err != nil {
+				t.Fatalf("Handle returned error: %v", err)
+			}
+			if resp.StatusCode != tt.statusCode {
+				t.Fatalf("status = %d, want %d (body %q)", resp.StatusCode, tt.statusCode, resp.Body)
+			}
+			if tt.statusCode != 200 {
+				return
+			}
+			var link mcapi.Link
+			if err := json.Unmarshal([]byte(resp.Body), &link); err != nil {
+				t.Fatalf("body %q: %v", resp.Body, err)
+			}
+			if link.Username != tt.want || link.CognitoUser != "alice" {
+				t.Errorf("link = %+v, want %s linked to alice", link, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+// Package getlogins returns login sessions from the login table.
+package getlogins
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"mcapi"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+// Query takes in list of usernames
+type Query struct {
+	Usernames []string `json:"Usernames"`
+}
+
+// NewQuery creates and returns new DynamoDbItem
+func NewQuery(body string) (*Query, error) {
+	fmt.Println("[NewQuery]", "body:", body)
+	var q Query
+	if body == "" {
+		fmt.Println("[NewQuery] No username filter provided")
+		q.Usernames = []string{"*"} // set single username of "*" to indicate no filter
+		return &q, nil
+	}
+	err := json.Unmarshal([]byte(body), &q)
+	if err != nil {
+		fmt.Println("[NewQuery]", err)
+		return nil, err
+	}
+	fmt.Println("[NewQuery]", "Created new Query")
+	fmt.Println("[NewQuery]", q)
+	return &q, nil
+}
+
+// DynamoDbItem is a login session returned by the query
+type DynamoDbItem = mcapi.DynamoDbItem
+
+// playerKeys returns the PKs the sessions of username are stored under: their
+// UUID, then their name for sessions recorded before players were keyed by
+// UUID. Players that cannot be resolved only have the latter.
+func playerKeys(resolver mcapi.Resolver, username string) []string {
+	profile, err := resolver.Resolve(username)
+	if err != nil {
+		fmt.Println("WARNING: could not resolve", username+", only finding sessions keyed by name:", err)
+		return []string{username}
+	}
+	return []string{profile.UUID, username}
+}
+
+// getUserLogins queries for the logins of a specific user
+func getUserLogins(tableName string, client dynamodbiface.DynamoDBAPI, resolver mcapi.Resolver, q *Query) ([]DynamoDbItem, error) {
+	var logins []DynamoDbItem
+	input := &dynamodb.QueryInput{
+		ScanIndexForward: aws.Bool(false),
+		TableName:        aws.String(tableName),
+	}
+	var keys []string
+	for _, s := range q.Usernames {
+		if s == "*" {
+			keys = append(keys, s)
+			continue
+		}
+		keys = append(keys, playerKeys(resolver, s)...)
+	}
+	for _, s := range keys {
+		if s != "*" {
+			// query username index of specific username
+			input.ExpressionAttributeValues = map[string]*dynamodb.AttributeValue{
+				":u": {
+					S: aws.String(s),
+				},
+			}
+			input.KeyConditionExpression = aws.String("PK = :u")
+			input.IndexName = aws.String("Username")
+		} else {
+			// query version indiex to just get all users (for current version)
+			input.ExpressionAttributeValues = map[string]*dynamodb.AttributeValue{
+				":v": {
+					S: aws.String(mcapi.LoginVersion),
+				},
+			}
+			input.KeyConditionExpression = aws.String("SK = :v")
+			input.IndexName = aws.String("Version")
+		}
+
+		// a player's history can run over the 1 MB a query returns at once
+		input.ExclusiveStartKey = nil
+		for {
+			fmt.Println("input:", input)
+			result, err := client.Query(input)
+			if err != nil {
+				fmt.Println("[getUserLogins]", err)
+				return logins, err
+			}
+			fmt.Println("result:", result)
+
+			// parse readmes
+			dbi, err := mcapi.UnmarshalLogins(result.Items)
+			if err != nil {
+				return logins, err
+			}
+			fmt.Println("logins:", dbi)
+			logins = append(logins, dbi...)
+			if len(result.LastEvaluatedKey) == 0 {
+				break
+			}
+			input.ExclusiveStartKey = result.LastEvaluatedKey
+		}
+	}
+
+	return logins, nil
+}
+
+// annotate fills in the website users who linked the players of logins.
+// Sessions are still worth returning without them, so failing to look the
+// links up is only logged.
+func (h *Handler) annotate(logins []DynamoDbItem) {
+	links, err := mcapi.GetLinks(h.Config, h.Clients.DynamoDB)
+	if err != nil {
+		fmt.Println("WARNING: could not look up linked accounts:", err)
+		return
+	}
+	byUUID, byName := map[string]string{}, map[string]string{}
+	for _, link := range links {
+		byUUID[link.UUID] = link.CognitoUser
+		byName[strings.ToLower(link.Username)] = link.CognitoUser
+	}
+	for i, l := range logins {
+		if l.UUID != "" {
+			logins[i].CognitoUser = byUUID[l.UUID]
+		} else {
+			logins[i].CognitoUser = byName[strings.ToLower(l.Username)]
+		}
+	}
+}
+
+// Handler returns login sessions using the injected AWS clients
+type Handler struct {
+	Config  *mcapi.Config
+	Clients *mcapi.Clients
+}
+
+// Handle is main entry point to lambda function
+func (h *Handler) Handle(ctx context.Context, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	respond := mcapi.NewResponder(h.Config, event)
+	fmt.Println("[Handler]", "Searching table ", h.Config.UserLoginTableName)
+
+	q, err := NewQuery(event.Body)
+	if err != nil {
+		return respond.Error(mcapi.InvalidRequest(err)), nil
+	}
+
+	logins, err := getUserLogins(h.Config.UserLoginTableName, h.Clients.DynamoDB, h.Clients.Resolver, q)
+	if err != nil {
+		return respond.Error(err), nil
+	}
+	h.annotate(logins)
+
+	// get stringified json to return
+	fmt.Println("logins:", logins)
+	return respond.OK(logins), nil
+}
@@ -0,0 +1,132 @@
+package getlogins
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"mcapi"
+	"mcapi/mcapitest"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+func TestHandle(t *testing.T) {
+	cfg := mcapitest.Config()
+	steve := "069a79f4-44e9-4726-a5be-fca90e38aaf5"
+	items := []DynamoDbItem{
+		// steve's sessions since they are keyed by UUID, then before
+		{PK: steve, SK: "v1", Username: "Steve", LoginTime: 400},
+		{PK: "steve", SK: "v1", LoginTime: 300},
+		{PK: "steve", SK: "100", LoginTime: 100, LogoutTime: 200},
+		{PK: "alex", SK: "v1", LoginTime: 250, LogoutTime: 280},
+	}
+	tests := []struct {
+		name       string
+		body       string
+		fail       error
+		statusCode int
+		want       []string // expected Username/LoginTime/CognitoUser, in order
+	}{
+		{
+			name:       "latest login of every user",
+			statusCode: 200,
+			want:       []string{"steve/300/alice", "alex/250/", "Steve/400/alice"},
+		},
+		{
+			name:       "every login of one user",
+			body:       `{"Usernames": ["steve"]}`,
+			statusCode: 200,
+			want:       []string{"Steve/400/alice", "steve/300/alice", "steve/100/alice"},
+		},
+		{
+			name:       "several users",
+			body:       `{"Usernames": ["alex", "steve"]}`,
+			statusCode: 200,
+			want:       []string{"alex/250/", "Steve/400/alice", "steve/300/alice", "steve/100/alice"},
+		},
+		{
+			name:       "renamed user",
+			body:       `{"Usernames": ["Steve_"]}`,
+			statusCode: 200,
+			want:       []string{"Steve/400/alice"},
+		},
+		{
+			name:       "user without a profile",
+			body:       `{"Usernames": ["Notch"]}`,
+			statusCode: 200,
+		},
+		{
+			name:       "unknown user",
+			body:       `{"Usernames": ["herobrine"]}`,
+			statusCode: 200,
+		},
+		{
+			name:       "malformed body",
+			body:       `{"Usernames": "steve"}`,
+			statusCode: 400,
+		},
+		{
+			name:       "query fails",
+			fail:       awserr.New("ProvisionedThroughputExceededException", "slow down", nil),
+			statusCode: 429,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := mcapitest.NewClients()
+			for _, i := range items {
+				av, err := dynamodbattribute.MarshalMap(i)
+				if err != nil {
+					t.Fatal(err)
+				}
+				c.DynamoDB.Put(cfg.UserLoginTableName, av)
+			}
+			// alice linked steve's account
+			code, err := mcapi.CreateLinkCode(cfg, c.DynamoDB, "sub-alice", "alice", time.Now())
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = mcapi.RedeemLinkCode(cfg, c.DynamoDB, code.Code, "069a79f4-44e9-4726-a5be-fca90e38aaf5", "Steve", time.Now())
+			if err != nil {
+				t.Fatal(err)
+			}
+			c.Resolver.SetProfile("Steve", steve)
+			c.Resolver.SetProfile("Steve_", steve)
+			c.Resolver.SetProfile("Notch", "")
+			c.DynamoDB.Fail("Query", tt.fail)
+			// every query takes several pages
+			c.DynamoDB.PageSize = 1
+			h := &Handler{Config: cfg, Clients: c.Clients()}
+
+			resp, err := h.Handle(context.Background(), events.APIGatewayProxyRequest{Body: tt.body})
+			if err != nil {
+				t.Fatalf("Handle returned error: %v", err)
+			}
+			if resp.StatusCode != tt.statusCode {
+				t.Fatalf("status = %d, want %d (body %q)", resp.StatusCode, tt.statusCode, resp.Body)
+			}
+			if tt.statusCode != 200 {
+				return
+			}
+
+			var logins []DynamoDbItem
+			if err := json.Unmarshal([]byte(resp.Body), &logins); err != nil {
+				t.Fatalf("body %q: %v", resp.Body, err)
+			}
+			var got []string
+			for _, l := range logins {
+				got = append(got, l.Username+"/"+strconv.Itoa(int(l.LoginTime))+"/"+l.CognitoUser)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("logins = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
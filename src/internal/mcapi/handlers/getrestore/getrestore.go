@@ -0,0 +1,32 @@
+// Package getrestore reports how a restore of a backup is going.
+package getrestore
+
+import (
+	"fmt"
+
+	"mcapi"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// Handler reports restores kept in the injected state store
+type Handler struct {
+	Config *mcapi.Config
+	State  mcapi.StateStore
+}
+
+// Handle is main entry point to lambda function. The restore ID is the {id}
+// path parameter.
+func (h *Handler) Handle(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	respond := mcapi.NewResponder(h.Config, request)
+	id := request.PathParameters["id"]
+	if id == "" {
+		return respond.Error(mcapi.NewError(mcapi.CodeInvalidRequest, "missing restore id")), nil
+	}
+	restore, err := mcapi.GetRestore(h.Config, h.State, id)
+	if err != nil {
+		return respond.Error(err), nil
+	}
+	fmt.Println("restore:", restore.ID, restore.Status)
+	return respond.OK(restore), nil
+}
@@ -0,0 +1,55 @@
+package getrestore
+
+import (
+	"encoding/json"
+	"testing"
+
+	"mcapi"
+	"mcapi/mcapitest"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestHandle(t *testing.T) {
+	cfg := mcapitest.Config()
+	tests := []struct {
+		name       string
+		id         string
+		stored     *mcapi.Restore
+		statusCode int
+	}{
+		{name: "latest restore", id: "req-1", stored: &mcapi.Restore{ID: "req-1", Status: mcapi.RestoreRestoring, SnapshotID: "snap-1"}, statusCode: 200},
+		{name: "missing id", statusCode: 400},
+		{name: "nothing restored", id: "req-1", statusCode: 404},
+		{name: "replaced by a later restore", id: "req-1", stored: &mcapi.Restore{ID: "req-2", Status: mcapi.RestoreRestored}, statusCode: 404},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := mcapi.NewMemoryStateStore()
+			if tt.stored != nil {
+				if err := mcapi.PutRestore(cfg, store, *tt.stored); err != nil {
+					t.Fatal(err)
+				}
+			}
+			h := &Handler{Config: cfg, State: store}
+
+			resp, err := h.Handle(events.APIGatewayProxyRequest{PathParameters: map[string]string{"id": tt.id}})
+			if err != nil {
+				t.Fatalf("Handle returned error: %v", err)
+			}
+			if resp.StatusCode != tt.statusCode {
+				t.Fatalf("status = %d, want %d (body %q)", resp.StatusCode, tt.statusCode, resp.Body)
+			}
+			if tt.statusCode != 200 {
+				return
+			}
+			var restore mcapi.Restore
+			if err := json.Unmarshal([]byte(resp.Body), &restore); err != nil {
+				t.Fatalf("body %q: %v", resp.Body, err)
+			}
+			if restore != *tt.stored {
+				t.Errorf("restore = %+v, want %+v", restore, *tt.stored)
+			}
+		})
+	}
+}
@@ -0,0 +1,196 @@
+// Package getserverstatus reports the status of the minecraft server.
+package getserverstatus
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"mcapi"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// Status describes the server: the EC2 instance, the minecraft service on it
+// and who is playing
+type Status struct {
+	InstanceState string `json:"instanceState"`
+	// SystemStatus and InstanceStatus are the results of the EC2 status
+	// checks: ok, impaired, initializing, insufficient-data or not-applicable
+	SystemStatus   string `json:"systemStatus"`
+	InstanceStatus string `json:"instanceStatus"`
+	// ServiceStatus is the status the minecraft service reported through
+	// /markServerStarted, empty until it has
+	ServiceStatus string `json:"serviceStatus"`
+	PublicIP      string `json:"publicIp,omitempty"`
+	PublicDNS     string `json:"publicDns,omitempty"`
+	// LaunchTime is the unix timestamp the instance was last started at
+	LaunchTime    int64 `json:"launchTime,omitempty"`
+	UptimeSeconds int64 `json:"uptimeSeconds"`
+	// PlayersOnline is null if the login table could not be read
+	PlayersOnline *int `json:"playersOnline"`
+	// Ping is what the server answered the Server List Ping with, null if it
+	// was not pinged or did not answer
+	Ping *mcapi.PingResult `json:"ping"`
+	// PingError is why the ping failed
+	PingError string `json:"pingError,omitempty"`
+}
+
+// LegacyBody implements mcapi.Legacy, returning the single status the website
+// was built against: running once the service is up, pending while the
+// instance runs without it, and the instance state otherwise. The service is
+// up once it has reported in or answers pings.
+func (s Status) LegacyBody() string {
+	if s.InstanceState != ec2.InstanceStateNameRunning {
+		return s.InstanceState
+	}
+	if s.ServiceStatus == "" && s.Ping == nil {
+		return "pending"
+	}
+	return "running"
+}
+
+// Handler reports the minecraft server status using the injected AWS clients
+type Handler struct {
+	Config  *mcapi.Config
+	Clients *mcapi.Clients
+	State   mcapi.StateStore
+}
+
+// getServiceStatus returns the status of the actual minecraft service ON the
+// server, or "" if it has not reported one
+func (h *Handler) getServiceStatus() (string, error) {
+	status, err := h.State.Get(h.Config.ServerStatusKeyName)
+	if errors.Is(err, mcapi.ErrStateNotFound) {
+		return "", nil
+	}
+	return status, err
+}
+
+// describeInstance fills in the public address and launch time of the
+// instance
+func (h *Handler) describeInstance(status *Status, now time.Time) error {
+	result, err := h.Clients.EC2.DescribeInstances(&ec2.DescribeInstancesInput{
+		InstanceIds: []*string{aws.String(h.Config.ServerID)},
+	})
+	if err != nil {
+		return err
+	}
+	for _, r := range result.Reservations {
+		for _, i := range r.Instances {
+			status.PublicIP = aws.StringValue(i.PublicIpAddress)
+			status.PublicDNS = aws.StringValue(i.PublicDnsName)
+			if i.LaunchTime != nil {
+				status.LaunchTime = i.LaunchTime.Unix()
+				if status.InstanceState == ec2.InstanceStateNameRunning {
+					status.UptimeSeconds = int64(now.Sub(*i.LaunchTime).Seconds())
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// pingAddress returns the host:port to ping the server at, or "" if it has no
+// address
+func (h *Handler) pingAddress(status *Status) string {
+	host := h.Config.ServerAddress
+	if host == "" {
+		host = status.PublicIP
+	}
+	if host == "" {
+		return ""
+	}
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+	return net.JoinHostPort(host, strconv.Itoa(h.Config.ServerPort))
+}
+
+// ping fills in the server's answer to the Server List Ping, or why there was
+// none
+func (h *Handler) ping(status *Status) {
+	address := h.pingAddress(status)
+	if address == "" {
+		status.PingError = "no address to ping"
+		return
+	}
+	result, err := h.Clients.Pinger.Ping(address)
+	if err != nil {
+		fmt.Println("ping of", address, "failed:", err)
+		status.PingError = err.Error()
+		return
+	}
+	fmt.Println("ping:", result)
+	status.Ping = &result
+}
+
+// Handle is main entry point to lambda function
+func (h *Handler) Handle(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	respond := mcapi.NewResponder(h.Config, request)
+	fmt.Println("Retrieving instance", h.Config.ServerID, "...")
+	input := &ec2.DescribeInstanceStatusInput{
+		InstanceIds: []*string{
+			aws.String(h.Config.ServerID),
+		},
+		IncludeAllInstances: aws.Bool(true),
+	}
+	result, err := h.Clients.EC2.DescribeInstanceStatus(input)
+	if err != nil {
+		err = fmt.Errorf("error retrieving instance status: %w", err)
+		return respond.Error(err), nil
+	}
+	if len(result.InstanceStatuses) < 1 {
+		err = mcapi.NewError(mcapi.CodeNotFound, "Could not find instance with ID %s", h.Config.ServerID)
+		return respond.Error(err), nil
+	}
+
+	// get state of the server itself
+	fmt.Println("status:", result.InstanceStatuses)
+	instance := result.InstanceStatuses[0]
+	status := Status{InstanceState: aws.StringValue(instance.InstanceState.Name)}
+	if instance.SystemStatus != nil {
+		status.SystemStatus = aws.StringValue(instance.SystemStatus.Status)
+	}
+	if instance.InstanceStatus != nil {
+		status.InstanceStatus = aws.StringValue(instance.InstanceStatus.Status)
+	}
+	zero := 0
+	status.PlayersOnline = &zero
+	if status.InstanceState != ec2.InstanceStateNameRunning && status.InstanceState != ec2.InstanceStateNamePending {
+		fmt.Println("instance state:", status.InstanceState)
+		return respond.OK(status), nil
+	}
+
+	err = h.describeInstance(&status, time.Now())
+	if err != nil {
+		return respond.Error(err), nil
+	}
+	if status.InstanceState == ec2.InstanceStateNamePending {
+		return respond.OK(status), nil
+	}
+
+	// the server is on, so get state of the minecraft service ON the server
+	status.ServiceStatus, err = h.getServiceStatus()
+	if err != nil {
+		return respond.Error(err), nil
+	}
+	fmt.Println("service status:", status.ServiceStatus)
+	h.ping(&status)
+
+	// a status without the player count beats no status at all
+	players, err := mcapi.OnlinePlayers(h.Config, h.Clients.DynamoDB)
+	if err != nil {
+		fmt.Println("WARNING: could not count online players:", err)
+		status.PlayersOnline = nil
+	} else {
+		online := len(players)
+		status.PlayersOnline = &online
+	}
+	return respond.OK(status), nil
+}
@@ -0,0 +1,258 @@
+package getserverstatus
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"mcapi"
+	"mcapi/mcapitest"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+func TestHandle(t *testing.T) {
+	cfg := mcapitest.Config()
+	tests := []struct {
+		name       string
+		state      string
+		service    string
+		ping       bool
+		fail       error
+		statusCode int
+		body       string
+	}{
+		{name: "stopped", state: "stopped", statusCode: 200, body: "stopped"},
+		{name: "stopping", state: "stopping", statusCode: 200, body: "stopping"},
+		{name: "booting", state: "pending", statusCode: 200, body: "pending"},
+		{name: "running without service", state: "running", statusCode: 200, body: "pending"},
+		{name: "running with service", state: "running", service: "started", statusCode: 200, body: "running"},
+		{name: "running with stopped service", state: "running", service: "stopped", statusCode: 200, body: "running"},
+		{name: "running and answering pings", state: "running", ping: true, statusCode: 200, body: "running"},
+		{name: "unknown instance", statusCode: 404, body: "Could not find instance"},
+		{
+			name:       "describe fails",
+			state:      "running",
+			fail:       awserr.New("UnauthorizedOperation", "denied", nil),
+			statusCode: 403,
+			body:       "error retrieving instance status: UnauthorizedOperation",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := mcapitest.NewClients()
+			if tt.state != "" {
+				c.EC2.SetState(cfg.ServerID, tt.state)
+			}
+			if tt.service != "" {
+				c.SSM.Set(cfg.ServerStatusKeyName, tt.service)
+			}
+			c.EC2.SetAddress(cfg.ServerID, "203.0.113.7", "")
+			if tt.ping {
+				c.Pinger.SetResult(&mcapi.PingResult{Version: "1.20.1"})
+			}
+			c.EC2.Fail("DescribeInstanceStatus", tt.fail)
+			h := &Handler{Config: cfg, Clients: c.Clients(), State: mcapi.NewSSMStateStore(cfg, c.SSM)}
+
+			resp, err := h.Handle(events.APIGatewayProxyRequest{})
+			if err != nil {
+				t.Fatalf("Handle returned error: %v", err)
+			}
+			if resp.StatusCode != tt.statusCode {
+				t.Errorf("status = %d, want %d (body %q)", resp.StatusCode, tt.statusCode, resp.Body)
+			}
+			if !strings.HasPrefix(resp.Body, tt.body) {
+				t.Errorf("body = %q, want prefix %q", resp.Body, tt.body)
+			}
+		})
+	}
+}
+
+func TestHandleDetails(t *testing.T) {
+	launched := time.Now().Add(-time.Hour)
+	online := func(n int) *int { return &n }
+	pong := &mcapi.PingResult{Version: "1.20.1", Protocol: 763, MOTD: "A Minecraft Server", PlayersOnline: 1, PlayersMax: 20, LatencyMs: 12}
+	refused := "dial tcp 203.0.113.7:25565: connect: connection refused"
+	tests := []struct {
+		name    string
+		state   string
+		service string
+		checks  []string
+		address string
+		ping    *mcapi.PingResult
+		fail    map[string]error
+		want    Status
+		pinged  string
+		err     mcapi.ErrorCode
+	}{
+		{
+			name:  "stopped",
+			state: "stopped",
+			want:  Status{InstanceState: "stopped", SystemStatus: "not-applicable", InstanceStatus: "not-applicable", PlayersOnline: online(0)},
+		},
+		{
+			name:   "booting",
+			state:  "pending",
+			checks: []string{"initializing", "initializing"},
+			want: Status{
+				InstanceState: "pending", SystemStatus: "initializing", InstanceStatus: "initializing",
+				LaunchTime: launched.Unix(), PlayersOnline: online(0),
+			},
+		},
+		{
+			name:    "running",
+			state:   "running",
+			service: "started",
+			ping:    pong,
+			want: Status{
+				InstanceState: "running", SystemStatus: "ok", InstanceStatus: "ok", ServiceStatus: "started",
+				PublicIP: "203.0.113.7", PublicDNS: "ec2-203-0-113-7.compute-1.amazonaws.com",
+				LaunchTime: launched.Unix(), UptimeSeconds: 3600, PlayersOnline: online(1), Ping: pong,
+			},
+			pinged: "203.0.113.7:25565",
+		},
+		{
+			name:    "service not answering",
+			state:   "running",
+			service: "started",
+			want: Status{
+				InstanceState: "running", SystemStatus: "ok", InstanceStatus: "ok", ServiceStatus: "started",
+				PublicIP: "203.0.113.7", PublicDNS: "ec2-203-0-113-7.compute-1.amazonaws.com",
+				LaunchTime: launched.Unix(), UptimeSeconds: 3600, PlayersOnline: online(1), PingError: refused,
+			},
+			pinged: "203.0.113.7:25565",
+		},
+		{
+			name:    "configured address",
+			state:   "running",
+			address: "mc.example.com",
+			ping:    pong,
+			want: Status{
+				InstanceState: "running", SystemStatus: "ok", InstanceStatus: "ok",
+				PublicIP: "203.0.113.7", PublicDNS: "ec2-203-0-113-7.compute-1.amazonaws.com",
+				LaunchTime: launched.Unix(), UptimeSeconds: 3600, PlayersOnline: online(1), Ping: pong,
+			},
+			pinged: "mc.example.com:25565",
+		},
+		{
+			name:    "configured address and port",
+			state:   "running",
+			address: "mc.example.com:25570",
+			ping:    pong,
+			want: Status{
+				InstanceState: "running", SystemStatus: "ok", InstanceStatus: "ok",
+				PublicIP: "203.0.113.7", PublicDNS: "ec2-203-0-113-7.compute-1.amazonaws.com",
+				LaunchTime: launched.Unix(), UptimeSeconds: 3600, PlayersOnline: online(1), Ping: pong,
+			},
+			pinged: "mc.example.com:25570",
+		},
+		{
+			name:    "failing status checks",
+			state:   "running",
+			service: "started",
+			checks:  []string{"ok", "impaired"},
+			want: Status{
+				InstanceState: "running", SystemStatus: "ok", InstanceStatus: "impaired", ServiceStatus: "started",
+				PublicIP: "203.0.113.7", PublicDNS: "ec2-203-0-113-7.compute-1.amazonaws.com",
+				LaunchTime: launched.Unix(), UptimeSeconds: 3600, PlayersOnline: online(1), PingError: refused,
+			},
+		},
+		{
+			name:    "login table unreadable",
+			state:   "running",
+			service: "started",
+			fail:    map[string]error{"Query": awserr.New("AccessDeniedException", "denied", nil)},
+			want: Status{
+				InstanceState: "running", SystemStatus: "ok", InstanceStatus: "ok", ServiceStatus: "started",
+				PublicIP: "203.0.113.7", PublicDNS: "ec2-203-0-113-7.compute-1.amazonaws.com",
+				LaunchTime: launched.Unix(), UptimeSeconds: 3600, PingError: refused,
+			},
+		},
+		{
+			name:  "service status unreadable",
+			state: "running",
+			fail:  map[string]error{"GetParameter": awserr.New("ThrottlingException", "slow down", nil)},
+			err:   mcapi.CodeThrottled,
+		},
+		{
+			name:  "instance unreadable",
+			state: "running",
+			fail:  map[string]error{"DescribeInstances": awserr.New("UnauthorizedOperation", "denied", nil)},
+			err:   mcapi.CodeForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := mcapitest.Config()
+			cfg.ServerAddress = tt.address
+			c := mcapitest.NewClients()
+			c.Pinger.SetResult(tt.ping)
+			c.EC2.SetState(cfg.ServerID, tt.state)
+			c.EC2.SetLaunchTime(cfg.ServerID, launched)
+			c.EC2.SetAddress(cfg.ServerID, "203.0.113.7", "ec2-203-0-113-7.compute-1.amazonaws.com")
+			if tt.checks != nil {
+				c.EC2.SetChecks(cfg.ServerID, tt.checks[0], tt.checks[1])
+			}
+			if tt.service != "" {
+				c.SSM.Set(cfg.ServerStatusKeyName, tt.service)
+			}
+			for _, i := range []mcapi.DynamoDbItem{
+				{PK: "steve", SK: "v1", LoginTime: 300},
+				{PK: "alex", SK: "v1", LoginTime: 250, LogoutTime: 280},
+			} {
+				av, _ := dynamodbattribute.MarshalMap(i)
+				c.DynamoDB.Put(cfg.UserLoginTableName, av)
+			}
+			for op, err := range tt.fail {
+				c.EC2.Fail(op, err)
+				c.SSM.Fail(op, err)
+				c.DynamoDB.Fail(op, err)
+			}
+			h := &Handler{Config: cfg, Clients: c.Clients(), State: mcapi.NewSSMStateStore(cfg, c.SSM)}
+
+			resp, err := h.Handle(events.APIGatewayProxyRequest{QueryStringParameters: map[string]string{"format": "envelope"}})
+			if err != nil {
+				t.Fatalf("Handle returned error: %v", err)
+			}
+			var envelope struct {
+				Data  Status
+				Error *mcapi.APIError
+			}
+			if err := json.Unmarshal([]byte(resp.Body), &envelope); err != nil {
+				t.Fatalf("body %q: %v", resp.Body, err)
+			}
+			if tt.err != "" {
+				if envelope.Error == nil || envelope.Error.Code != tt.err {
+					t.Fatalf("body = %q, want a %s error", resp.Body, tt.err)
+				}
+				return
+			}
+			got := envelope.Data
+			// allow for the clock moving on during the test
+			if d := got.UptimeSeconds - tt.want.UptimeSeconds; d >= 0 && d < 2 {
+				got.UptimeSeconds = tt.want.UptimeSeconds
+			}
+			if (got.PlayersOnline == nil) != (tt.want.PlayersOnline == nil) ||
+				got.PlayersOnline != nil && *got.PlayersOnline != *tt.want.PlayersOnline {
+				t.Errorf("playersOnline = %v, want %v", got.PlayersOnline, tt.want.PlayersOnline)
+			}
+			if (got.Ping == nil) != (tt.want.Ping == nil) || got.Ping != nil && *got.Ping != *tt.want.Ping {
+				t.Errorf("ping = %+v, want %+v", got.Ping, tt.want.Ping)
+			}
+			got.PlayersOnline, tt.want.PlayersOnline = nil, nil
+			got.Ping, tt.want.Ping = nil, nil
+			if got != tt.want {
+				t.Errorf("status = %+v, want %+v", got, tt.want)
+			}
+			pinged := c.Pinger.Pinged()
+			if tt.pinged != "" && (len(pinged) != 1 || pinged[0] != tt.pinged) {
+				t.Errorf("pinged %v, want %q", pinged, tt.pinged)
+			}
+		})
+	}
+}
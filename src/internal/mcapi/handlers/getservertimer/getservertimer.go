@@ -0,0 +1,82 @@
+// Package getservertimer reports the current session of the minecraft server:
+// when it stops, how long is left and whether the auto-stop is armed.
+package getservertimer
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"mcapi"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// Timer describes the current session. Active is false, and everything else
+// empty, when there is no session.
+type Timer struct {
+	Active bool `json:"active"`
+	// StopTime is the unix timestamp the server stops at
+	StopTime         int64 `json:"stopTime,omitempty"`
+	SecondsRemaining int64 `json:"secondsRemaining"`
+	// StartTime is the unix timestamp the session started at, unset for
+	// sessions started before it was tracked
+	StartTime  int64 `json:"startTime,omitempty"`
+	Extensions int   `json:"extensions"`
+	// StartedBy is the website user who started the session, with their
+	// linked account
+	StartedBy *mcapi.Actor `json:"startedBy,omitempty"`
+	// AutoStopArmed is true if the scheduled stop will actually fire
+	AutoStopArmed bool `json:"autoStopArmed"`
+}
+
+// LegacyBody implements mcapi.Legacy, returning the raw stop time the website
+// was built against
+func (t Timer) LegacyBody() string {
+	if !t.Active {
+		return "No active session"
+	}
+	return strconv.FormatInt(t.StopTime, 10)
+}
+
+// Handler returns the server stop timer using the injected AWS clients
+type Handler struct {
+	Config  *mcapi.Config
+	Clients *mcapi.Clients
+	State   mcapi.StateStore
+}
+
+// Handle is main entry point to lambda function
+func (h *Handler) Handle(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	respond := mcapi.NewResponder(h.Config, request)
+	fmt.Println("keyName:", h.Config.TimerKeyName)
+	stopTime, err := mcapi.GetStopTime(h.Config, h.State)
+	if errors.Is(err, mcapi.ErrStateNotFound) {
+		fmt.Println("No active session")
+		return respond.OK(Timer{}), nil
+	}
+	if err != nil {
+		return respond.Error(err), nil
+	}
+
+	timer := Timer{Active: true, StopTime: stopTime.Unix()}
+	if remaining := int64(time.Until(stopTime).Seconds()); remaining > 0 {
+		timer.SecondsRemaining = remaining
+	}
+
+	session, err := mcapi.GetSession(h.Config, h.State)
+	if err != nil && !errors.Is(err, mcapi.ErrStateNotFound) {
+		return respond.Error(err), nil
+	}
+	timer.StartTime = session.StartTime
+	timer.Extensions = session.Extensions
+	timer.StartedBy = session.StartedBy
+
+	_, timer.AutoStopArmed, err = h.Clients.Scheduler.Scheduled()
+	if err != nil {
+		return respond.Error(err), nil
+	}
+
+	return respond.OK(timer), nil
+}
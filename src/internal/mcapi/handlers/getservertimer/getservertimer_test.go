@@ -0,0 +1,119 @@
+package getservertimer
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+
+	"mcapi"
+	"mcapi/mcapitest"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+func TestHandle(t *testing.T) {
+	cfg := mcapitest.Config()
+	now := time.Now().Unix()
+	tests := []struct {
+		name       string
+		timer      string
+		session    string
+		setup      func(c *mcapitest.Clients)
+		statusCode int
+		legacy     string
+		want       Timer
+	}{
+		{
+			name:       "no active session",
+			statusCode: 200,
+			legacy:     "No active session",
+			want:       Timer{},
+		},
+		{
+			name:       "active session",
+			timer:      strconv.FormatInt(now+600, 10),
+			session:    `{"startTime": 1000, "extensions": 2}`,
+			setup:      func(c *mcapitest.Clients) { c.Scheduler.Schedule(time.Unix(now+600, 0)) },
+			statusCode: 200,
+			legacy:     strconv.FormatInt(now+600, 10),
+			want:       Timer{Active: true, StopTime: now + 600, SecondsRemaining: 600, StartTime: 1000, Extensions: 2, AutoStopArmed: true},
+		},
+		{
+			name:       "session started before it was tracked",
+			timer:      strconv.FormatInt(now+600, 10),
+			statusCode: 200,
+			legacy:     strconv.FormatInt(now+600, 10),
+			want:       Timer{Active: true, StopTime: now + 600, SecondsRemaining: 600},
+		},
+		{
+			name:       "overdue without scheduled stop",
+			timer:      strconv.FormatInt(now-60, 10),
+			statusCode: 200,
+			legacy:     strconv.FormatInt(now-60, 10),
+			want:       Timer{Active: true, StopTime: now - 60},
+		},
+		{
+			name:       "invalid timer",
+			timer:      "soon",
+			statusCode: 500,
+			legacy:     `invalid stop time "soon": strconv.ParseInt: parsing "soon": invalid syntax`,
+		},
+		{
+			name:  "scheduler fails",
+			timer: strconv.FormatInt(now+600, 10),
+			setup: func(c *mcapitest.Clients) {
+				c.Scheduler.Fail("Scheduled", awserr.New("AccessDeniedException", "denied", nil))
+			},
+			statusCode: 403,
+			legacy:     "AccessDeniedException: denied",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := mcapitest.NewClients()
+			if tt.timer != "" {
+				c.SSM.Set(cfg.TimerKeyName, tt.timer)
+			}
+			if tt.session != "" {
+				c.SSM.Set(cfg.SessionKeyName, tt.session)
+			}
+			if tt.setup != nil {
+				tt.setup(c)
+			}
+			h := &Handler{Config: cfg, Clients: c.Clients(), State: mcapi.NewSSMStateStore(cfg, c.SSM)}
+
+			resp, err := h.Handle(events.APIGatewayProxyRequest{})
+			if err != nil {
+				t.Fatalf("Handle returned error: %v", err)
+			}
+			if resp.StatusCode != tt.statusCode || resp.Body != tt.legacy {
+				t.Errorf("legacy = %d %q, want %d %q", resp.StatusCode, resp.Body, tt.statusCode, tt.legacy)
+			}
+			if tt.statusCode != 200 {
+				return
+			}
+
+			resp, err = h.Handle(events.APIGatewayProxyRequest{QueryStringParameters: map[string]string{"format": "envelope"}})
+			if err != nil {
+				t.Fatalf("Handle returned error: %v", err)
+			}
+			var envelope struct {
+				Data Timer `json:"data"`
+			}
+			if err := json.Unmarshal([]byte(resp.Body), &envelope); err != nil {
+				t.Fatalf("envelope %q: %v", resp.Body, err)
+			}
+			got := envelope.Data
+			// allow for the clock ticking over during the test
+			if d := tt.want.SecondsRemaining - got.SecondsRemaining; d >= 0 && d <= 2 {
+				got.SecondsRemaining = tt.want.SecondsRemaining
+			}
+			if got != tt.want {
+				t.Errorf("timer = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
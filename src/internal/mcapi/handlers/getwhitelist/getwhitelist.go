@@ -0,0 +1,28 @@
+// Package getwhitelist lists the players whitelisted on the minecraft server.
+package getwhitelist
+
+import (
+	"fmt"
+
+	"mcapi"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// Handler lists the whitelist using the injected AWS clients
+type Handler struct {
+	Config  *mcapi.Config
+	Clients *mcapi.Clients
+}
+
+// Handle is main entry point to lambda function
+func (h *Handler) Handle(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	respond := mcapi.NewResponder(h.Config, request)
+	fmt.Println("Listing whitelist in", h.Config.UserLoginTableName, "...")
+	entries, err := mcapi.GetWhitelist(h.Config, h.Clients.DynamoDB)
+	if err != nil {
+		return respond.Error(err), nil
+	}
+	fmt.Println("whitelisted:", len(entries))
+	return respond.OK(entries), nil
+}
@@ -0,0 +1,58 @@
+package getwhitelist
+
+import (
+	"encoding/json"
+	"testing"
+
+	"mcapi"
+	"mcapi/mcapitest"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+func TestHandle(t *testing.T) {
+	cfg := mcapitest.Config()
+	tests := []struct {
+		name       string
+		entries    []string
+		fail       error
+		statusCode int
+		body       string
+	}{
+		{name: "sorted by name", entries: []string{"steve", "Alex"}, statusCode: 200},
+		{name: "empty", statusCode: 200, body: "[]"},
+		{name: "listing fails", fail: awserr.New("AccessDeniedException", "denied", nil), statusCode: 403},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := mcapitest.NewClients()
+			for _, name := range tt.entries {
+				mcapi.PutWhitelistEntry(cfg, c.DynamoDB, mcapi.WhitelistEntry{Username: name})
+			}
+			c.DynamoDB.Fail("Query", tt.fail)
+			h := &Handler{Config: cfg, Clients: c.Clients()}
+
+			resp, err := h.Handle(events.APIGatewayProxyRequest{})
+			if err != nil {
+				t.Fatalf("Handle returned error: %v", err)
+			}
+			if resp.StatusCode != tt.statusCode {
+				t.Fatalf("status = %d, want %d (body %q)", resp.StatusCode, tt.statusCode, resp.Body)
+			}
+			if tt.statusCode != 200 {
+				return
+			}
+			if tt.body != "" && resp.Body != tt.body {
+				t.Errorf("body = %q, want %q", resp.Body, tt.body)
+			}
+			var entries []mcapi.WhitelistEntry
+			if err := json.Unmarshal([]byte(resp.Body), &entries); err != nil {
+				t.Fatalf("body %q: %v", resp.Body, err)
+			}
+			if len(entries) != len(tt.entries) || (len(entries) == 2 && entries[0].Username != "Alex") {
+				t.Errorf("entries = %+v, want Alex then steve", entries)
+			}
+		})
+	}
+}
@@ -0,0 +1,31 @@
+// Package logoutusers closes every open login session in the login table,
+// mainly when the server shuts down.
+package logoutusers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"mcapi"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// Handler closes open login sessions using the injected AWS clients
+type Handler struct {
+	Config  *mcapi.Config
+	Clients *mcapi.Clients
+}
+
+// Handle is the main function for lambda
+func (h *Handler) Handle(ctx context.Context, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	respond := mcapi.NewResponder(h.Config, event)
+	fmt.Println("[Handler]", "Server stopping... marking any logged in users as logged out")
+
+	closed, err := mcapi.CloseOpenSessions(h.Config, h.Clients.DynamoDB, time.Now(), mcapi.LogoutShutdown)
+	if err != nil {
+		return respond.Error(err), nil
+	}
+	return respond.OK(closed), nil
+}
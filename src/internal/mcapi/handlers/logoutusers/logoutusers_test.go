@@ -0,0 +1,192 @@
+package logoutusers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"mcapi"
+	"mcapi/mcapitest"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// racingDynamoDB logs a user out right after the logins are read, as if they
+// left the game while the sessions were being closed
+type racingDynamoDB struct {
+	*mcapitest.FakeDynamoDB
+	table string
+	user  mcapi.DynamoDbItem
+}
+
+func (r *racingDynamoDB) Query(input *dynamodb.QueryInput) (*dynamodb.QueryOutput, error) {
+	output, err := r.FakeDynamoDB.Query(input)
+	av, _ := dynamodbattribute.MarshalMap(r.user)
+	r.Put(r.table, av)
+	return output, err
+}
+
+func TestHandle(t *testing.T) {
+	cfg := mcapitest.Config()
+	var many []mcapi.DynamoDbItem
+	for n := 0; n < 30; n++ {
+		many = append(many, mcapi.DynamoDbItem{PK: fmt.Sprintf("player%02d", n), SK: "v1", LoginTime: 300})
+	}
+	tests := []struct {
+		name       string
+		items      []mcapi.DynamoDbItem
+		race       *mcapi.DynamoDbItem
+		fail       map[string]error
+		statusCode int
+		closed     []string
+	}{
+		{
+			name: "closes open sessions",
+			items: []mcapi.DynamoDbItem{
+				{PK: "steve", SK: "v1", LoginTime: 300},
+				{PK: "alex", SK: "v1", LoginTime: 250, LogoutTime: 280},
+				{PK: "notch", SK: "v1", LoginTime: 400, LogoutTime: 280},
+				{PK: "notch", SK: "280", LoginTime: 200, LogoutTime: 280},
+			},
+			statusCode: 200,
+			closed:     []string{"notch", "steve"},
+		},
+		{
+			name:       "nobody logged in",
+			items:      []mcapi.DynamoDbItem{{PK: "alex", SK: "v1", LoginTime: 250, LogoutTime: 280}},
+			statusCode: 200,
+		},
+		{
+			name:       "more sessions than a transaction holds",
+			items:      many,
+			statusCode: 200,
+			closed: func() []string {
+				var names []string
+				for _, i := range many {
+					names = append(names, i.PK)
+				}
+				return names
+			}(),
+		},
+		{
+			name: "user logged out meanwhile",
+			items: []mcapi.DynamoDbItem{
+				{PK: "steve", SK: "v1", LoginTime: 300},
+				{PK: "alex", SK: "v1", LoginTime: 250},
+			},
+			race:       &mcapi.DynamoDbItem{PK: "alex", SK: "v1", LoginTime: 250, LogoutTime: 350},
+			statusCode: 200,
+			closed:     []string{"steve"},
+		},
+		{
+			name:       "query fails",
+			fail:       map[string]error{"Query": awserr.New("ProvisionedThroughputExceededException", "slow down", nil)},
+			statusCode: 429,
+		},
+		{
+			name:  "transaction throttled",
+			items: []mcapi.DynamoDbItem{{PK: "steve", SK: "v1", LoginTime: 300}, {PK: "alex", SK: "v1", LoginTime: 250}},
+			fail: map[string]error{"TransactWriteItems": &dynamodb.TransactionCanceledException{
+				Message_: aws.String("Transaction cancelled"),
+				CancellationReasons: []*dynamodb.CancellationReason{
+					{Code: aws.String("None")},
+					{Code: aws.String("ThrottlingError"), Message: aws.String("Throughput exceeds the current capacity")},
+				},
+			}},
+			statusCode: 429,
+		},
+		{
+			name:  "transaction conflicts",
+			items: []mcapi.DynamoDbItem{{PK: "steve", SK: "v1", LoginTime: 300}},
+			fail: map[string]error{"TransactWriteItems": &dynamodb.TransactionCanceledException{
+				Message_:            aws.String("Transaction cancelled"),
+				CancellationReasons: []*dynamodb.CancellationReason{{Code: aws.String("TransactionConflict")}},
+			}},
+			statusCode: 409,
+		},
+		{
+			name:       "transaction fails",
+			items:      []mcapi.DynamoDbItem{{PK: "steve", SK: "v1", LoginTime: 300}},
+			fail:       map[string]error{"TransactWriteItems": awserr.New("AccessDeniedException", "denied", nil)},
+			statusCode: 403,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := mcapitest.NewClients()
+			for _, i := range tt.items {
+				av, err := dynamodbattribute.MarshalMap(i)
+				if err != nil {
+					t.Fatal(err)
+				}
+				c.DynamoDB.Put(cfg.UserLoginTableName, av)
+			}
+			for op, err := range tt.fail {
+				c.DynamoDB.Fail(op, err)
+			}
+			h := &Handler{Config: cfg, Clients: c.Clients()}
+			if tt.race != nil {
+				h.Clients.DynamoDB = &racingDynamoDB{FakeDynamoDB: c.DynamoDB, table: cfg.UserLoginTableName, user: *tt.race}
+			}
+
+			resp, err := h.Handle(context.Background(), events.APIGatewayProxyRequest{})
+			if err != nil {
+				t.Fatalf("Handle returned error: %v", err)
+			}
+			if resp.StatusCode != tt.statusCode {
+				t.Fatalf("status = %d, want %d (body %q)", resp.StatusCode, tt.statusCode, resp.Body)
+			}
+			if tt.statusCode != 200 {
+				return
+			}
+
+			var closed []mcapi.DynamoDbItem
+			if err := json.Unmarshal([]byte(resp.Body), &closed); err != nil {
+				t.Fatalf("body %q: %v", resp.Body, err)
+			}
+			var got []string
+			for _, s := range closed {
+				got = append(got, s.Username)
+				if s.LogoutReason != mcapi.LogoutShutdown {
+					t.Errorf("%s closed with reason %q, want %q", s.Username, s.LogoutReason, mcapi.LogoutShutdown)
+				}
+				if s.LogoutTime < s.LoginTime {
+					t.Errorf("%s closed with logout time %d before login time %d", s.Username, s.LogoutTime, s.LoginTime)
+				}
+			}
+			sort.Strings(got)
+			if strings.Join(got, ",") != strings.Join(tt.closed, ",") {
+				t.Errorf("closed = %v, want %v", got, tt.closed)
+			}
+
+			// every session is now closed, with a version kept of each one
+			// this closed
+			var items []mcapi.DynamoDbItem
+			if err := dynamodbattribute.UnmarshalListOfMaps(c.DynamoDB.Items(cfg.UserLoginTableName), &items); err != nil {
+				t.Fatal(err)
+			}
+			versions := map[string]int{}
+			for _, i := range items {
+				if i.SK == mcapi.LoginVersion && i.Online() {
+					t.Errorf("%s still logged in", i.PK)
+				}
+				if i.SK != mcapi.LoginVersion {
+					versions[i.PK]++
+				}
+			}
+			for _, s := range closed {
+				if versions[s.Username] == 0 {
+					t.Errorf("no version kept of %s's closed session", s.Username)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+// Package markserverstarted marks the minecraft service as started. It is
+// called from the EC2 instance once the service is up, moves the server from
+// starting to started and syncs the server's whitelist with the stored one.
+package markserverstarted
+
+import (
+	"errors"
+	"fmt"
+
+	"mcapi"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// Handler marks the minecraft service as started using the injected AWS
+// clients
+type Handler struct {
+	Config  *mcapi.Config
+	Clients *mcapi.Clients
+	State   mcapi.StateStore
+}
+
+// Creates (or updates if already exists) server status with status of
+// "started" to indicate that the server is running. Returns success/failure
+// of function
+func (h *Handler) markAsStarted() error {
+	fmt.Println("ServerStatusKeyName:", h.Config.ServerStatusKeyName)
+	err := h.State.Put(h.Config.ServerStatusKeyName, "started")
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Marked server as started")
+	return nil
+}
+
+// syncWhitelist replaces the whitelist of the server that just started with
+// the stored one, if configured to. The server is up either way, so failures
+// are only logged, and changes made since are pushed as they are made.
+func (h *Handler) syncWhitelist() {
+	if !h.Config.SyncWhitelist {
+		return
+	}
+	fmt.Println("Syncing whitelist...")
+	sync, err := mcapi.SyncWhitelist(h.Config, h.Clients)
+	fmt.Println("whitelist added:", sync.Added, "removed:", sync.Removed)
+	if err != nil {
+		fmt.Println("WARNING: could not sync whitelist:", err)
+	}
+}
+
+// markSynced marks the service of a server already started as started. A
+// server synced straight to started from its running instance has no service
+// status yet, so it is set and the whitelist synced as if it had gone through
+// /start.
+func (h *Handler) markSynced(respond *mcapi.Responder, lifecycle mcapi.Lifecycle) events.APIGatewayProxyResponse {
+	_, err := h.State.Get(h.Config.ServerStatusKeyName)
+	if err == nil {
+		return respond.OK(mcapi.TransitionResult{From: lifecycle, To: lifecycle})
+	}
+	if !errors.Is(err, mcapi.ErrStateNotFound) {
+		return respond.Error(err)
+	}
+	err = h.markAsStarted()
+	if err != nil {
+		return respond.Error(err)
+	}
+	h.syncWhitelist()
+	return respond.OK(mcapi.TransitionResult{From: lifecycle, To: lifecycle, Changed: true})
+}
+
+// Handle is main entry point to lambda function
+func (h *Handler) Handle(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	fmt.Println("Event:", request)
+	respond := mcapi.NewResponder(h.Config, request)
+
+	// the instance may have been booted outside /start, or its stored state
+	// lost, so the server is only refused when the instance is not up
+	lifecycle, err := mcapi.SyncLifecycle(h.Config, h.Clients.EC2, h.State)
+	if err != nil {
+		return respond.Error(err), nil
+	}
+	fmt.Println("lifecycle:", lifecycle)
+	switch {
+	case lifecycle == mcapi.LifecycleStarted:
+		return h.markSynced(respond, lifecycle), nil
+	case !lifecycle.CanTransition(mcapi.LifecycleStarted):
+		// the instance is not running or is being stopped
+		err = mcapi.NewError(mcapi.CodeConflict, "Server cannot be marked started while %s", lifecycle)
+		return respond.Error(err), nil
+	}
+
+	err = h.markAsStarted()
+	if err != nil {
+		return respond.Error(err), nil
+	}
+
+	err = mcapi.Transition(h.Config, h.State, lifecycle, mcapi.LifecycleStarted)
+	if err != nil {
+		return respond.Error(err), nil
+	}
+	h.syncWhitelist()
+
+	return respond.OK(mcapi.TransitionResult{From: lifecycle, To: mcapi.LifecycleStarted, Changed: true}), nil
+}
@@ -0,0 +1,113 @@
+package markserverstarted
+
+import (
+	"strings"
+	"testing"
+
+	"mcapi"
+	"mcapi/mcapitest"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+func TestHandle(t *testing.T) {
+	cfg := mcapitest.Config()
+	tests := []struct {
+		name       string
+		lifecycle  string
+		status     string
+		state      string
+		fail       error
+		statusCode int
+		body       string
+		want       string
+	}{
+		{name: "booted", lifecycle: "starting", state: "running", statusCode: 200, body: "success", want: "started"},
+		{name: "already started", lifecycle: "started", status: "started", state: "running", statusCode: 200, body: "Server is already started", want: "started"},
+		{name: "booted outside the API", state: "running", statusCode: 200, body: "success", want: "started"},
+		{name: "booted with the lifecycle lost", lifecycle: "stopped", state: "running", statusCode: 200, body: "success", want: "started"},
+		{name: "instance not running", state: "stopped", statusCode: 409, body: "cannot be marked started while stopped"},
+		{name: "stopping", lifecycle: "stopping", state: "stopping", statusCode: 409, body: "cannot be marked started while stopping", want: "stopping"},
+		{
+			name:       "status fails",
+			lifecycle:  "starting",
+			state:      "running",
+			fail:       awserr.New("AccessDeniedException", "denied", nil),
+			statusCode: 403,
+			body:       "AccessDeniedException",
+			want:       "starting",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := mcapitest.NewClients()
+			c.EC2.SetState(cfg.ServerID, tt.state)
+			if tt.lifecycle != "" {
+				c.SSM.Set(cfg.LifecycleKeyName, tt.lifecycle)
+			}
+			if tt.status != "" {
+				c.SSM.Set(cfg.ServerStatusKeyName, tt.status)
+			}
+			if tt.fail != nil {
+				c.SSM.Fail("PutParameter", tt.fail)
+			}
+			h := &Handler{Config: cfg, Clients: c.Clients(), State: mcapi.NewSSMStateStore(cfg, c.SSM)}
+
+			resp, err := h.Handle(events.APIGatewayProxyRequest{})
+			if err != nil {
+				t.Fatalf("Handle returned error: %v", err)
+			}
+			if resp.StatusCode != tt.statusCode {
+				t.Errorf("status = %d, want %d (body %q)", resp.StatusCode, tt.statusCode, resp.Body)
+			}
+			if !strings.Contains(resp.Body, tt.body) {
+				t.Errorf("body = %q, want it to contain %q", resp.Body, tt.body)
+			}
+			if got, _ := c.SSM.Get(cfg.LifecycleKeyName); got != tt.want {
+				t.Errorf("lifecycle = %q, want %q", got, tt.want)
+			}
+			if _, ok := c.SSM.Get(cfg.ServerStatusKeyName); ok != (tt.statusCode == 200) {
+				t.Errorf("status set = %t, want %t", ok, tt.statusCode == 200)
+			}
+		})
+	}
+}
+
+func TestHandleSyncWhitelist(t *testing.T) {
+	tests := []struct {
+		name     string
+		sync     bool
+		fail     error
+		commands string
+	}{
+		{name: "synced", sync: true, commands: "whitelist list,whitelist add steve"},
+		{name: "sync disabled"},
+		{name: "sync fails", sync: true, fail: mcapi.NewError(mcapi.CodeUnavailable, "RCON")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := mcapitest.Config()
+			cfg.SyncWhitelist = tt.sync
+			c := mcapitest.NewClients()
+			c.EC2.SetState(cfg.ServerID, "running")
+			c.SSM.Set(cfg.LifecycleKeyName, "starting")
+			mcapi.PutWhitelistEntry(cfg, c.DynamoDB, mcapi.WhitelistEntry{Username: "steve"})
+			c.RCON.SetOutput("whitelist list", "There are 1 whitelisted player(s): notch")
+			c.RCON.Fail("Command", tt.fail)
+			h := &Handler{Config: cfg, Clients: c.Clients(), State: mcapi.NewSSMStateStore(cfg, c.SSM)}
+
+			resp, err := h.Handle(events.APIGatewayProxyRequest{})
+			if err != nil {
+				t.Fatalf("Handle returned error: %v", err)
+			}
+			if resp.StatusCode != 200 {
+				t.Errorf("status = %d, want 200 (body %q)", resp.StatusCode, resp.Body)
+			}
+			if got := strings.Join(c.RCON.Commands(), ","); got != tt.commands {
+				t.Errorf("RCON commands = %q, want %q", got, tt.commands)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+// Package removefromwhitelist takes a player off the whitelist of the
+// minecraft server.
+package removefromwhitelist
+
+import (
+	"fmt"
+
+	"mcapi"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// Handler takes players off the whitelist using the injected clients
+type Handler struct {
+	Config  *mcapi.Config
+	Clients *mcapi.Clients
+	State   mcapi.StateStore
+}
+
+// Handle is main entry point to lambda function. The player is the {username}
+// path parameter.
+func (h *Handler) Handle(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	respond := mcapi.NewResponder(h.Config, request)
+
+	username := request.PathParameters["username"]
+	if !mcapi.IsPlayerName(username) {
+		err := mcapi.NewError(mcapi.CodeInvalidRequest, "username must be a minecraft player name, got %q", username)
+		return respond.Error(err), nil
+	}
+
+	fmt.Println("Removing", username, "from whitelist...")
+	entry, err := mcapi.DeleteWhitelistEntry(h.Config, h.Clients.DynamoDB, username)
+	if err != nil {
+		return respond.Error(err), nil
+	}
+	return respond.OK(mcapi.PushWhitelistChange(h.Config, h.Clients, h.State, entry, "remove")), nil
+}
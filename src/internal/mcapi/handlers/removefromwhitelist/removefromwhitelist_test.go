@@ -0,0 +1,52 @@
+package removefromwhitelist
+
+import (
+	"strings"
+	"testing"
+
+	"mcapi"
+	"mcapi/mcapitest"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestHandle(t *testing.T) {
+	tests := []struct {
+		name       string
+		username   string
+		lifecycle  string
+		statusCode int
+		body       string
+		commands   string
+	}{
+		{name: "pushed to the started server", username: "STEVE", lifecycle: "started", statusCode: 200, body: `"synced":true`, commands: "whitelist remove Steve"},
+		{name: "removed while stopped", username: "steve", lifecycle: "stopped", statusCode: 200, body: `"synced":false`},
+		{name: "not whitelisted", username: "alex", lifecycle: "started", statusCode: 404, body: "alex is not whitelisted"},
+		{name: "invalid username", username: "a b", statusCode: 400},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := mcapitest.Config()
+			c := mcapitest.NewClients()
+			c.EC2.SetState(cfg.ServerID, "running")
+			c.SSM.Set(cfg.LifecycleKeyName, tt.lifecycle)
+			mcapi.PutWhitelistEntry(cfg, c.DynamoDB, mcapi.WhitelistEntry{Username: "Steve"})
+			h := &Handler{Config: cfg, Clients: c.Clients(), State: mcapi.NewSSMStateStore(cfg, c.SSM)}
+
+			resp, err := h.Handle(events.APIGatewayProxyRequest{PathParameters: map[string]string{"username": tt.username}})
+			if err != nil {
+				t.Fatalf("Handle returned error: %v", err)
+			}
+			if resp.StatusCode != tt.statusCode || !strings.Contains(resp.Body, tt.body) {
+				t.Errorf("response = %d %q, want %d containing %q", resp.StatusCode, resp.Body, tt.statusCode, tt.body)
+			}
+			if got := strings.Join(c.RCON.Commands(), ","); got != tt.commands {
+				t.Errorf("RCON commands = %q, want %q", got, tt.commands)
+			}
+			entries, _ := mcapi.GetWhitelist(cfg, c.DynamoDB)
+			if removed := len(entries) == 0; removed != (tt.statusCode == 200) {
+				t.Errorf("whitelist = %+v after %d", entries, resp.StatusCode)
+			}
+		})
+	}
+}
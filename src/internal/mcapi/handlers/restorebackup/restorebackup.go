@@ -0,0 +1,167 @@
+// Package restorebackup restores a backup of the minecraft server world onto
+// the stopped server. Swapping the world volume takes longer than API Gateway
+// waits, so a request moves the server to restoring, which keeps it from being
+// started meanwhile, and hands the swap to an asynchronous invocation of the
+// function. The restore it answers with can be polled through getrestore.
+package restorebackup
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"mcapi"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// RestoreSource is the source of the asynchronous invocation a restore is
+// handed to
+const RestoreSource = "mcapi.restoreBackup"
+
+// finishTime is the time the swap leaves itself to record how the restore
+// ended before the invocation times out
+const finishTime = 30 * time.Second
+
+// Event is either the asynchronous invocation of a restore, identified by its
+// source, or an API Gateway proxy request from the /backups/{id}/restore
+// endpoint
+type Event struct {
+	Source string `json:"source"`
+	// Restore is the restore handed to an asynchronous invocation
+	Restore *mcapi.Restore `json:"restore,omitempty"`
+	events.APIGatewayProxyRequest
+}
+
+// restoreRequest is the event of the asynchronous invocation a restore is
+// handed to, unmarshalled into an Event
+type restoreRequest struct {
+	Source  string         `json:"source"`
+	Restore *mcapi.Restore `json:"restore"`
+}
+
+// Handler restores backups using the injected AWS clients
+type Handler struct {
+	Config  *mcapi.Config
+	Clients *mcapi.Clients
+	State   mcapi.StateStore
+}
+
+// Handle is main entry point to lambda function. The backup ID is the {id}
+// path parameter.
+func (h *Handler) Handle(ctx context.Context, event Event) (events.APIGatewayProxyResponse, error) {
+	if event.Source == RestoreSource && event.Restore != nil {
+		return h.restore(ctx, *event.Restore)
+	}
+	request := event.APIGatewayProxyRequest
+	respond := mcapi.NewResponder(h.Config, request)
+
+	id := request.PathParameters["id"]
+	if id == "" {
+		return respond.Error(mcapi.NewError(mcapi.CodeInvalidRequest, "missing backup id")), nil
+	}
+	backup, err := mcapi.GetBackup(h.Config, h.Clients.EC2, id)
+	if err != nil {
+		return respond.Error(err), nil
+	}
+	if backup.State != ec2.SnapshotStateCompleted {
+		err = mcapi.NewError(mcapi.CodeConflict, "Backup %s is %s, not completed", backup.SnapshotID, backup.State)
+		return respond.Error(err), nil
+	}
+
+	lifecycle, err := mcapi.SyncLifecycle(h.Config, h.Clients.EC2, h.State)
+	if err != nil {
+		return respond.Error(err), nil
+	}
+	fmt.Println("lifecycle:", lifecycle)
+	if lifecycle != mcapi.LifecycleStopped {
+		err = mcapi.NewError(mcapi.CodeConflict, "Backups cannot be restored while the server is %s", lifecycle)
+		return respond.Error(err), nil
+	}
+	// a server the API stopped may still be on its way down
+	state, err := mcapi.InstanceState(h.Config, h.Clients.EC2)
+	if err != nil {
+		return respond.Error(err), nil
+	}
+	if state != ec2.InstanceStateNameStopped {
+		err = mcapi.NewError(mcapi.CodeConflict, "Backups cannot be restored while the instance is %s", state)
+		return respond.Error(err), nil
+	}
+	err = mcapi.Transition(h.Config, h.State, lifecycle, mcapi.LifecycleRestoring)
+	if err != nil {
+		return respond.Error(err), nil
+	}
+
+	restore := mcapi.Restore{
+		ID:         request.RequestContext.RequestID,
+		Status:     mcapi.RestoreRestoring,
+		SnapshotID: backup.SnapshotID,
+		StartedAt:  time.Now().Unix(),
+	}
+	fmt.Println("Restoring", backup.SnapshotID, "taken at", backup.StartTime, "as", restore.ID, "...")
+	err = mcapi.PutRestore(h.Config, h.State, restore)
+	if err == nil {
+		err = h.Clients.Invoker.Invoke(h.Config.FunctionName, restoreRequest{Source: RestoreSource, Restore: &restore})
+	}
+	if err != nil {
+		h.finish(restore, err)
+		return respond.Error(err), nil
+	}
+	return respond.Accepted(restore), nil
+}
+
+// restore swaps the backup in for the server's world volume and moves the
+// server from restoring back to stopped. The swap gives up in time to do so
+// before the invocation times out, and before the restore counts as timed out
+// and the server is moved back without it.
+func (h *Handler) restore(ctx context.Context, restore mcapi.Restore) (events.APIGatewayProxyResponse, error) {
+	respond := mcapi.NewResponder(h.Config, events.APIGatewayProxyRequest{})
+	deadline := time.Unix(restore.StartedAt, 0).Add(mcapi.RestoreTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	ctx, cancel := context.WithDeadline(ctx, deadline.Add(-finishTime))
+	defer cancel()
+
+	err := ctx.Err()
+	if err != nil {
+		err = fmt.Errorf("restore %s started too late: %w", restore.ID, err)
+	}
+	var backup mcapi.Backup
+	if err == nil {
+		backup, err = mcapi.GetBackup(h.Config, h.Clients.EC2, restore.SnapshotID)
+	}
+	if err == nil {
+		var swapped mcapi.Restore
+		swapped, err = mcapi.RestoreBackup(ctx, h.Config, h.Clients.EC2, backup)
+		restore.Device = swapped.Device
+		restore.VolumeID = swapped.VolumeID
+		restore.PreviousVolumeID = swapped.PreviousVolumeID
+	}
+	restore = h.finish(restore, err)
+	if err != nil {
+		return respond.Error(err), nil
+	}
+	fmt.Println("Restored world as", restore.VolumeID, "replacing", restore.PreviousVolumeID)
+	return respond.OK(restore), nil
+}
+
+// finish records how the restore ended and moves the server from restoring
+// back to stopped, returning the restore recorded. Failing to record it is
+// only logged, so the server is not left restoring.
+func (h *Handler) finish(restore mcapi.Restore, err error) mcapi.Restore {
+	restore.Status = mcapi.RestoreRestored
+	if err != nil {
+		fmt.Println("Restore", restore.ID, "failed:", err)
+		restore.Status = mcapi.RestoreFailed
+		restore.Error = err.Error()
+	}
+	if perr := mcapi.PutRestore(h.Config, h.State, restore); perr != nil {
+		fmt.Println("WARNING: could not record restore", restore.ID, ":", perr)
+	}
+	if terr := mcapi.Transition(h.Config, h.State, mcapi.LifecycleRestoring, mcapi.LifecycleStopped); terr != nil {
+		fmt.Println("WARNING: could not end restore", restore.ID, ":", terr)
+	}
+	return restore
+}
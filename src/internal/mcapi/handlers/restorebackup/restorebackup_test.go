@@ -0,0 +1,194 @@
+package restorebackup
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"mcapi"
+	"mcapi/mcapitest"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+func TestHandle(t *testing.T) {
+	cfg := mcapitest.Config()
+	tests := []struct {
+		name       string
+		id         string
+		lifecycle  string
+		state      string
+		setup      func(c *mcapitest.Clients)
+		statusCode int
+		// status is the restore recorded once the handed over swap has run
+		status string
+	}{
+		{name: "restores onto the stopped server", id: "snap-1", state: "stopped", statusCode: 202, status: "restored"},
+		{name: "missing id", state: "stopped", statusCode: 400},
+		{name: "unknown backup", id: "snap-other", state: "stopped", statusCode: 404},
+		{name: "backup still pending", id: "snap-pending", state: "stopped", statusCode: 409},
+		{name: "server started", id: "snap-1", lifecycle: "started", state: "running", statusCode: 409},
+		{name: "server stopping", id: "snap-1", lifecycle: "stopping", state: "stopping", statusCode: 409},
+		{name: "instance still stopping", id: "snap-1", lifecycle: "stopped", state: "stopping", statusCode: 409},
+		{name: "instance started outside the API", id: "snap-1", state: "running", statusCode: 409},
+		{
+			name: "already restoring", id: "snap-1", lifecycle: "restoring", state: "stopped",
+			setup: func(c *mcapitest.Clients) {
+				restore := mcapi.Restore{ID: "req-0", Status: mcapi.RestoreRestoring, StartedAt: time.Now().Unix()}
+				mcapi.PutRestore(cfg, mcapi.NewSSMStateStore(cfg, c.SSM), restore)
+			},
+			statusCode: 409,
+		},
+		{
+			name: "previous restore cut short", id: "snap-1", lifecycle: "restoring", state: "stopped",
+			setup: func(c *mcapitest.Clients) {
+				started := time.Now().Add(-mcapi.RestoreTimeout)
+				restore := mcapi.Restore{ID: "req-0", Status: mcapi.RestoreRestoring, StartedAt: started.Unix()}
+				mcapi.PutRestore(cfg, mcapi.NewSSMStateStore(cfg, c.SSM), restore)
+			},
+			statusCode: 202, status: "restored",
+		},
+		{
+			name: "handing over fails", id: "snap-1", state: "stopped",
+			setup: func(c *mcapitest.Clients) {
+				c.Invoker.Fail("Invoke", awserr.New("TooManyRequestsException", "rate exceeded", nil))
+			},
+			statusCode: 429, status: "failed",
+		},
+		{
+			name: "swap fails", id: "snap-1", state: "stopped",
+			setup: func(c *mcapitest.Clients) {
+				c.EC2.Fail("CreateVolume", awserr.New("VolumeLimitExceeded", "too many volumes", nil))
+			},
+			statusCode: 202, status: "failed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := mcapitest.NewClients()
+			c.EC2.SetState(cfg.ServerID, tt.state)
+			c.EC2.SetVolume(cfg.ServerID, "/dev/xvda", "vol-world")
+			tag := []*ec2.Tag{{Key: aws.String(mcapi.BackupTagKey), Value: aws.String(cfg.ServerID)}}
+			c.EC2.AddSnapshot(&ec2.Snapshot{
+				SnapshotId: aws.String("snap-1"),
+				VolumeId:   aws.String("vol-world"),
+				StartTime:  aws.Time(time.Now().Add(-time.Hour)),
+				State:      aws.String(ec2.SnapshotStateCompleted),
+				Tags:       tag,
+			})
+			c.EC2.AddSnapshot(&ec2.Snapshot{SnapshotId: aws.String("snap-pending"), State: aws.String(ec2.SnapshotStatePending), Tags: tag})
+			c.EC2.AddSnapshot(&ec2.Snapshot{SnapshotId: aws.String("snap-other"), State: aws.String(ec2.SnapshotStateCompleted)})
+			if tt.lifecycle != "" {
+				c.SSM.Set(cfg.LifecycleKeyName, tt.lifecycle)
+			}
+			if tt.setup != nil {
+				tt.setup(c)
+			}
+			h := &Handler{Config: cfg, Clients: c.Clients(), State: mcapi.NewSSMStateStore(cfg, c.SSM)}
+
+			request := events.APIGatewayProxyRequest{PathParameters: map[string]string{"id": tt.id}}
+			request.RequestContext.RequestID = "req-1"
+			resp, err := h.Handle(context.Background(), Event{APIGatewayProxyRequest: request})
+			if err != nil {
+				t.Fatalf("Handle returned error: %v", err)
+			}
+			if resp.StatusCode != tt.statusCode {
+				t.Fatalf("status = %d, want %d (body %q)", resp.StatusCode, tt.statusCode, resp.Body)
+			}
+			if tt.status == "" {
+				if world := c.EC2.Volume(cfg.ServerID, "/dev/xvda"); world != "vol-world" || c.EC2.Called("CreateVolume") {
+					t.Errorf("world volume = %q, want vol-world left alone", world)
+				}
+				if got, _ := h.State.Get(cfg.LifecycleKeyName); tt.lifecycle != "" && got != tt.lifecycle {
+					t.Errorf("lifecycle = %q, want %q left alone", got, tt.lifecycle)
+				}
+				if len(c.Invoker.Take()) != 0 {
+					t.Error("restore handed over, want it refused")
+				}
+				return
+			}
+
+			if tt.statusCode == 202 {
+				var accepted mcapi.Restore
+				if err := json.Unmarshal([]byte(resp.Body), &accepted); err != nil {
+					t.Fatalf("body %q: %v", resp.Body, err)
+				}
+				if accepted.ID != "req-1" || accepted.Status != "restoring" || accepted.SnapshotID != "snap-1" {
+					t.Errorf("accepted restore = %+v, want req-1 restoring snap-1", accepted)
+				}
+				if got, _ := h.State.Get(cfg.LifecycleKeyName); got != "restoring" {
+					t.Errorf("lifecycle = %q when accepted, want restoring", got)
+				}
+				if c.EC2.Called("CreateVolume") {
+					t.Error("volume created before the swap was handed over")
+				}
+				invocations := c.Invoker.Take()
+				if len(invocations) != 1 || invocations[0].Function != cfg.FunctionName {
+					t.Fatalf("invocations = %v, want one of %s", invocations, cfg.FunctionName)
+				}
+				var event Event
+				if err := json.Unmarshal(invocations[0].Payload, &event); err != nil {
+					t.Fatal(err)
+				}
+				if event.Source != RestoreSource {
+					t.Errorf("handed over with source %q, want %q", event.Source, RestoreSource)
+				}
+				if _, err := h.Handle(context.Background(), event); err != nil {
+					t.Fatalf("Handle of handed over restore returned error: %v", err)
+				}
+			}
+
+			if got, _ := h.State.Get(cfg.LifecycleKeyName); got != "stopped" {
+				t.Errorf("lifecycle = %q once done, want stopped", got)
+			}
+			restore, err := mcapi.GetRestore(cfg, h.State, "req-1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if restore.Status != tt.status {
+				t.Errorf("restore = %+v, want %s", restore, tt.status)
+			}
+			world := c.EC2.Volume(cfg.ServerID, "/dev/xvda")
+			if tt.status != "restored" {
+				if restore.Error == "" || world != "vol-world" {
+					t.Errorf("restore = %+v with %s attached, want why it failed and vol-world kept", restore, world)
+				}
+				return
+			}
+			if restore.VolumeID != world || restore.PreviousVolumeID != "vol-world" {
+				t.Errorf("restore = %+v with %s attached, want snap-1 swapped in for vol-world", restore, world)
+			}
+		})
+	}
+}
+
+func TestHandleLateRestore(t *testing.T) {
+	cfg := mcapitest.Config()
+	c := mcapitest.NewClients()
+	c.EC2.SetState(cfg.ServerID, "stopped")
+	c.EC2.SetVolume(cfg.ServerID, "/dev/xvda", "vol-world")
+	c.SSM.Set(cfg.LifecycleKeyName, "restoring")
+	h := &Handler{Config: cfg, Clients: c.Clients(), State: mcapi.NewSSMStateStore(cfg, c.SSM)}
+
+	// handed over so late the restore already counts as timed out
+	started := time.Now().Add(-mcapi.RestoreTimeout)
+	restore := mcapi.Restore{ID: "req-1", Status: mcapi.RestoreRestoring, SnapshotID: "snap-1", StartedAt: started.Unix()}
+	if _, err := h.Handle(context.Background(), Event{Source: RestoreSource, Restore: &restore}); err != nil {
+		t.Fatalf("Handle returned error: %v", err)
+	}
+	if c.EC2.Called("CreateVolume") {
+		t.Error("volume created after the restore timed out")
+	}
+	got, err := mcapi.GetRestore(cfg, h.State, "req-1")
+	if err != nil || got.Status != mcapi.RestoreFailed {
+		t.Errorf("restore = %+v, %v, want it failed", got, err)
+	}
+	if lifecycle, _ := h.State.Get(cfg.LifecycleKeyName); lifecycle != "stopped" {
+		t.Errorf("lifecycle = %q, want stopped", lifecycle)
+	}
+}
@@ -0,0 +1,161 @@
+// Package startserver starts the minecraft server and arms the auto-stop timer.
+// Starting a server that is already starting or started is a no-op.
+package startserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"mcapi"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// Body to marshal json request into. The body is optional.
+type Body struct {
+	// Minutes asks for a session shorter than the configured session length
+	Minutes int `json:"minutes"`
+}
+
+// sessionLength returns the session length asked for by the request body,
+// defaulting to the configured session length
+func (h *Handler) sessionLength(requestBody string) (time.Duration, error) {
+	if requestBody == "" {
+		return h.Config.SessionLength, nil
+	}
+	var body Body
+	err := json.Unmarshal([]byte(requestBody), &body)
+	if err != nil {
+		return 0, mcapi.InvalidRequest(err)
+	}
+	if body.Minutes == 0 {
+		return h.Config.SessionLength, nil
+	}
+	length := time.Duration(body.Minutes) * time.Minute
+	if body.Minutes < 0 || length > h.Config.SessionLength {
+		return 0, mcapi.NewError(mcapi.CodeInvalidRequest, "minutes must be between 1 and %d", int(h.Config.SessionLength/time.Minute))
+	}
+	return length, nil
+}
+
+// Handler starts the minecraft server using the injected AWS clients
+type Handler struct {
+	Config  *mcapi.Config
+	Clients *mcapi.Clients
+	State   mcapi.StateStore
+}
+
+// arms the one-time stop of the server at stopTime, or the first idle check
+// if that comes sooner
+func (h *Handler) scheduleStop(stopTime time.Time) error {
+	fmt.Println("scheduling auto-stopper")
+	err := h.Clients.Scheduler.Schedule(mcapi.CheckTime(h.Config, time.Now(), stopTime))
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("scheduled stopTime")
+	return nil
+}
+
+// Creates (or updates if already exists) stop timer with unix time stamp
+// length from now to act as timer for automatically shutting down
+// server, and starts a new session started by actor. Returns the stop time set
+func (h *Handler) startTimer(length time.Duration, actor *mcapi.Actor) (time.Time, error) {
+	fmt.Println("TimerKeyName:", h.Config.TimerKeyName)
+	now := time.Now()
+	stopTime := now.Add(length)
+	err := mcapi.PutStopTime(h.Config, h.State, stopTime)
+	if err != nil {
+		return stopTime, err
+	}
+	err = mcapi.PutSession(h.Config, h.State, mcapi.Session{StartTime: now.Unix(), StartedBy: actor})
+	if err != nil {
+		return stopTime, err
+	}
+
+	fmt.Println("Set stop time")
+	return stopTime, nil
+}
+
+// startInstance starts the server's instance
+func (h *Handler) startInstance() error {
+	fmt.Println("Starting instance", h.Config.ServerID, "...")
+	input := &ec2.StartInstancesInput{
+		InstanceIds: []*string{
+			aws.String(h.Config.ServerID),
+		},
+	}
+	result, err := h.Clients.EC2.StartInstances(input)
+	if err != nil {
+		return err
+	}
+	fmt.Println("status:", result.StartingInstances)
+	if len(result.StartingInstances) < 1 {
+		return mcapi.NewError(mcapi.CodeNotFound, "Could not find instance with ID %s", h.Config.ServerID)
+	}
+	return nil
+}
+
+// Handle is main entry point to lambda function
+func (h *Handler) Handle(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	respond := mcapi.NewResponder(h.Config, request)
+
+	length, err := h.sessionLength(request.Body)
+	if err != nil {
+		return respond.Error(err), nil
+	}
+	fmt.Println("session length:", length)
+
+	// don't reset the timer of a server that is already up (or on its way up),
+	// and don't start one that is still shutting down
+	lifecycle, err := mcapi.SyncLifecycle(h.Config, h.Clients.EC2, h.State)
+	if err != nil {
+		return respond.Error(err), nil
+	}
+	fmt.Println("lifecycle:", lifecycle)
+	switch {
+	case lifecycle == mcapi.LifecycleStarting || lifecycle == mcapi.LifecycleStarted:
+		return respond.OK(mcapi.TransitionResult{From: lifecycle, To: lifecycle}), nil
+	case !lifecycle.CanTransition(mcapi.LifecycleStarting):
+		err = mcapi.NewError(mcapi.CodeConflict, "Server cannot be started while %s", lifecycle)
+		return respond.Error(err), nil
+	}
+
+	// claim the start before starting the instance, so only one of several
+	// concurrent requests starts it and arms the timer. If the instance then
+	// fails to start, the next request finds it starting while stopped and
+	// syncs it back to stopped, so the start can be retried.
+	err = mcapi.Transition(h.Config, h.State, lifecycle, mcapi.LifecycleStarting)
+	if err != nil {
+		return respond.Error(err), nil
+	}
+
+	err = h.startInstance()
+	if err != nil {
+		return respond.Error(err), nil
+	}
+
+	// set stop time as unix timestamp in the state store, recording who
+	// started the session
+	actor := mcapi.RequestActor(h.Config, h.Clients.DynamoDB, request)
+	if actor != nil {
+		fmt.Println("Started by", actor.CognitoUser)
+	}
+	stopTime, err := h.startTimer(length, actor)
+	if err != nil {
+		return respond.Error(err), nil
+	}
+
+	// then schedule the stop for when the timer runs out
+	err = h.scheduleStop(stopTime)
+	if err != nil {
+		return respond.Error(err), nil
+	}
+
+	return respond.OK(mcapi.TransitionResult{From: lifecycle, To: mcapi.LifecycleStarting, Changed: true}), nil
+}
@@ -0,0 +1,328 @@
+package startserver
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"mcapi"
+	"mcapi/mcapitest"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+func TestHandle(t *testing.T) {
+	cfg := mcapitest.Config()
+	tests := []struct {
+		name       string
+		request    string
+		claims     map[string]interface{}
+		setup      func(c *mcapitest.Clients)
+		statusCode int
+		body       string
+		check      func(t *testing.T, c *mcapitest.Clients)
+	}{
+		{
+			name: "starts instance and schedules stop",
+			setup: func(c *mcapitest.Clients) {
+				c.EC2.SetState(cfg.ServerID, "stopped")
+			},
+			statusCode: 200,
+			body:       "success",
+			check: func(t *testing.T, c *mcapitest.Clients) {
+				if got := c.EC2.State(cfg.ServerID); got != "pending" {
+					t.Errorf("instance state = %q, want pending", got)
+				}
+				value, ok := c.SSM.Get(cfg.TimerKeyName)
+				if !ok {
+					t.Fatal("timer parameter not set")
+				}
+				stopTime, err := strconv.ParseInt(value, 10, 64)
+				if err != nil {
+					t.Fatalf("timer parameter %q: %v", value, err)
+				}
+				if d := stopTime - time.Now().Unix(); d < 7130 || d > 7140 {
+					t.Errorf("stop time is %ds from now, want about 7140s", d)
+				}
+				session, ok := c.SSM.Get(cfg.SessionKeyName)
+				if !ok || !strings.Contains(session, `"extensions":0`) {
+					t.Errorf("session = %q, want a new session", session)
+				}
+				at, ok := c.Scheduler.At()
+				if !ok || at.Unix() != stopTime {
+					t.Errorf("stop scheduled at %v (armed %t), want %d", at.Unix(), ok, stopTime)
+				}
+				if got, _ := c.SSM.Get(cfg.LifecycleKeyName); got != "starting" {
+					t.Errorf("lifecycle = %q, want starting", got)
+				}
+			},
+		},
+		{
+			name:    "shorter session",
+			request: `{"minutes": 30}`,
+			setup: func(c *mcapitest.Clients) {
+				c.EC2.SetState(cfg.ServerID, "stopped")
+			},
+			statusCode: 200,
+			body:       "success",
+			check: func(t *testing.T, c *mcapitest.Clients) {
+				value, _ := c.SSM.Get(cfg.TimerKeyName)
+				stopTime, _ := strconv.ParseInt(value, 10, 64)
+				if d := stopTime - time.Now().Unix(); d < 1790 || d > 1800 {
+					t.Errorf("stop time is %ds from now, want about 1800s", d)
+				}
+			},
+		},
+		{
+			name:    "session longer than configured",
+			request: `{"minutes": 180}`,
+			setup: func(c *mcapitest.Clients) {
+				c.EC2.SetState(cfg.ServerID, "stopped")
+			},
+			statusCode: 400,
+			body:       "minutes must be between 1 and 119",
+			check: func(t *testing.T, c *mcapitest.Clients) {
+				if c.EC2.Called("StartInstances") {
+					t.Error("instance started for invalid request")
+				}
+			},
+		},
+		{
+			name:    "malformed body",
+			request: `{"minutes": "thirty"}`,
+			setup: func(c *mcapitest.Clients) {
+				c.EC2.SetState(cfg.ServerID, "stopped")
+			},
+			statusCode: 400,
+		},
+		{
+			name: "already started is a no-op",
+			setup: func(c *mcapitest.Clients) {
+				c.EC2.SetState(cfg.ServerID, "running")
+				c.SSM.Set(cfg.LifecycleKeyName, "started")
+				c.SSM.Set(cfg.TimerKeyName, "1234")
+			},
+			statusCode: 200,
+			body:       "Server is already started",
+			check: func(t *testing.T, c *mcapitest.Clients) {
+				if c.EC2.Called("StartInstances") || c.Scheduler.Called("Schedule") {
+					t.Error("already started server was started again")
+				}
+				if got, _ := c.SSM.Get(cfg.TimerKeyName); got != "1234" {
+					t.Errorf("timer = %q, want it left at 1234", got)
+				}
+			},
+		},
+		{
+			name: "already started before lifecycle was tracked",
+			setup: func(c *mcapitest.Clients) {
+				c.EC2.SetState(cfg.ServerID, "running")
+				c.SSM.Set(cfg.ServerStatusKeyName, "started")
+			},
+			statusCode: 200,
+			body:       "Server is already started",
+		},
+		{
+			name: "still starting is a no-op",
+			setup: func(c *mcapitest.Clients) {
+				c.EC2.SetState(cfg.ServerID, "pending")
+				c.SSM.Set(cfg.LifecycleKeyName, "starting")
+			},
+			statusCode: 200,
+			body:       "Server is already starting",
+		},
+		{
+			name: "start while stopping conflicts",
+			setup: func(c *mcapitest.Clients) {
+				c.EC2.SetState(cfg.ServerID, "stopping")
+				c.SSM.Set(cfg.LifecycleKeyName, "stopping")
+			},
+			statusCode: 409,
+			body:       "cannot be started while stopping",
+			check: func(t *testing.T, c *mcapitest.Clients) {
+				if c.EC2.Called("StartInstances") {
+					t.Error("stopping server was started")
+				}
+			},
+		},
+		{
+			name: "start while restoring conflicts",
+			setup: func(c *mcapitest.Clients) {
+				c.EC2.SetState(cfg.ServerID, "stopped")
+				c.SSM.Set(cfg.LifecycleKeyName, "restoring")
+				restore := mcapi.Restore{ID: "req-1", Status: mcapi.RestoreRestoring, StartedAt: time.Now().Unix()}
+				mcapi.PutRestore(cfg, mcapi.NewSSMStateStore(cfg, c.SSM), restore)
+			},
+			statusCode: 409,
+			body:       "cannot be started while restoring",
+			check: func(t *testing.T, c *mcapitest.Clients) {
+				if c.EC2.Called("StartInstances") {
+					t.Error("server being restored was started")
+				}
+			},
+		},
+		{
+			name: "start after a restore timed out",
+			setup: func(c *mcapitest.Clients) {
+				c.EC2.SetState(cfg.ServerID, "stopped")
+				c.SSM.Set(cfg.LifecycleKeyName, "restoring")
+				started := time.Now().Add(-mcapi.RestoreTimeout - time.Minute)
+				restore := mcapi.Restore{ID: "req-1", Status: mcapi.RestoreRestoring, StartedAt: started.Unix()}
+				mcapi.PutRestore(cfg, mcapi.NewSSMStateStore(cfg, c.SSM), restore)
+			},
+			statusCode: 200,
+			body:       "success",
+			check: func(t *testing.T, c *mcapitest.Clients) {
+				restore, err := mcapi.GetRestore(cfg, mcapi.NewSSMStateStore(cfg, c.SSM), "req-1")
+				if err != nil || restore.Status != mcapi.RestoreFailed {
+					t.Errorf("restore = %+v, %v, want it failed", restore, err)
+				}
+				if !c.EC2.Called("StartInstances") {
+					t.Error("server not started")
+				}
+			},
+		},
+		{
+			name:       "unknown instance",
+			statusCode: 404,
+			body:       "Could not find instance",
+			check: func(t *testing.T, c *mcapitest.Clients) {
+				if _, ok := c.SSM.Get(cfg.TimerKeyName); ok {
+					t.Error("timer parameter set for unknown instance")
+				}
+				if _, ok := c.SSM.Get(cfg.LifecycleKeyName); ok {
+					t.Error("lifecycle set for unknown instance")
+				}
+			},
+		},
+		{
+			name: "instance still shutting down",
+			setup: func(c *mcapitest.Clients) {
+				c.EC2.SetState(cfg.ServerID, "stopping")
+			},
+			statusCode: 409,
+			body:       "IncorrectInstanceState",
+			check: func(t *testing.T, c *mcapitest.Clients) {
+				// the claim is left behind, but does not block a retry once
+				// the instance has stopped
+				c.EC2.SetState(cfg.ServerID, "stopped")
+				h := &Handler{Config: cfg, Clients: c.Clients(), State: mcapi.NewSSMStateStore(cfg, c.SSM)}
+				resp, _ := h.Handle(events.APIGatewayProxyRequest{})
+				if resp.StatusCode != 200 || c.EC2.State(cfg.ServerID) != "pending" {
+					t.Errorf("retry returned %d %q, instance %s, want it started", resp.StatusCode, resp.Body, c.EC2.State(cfg.ServerID))
+				}
+			},
+		},
+		{
+			name: "started outside the API is a no-op",
+			setup: func(c *mcapitest.Clients) {
+				c.EC2.SetState(cfg.ServerID, "running")
+				c.SSM.Set(cfg.LifecycleKeyName, "stopped")
+			},
+			statusCode: 200,
+			body:       "Server is already started",
+			check: func(t *testing.T, c *mcapitest.Clients) {
+				if c.EC2.Called("StartInstances") {
+					t.Error("running instance was started again")
+				}
+				if got, _ := c.SSM.Get(cfg.LifecycleKeyName); got != "started" {
+					t.Errorf("lifecycle = %q, want it synced to started", got)
+				}
+			},
+		},
+		{
+			name: "stopped outside the API is started",
+			setup: func(c *mcapitest.Clients) {
+				c.EC2.SetState(cfg.ServerID, "stopped")
+				c.SSM.Set(cfg.LifecycleKeyName, "started")
+			},
+			statusCode: 200,
+			body:       "success",
+			check: func(t *testing.T, c *mcapitest.Clients) {
+				if got := c.EC2.State(cfg.ServerID); got != "pending" {
+					t.Errorf("instance state = %q, want pending", got)
+				}
+				if got, _ := c.SSM.Get(cfg.LifecycleKeyName); got != "starting" {
+					t.Errorf("lifecycle = %q, want starting", got)
+				}
+			},
+		},
+		{
+			name: "start fails",
+			setup: func(c *mcapitest.Clients) {
+				c.EC2.SetState(cfg.ServerID, "stopped")
+				c.EC2.Fail("StartInstances", awserr.New("RequestLimitExceeded", "slow down", nil))
+			},
+			statusCode: 429,
+			body:       "RequestLimitExceeded",
+			check: func(t *testing.T, c *mcapitest.Clients) {
+				if c.Scheduler.Called("Schedule") {
+					t.Error("stop scheduled after failed start")
+				}
+			},
+		},
+		{
+			name:   "records the signed in user",
+			claims: map[string]interface{}{"sub": "sub-alice", "cognito:username": "alice"},
+			setup: func(c *mcapitest.Clients) {
+				c.EC2.SetState(cfg.ServerID, "stopped")
+			},
+			statusCode: 200,
+			body:       "success",
+			check: func(t *testing.T, c *mcapitest.Clients) {
+				session, _ := c.SSM.Get(cfg.SessionKeyName)
+				if !strings.Contains(session, `"startedBy":{"cognitoUser":"alice"}`) {
+					t.Errorf("session = %q, want it started by alice", session)
+				}
+			},
+		},
+		{
+			name: "timer fails",
+			setup: func(c *mcapitest.Clients) {
+				c.EC2.SetState(cfg.ServerID, "stopped")
+				c.SSM.Fail("PutParameter", awserr.New("AccessDeniedException", "denied", nil))
+			},
+			statusCode: 403,
+			body:       "AccessDeniedException",
+		},
+		{
+			name: "schedule fails",
+			setup: func(c *mcapitest.Clients) {
+				c.EC2.SetState(cfg.ServerID, "stopped")
+				c.Scheduler.Fail("Schedule", awserr.New("ResourceNotFoundException", "no rule", nil))
+			},
+			statusCode: 404,
+			body:       "ResourceNotFoundException",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := mcapitest.NewClients()
+			if tt.setup != nil {
+				tt.setup(c)
+			}
+			h := &Handler{Config: cfg, Clients: c.Clients(), State: mcapi.NewSSMStateStore(cfg, c.SSM)}
+
+			request := events.APIGatewayProxyRequest{Body: tt.request}
+			if tt.claims != nil {
+				request.RequestContext.Authorizer = map[string]interface{}{"claims": tt.claims}
+			}
+			resp, err := h.Handle(request)
+			if err != nil {
+				t.Fatalf("Handle returned error: %v", err)
+			}
+			if resp.StatusCode != tt.statusCode {
+				t.Errorf("status = %d, want %d (body %q)", resp.StatusCode, tt.statusCode, resp.Body)
+			}
+			if !strings.Contains(resp.Body, tt.body) {
+				t.Errorf("body = %q, want it to contain %q", resp.Body, tt.body)
+			}
+			if tt.check != nil {
+				tt.check(t, c)
+			}
+		})
+	}
+}
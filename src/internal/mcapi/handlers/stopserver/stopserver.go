@@ -0,0 +1,372 @@
+// Package stopserver stops the minecraft server, either on request or when the
+// auto-stop timer runs out. Players are warned ahead of a scheduled stop, and
+// the server is shut down gracefully before its instance is stopped. That can
+// take longer than API Gateway waits, so a requested stop only moves the server
+// to stopping and hands the rest to an asynchronous invocation of the function.
+// A timer running out while players are online puts the stop off by a bounded
+// grace period, depending on the online policy, and a server nobody is using
+// can be stopped early. Stopping a server that is already stopped is a no-op,
+// and a stop that failed part way can be retried.
+package stopserver
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"mcapi"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// StopSource is the source of the asynchronous invocation a requested stop is
+// handed to
+const StopSource = "mcapi.stopServer"
+
+// Event is either a scheduled cloudwatch event or the asynchronous invocation
+// of a requested stop, identified by their source, or an API Gateway proxy
+// request from the /stop endpoint
+type Event struct {
+	Source string `json:"source"`
+	// Actor is who requested the stop handed to an asynchronous invocation
+	Actor *mcapi.Actor `json:"actor,omitempty"`
+	events.APIGatewayProxyRequest
+}
+
+// stopRequest is the event of the asynchronous invocation a requested stop is
+// handed to, unmarshalled into an Event
+type stopRequest struct {
+	Source string       `json:"source"`
+	Actor  *mcapi.Actor `json:"actor,omitempty"`
+}
+
+// Handler stops the minecraft server using the injected AWS clients
+type Handler struct {
+	Config  *mcapi.Config
+	Clients *mcapi.Clients
+	State   mcapi.StateStore
+}
+
+// return true if current time is past scheduled stop time, or the server has
+// been idle too long. The stop only fires once, so if it fired early it
+// broadcasts the shutdown warning due, if any, and is scheduled again for the
+// stop time, the next idle check or the next warning.
+func (h *Handler) isScheduledToStop() (bool, error) {
+	fmt.Println("Scheduled to stop, checking stop time...")
+	fmt.Println("keyName:", h.Config.TimerKeyName)
+	stopTime, err := mcapi.GetStopTime(h.Config, h.State)
+	if err != nil {
+		return false, err
+	}
+	now := time.Now()
+	if !now.Before(stopTime) {
+		return true, nil
+	}
+
+	next := stopTime
+	if h.Config.IdleTimeout > 0 {
+		idle, check, err := h.checkIdle(now)
+		if err != nil {
+			return false, err
+		}
+		if idle {
+			return true, nil
+		}
+		if check.Before(next) {
+			next = check
+		}
+	}
+	h.warn(now, stopTime)
+	if warning, ok := mcapi.NextWarning(h.Config, now, stopTime); ok && warning.Before(next) {
+		next = warning
+	}
+	fmt.Println("Not yet scheduled to stop, rescheduling for", next.Unix())
+	return false, h.Clients.Scheduler.Schedule(next)
+}
+
+// warn broadcasts the shutdown warning due for stopTime, if it was not already,
+// and records it in the session. Warnings are only a courtesy, so failures are
+// only logged.
+func (h *Handler) warn(now, stopTime time.Time) {
+	session, err := mcapi.GetSession(h.Config, h.State)
+	if err != nil && !errors.Is(err, mcapi.ErrStateNotFound) {
+		fmt.Println("WARNING: could not read session, skipping shutdown warning:", err)
+		return
+	}
+	due, ok := mcapi.DueWarning(h.Config, now, stopTime, session.Warnings)
+	if !ok {
+		return
+	}
+	// the warning can go out late, so tell the time actually left
+	message := mcapi.WarningMessage(stopTime.Sub(now))
+	fmt.Println("Broadcasting:", message)
+	warning := mcapi.Warning{StopTime: stopTime.Unix(), Minutes: int(due / time.Minute), SentAt: now.Unix()}
+	err = mcapi.Broadcast(h.Config, h.Clients, message)
+	if err != nil {
+		fmt.Println("WARNING: could not broadcast shutdown warning:", err)
+		warning.Error = err.Error()
+	}
+	session.Warnings = append(session.Warnings, warning)
+	err = mcapi.PutSession(h.Config, h.State, session)
+	if err != nil {
+		fmt.Println("WARNING: could not record shutdown warning:", err)
+	}
+}
+
+// checkIdle reports whether nobody has been online for the idle timeout, since
+// the session started or the last player logged out. If not, it returns when
+// to check again.
+func (h *Handler) checkIdle(now time.Time) (bool, time.Time, error) {
+	retry := now.Add(h.Config.IdleTimeout)
+	session, err := mcapi.GetSession(h.Config, h.State)
+	if errors.Is(err, mcapi.ErrStateNotFound) {
+		fmt.Println("No session start time, skipping idle check")
+		return false, retry, nil
+	}
+	if err != nil {
+		return false, time.Time{}, err
+	}
+	logins, err := mcapi.GetLogins(h.Config, h.Clients.DynamoDB)
+	if err != nil {
+		// unlike the stop time, an idle stop is only a saving, so it waits
+		// until the logins can be read
+		fmt.Println("WARNING: could not check for idle server, keeping it running:", err)
+		return false, retry, nil
+	}
+
+	lastActive := time.Unix(session.StartTime, 0)
+	for _, l := range logins {
+		if l.Online() {
+			fmt.Println("Server not idle,", l.Username, "is online")
+			return false, retry, nil
+		}
+		if logout := time.Unix(int64(l.LogoutTime), 0); logout.After(lastActive) {
+			lastActive = logout
+		}
+	}
+	deadline := lastActive.Add(h.Config.IdleTimeout)
+	if !now.Before(deadline) {
+		fmt.Println("Server idle since", lastActive.Unix(), "for over", h.Config.IdleTimeout, "stopping early")
+		return true, deadline, nil
+	}
+	fmt.Println("Server idle since", lastActive.Unix(), "stopping at", deadline.Unix(), "if nobody logs in")
+	return false, deadline, nil
+}
+
+// putOffForPlayers puts a scheduled stop off by the grace period if players are
+// online and the online policy allows it, returning the new stop time. It
+// returns false if the server should stop now.
+func (h *Handler) putOffForPlayers(now time.Time) (time.Time, bool, error) {
+	players, err := mcapi.OnlinePlayers(h.Config, h.Clients.DynamoDB)
+	if err != nil {
+		// not knowing who is online must not keep the server running forever
+		fmt.Println("WARNING: could not check for online players, stopping anyway:", err)
+		return time.Time{}, false, nil
+	}
+	if len(players) == 0 {
+		return time.Time{}, false, nil
+	}
+	if h.Config.OnlinePolicy == mcapi.OnlinePolicyStop {
+		fmt.Println("WARNING: stopping with players online:", players)
+		return time.Time{}, false, nil
+	}
+
+	session, err := mcapi.GetSession(h.Config, h.State)
+	if err != nil && !errors.Is(err, mcapi.ErrStateNotFound) {
+		return time.Time{}, false, err
+	}
+	if session.GraceExtensions >= h.Config.MaxGraceExtensions {
+		fmt.Println("WARNING: stop already put off", session.GraceExtensions, "times, stopping with players online:", players)
+		return time.Time{}, false, nil
+	}
+
+	stopTime, _ := mcapi.ClampStopTime(h.Config, now, now.Add(h.Config.GracePeriod))
+	fmt.Println("Players online:", players, "putting stop off until", stopTime.Unix())
+	err = mcapi.PutStopTime(h.Config, h.State, stopTime)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	// players are warned again ahead of the new stop time
+	err = h.Clients.Scheduler.Schedule(mcapi.CheckTime(h.Config, now, stopTime))
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	session.GraceExtensions++
+	err = mcapi.PutSession(h.Config, h.State, session)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	return stopTime, true, nil
+}
+
+// shutdown gracefully shuts the minecraft server down on the instance, so the
+// world is saved before the instance stops. The instance is stopped whether or
+// not it worked, so failures are only logged.
+func (h *Handler) shutdown() {
+	if h.Config.ShutdownDocument == "" {
+		return
+	}
+	var commands []string
+	if h.Config.ShutdownCommand != "" {
+		commands = []string{h.Config.ShutdownCommand}
+	}
+	fmt.Println("Shutting down minecraft server...")
+	err := h.Clients.Commands.Run(h.Config.ShutdownDocument, commands, h.Config.ShutdownTimeout)
+	if err != nil {
+		fmt.Println("WARNING: graceful shutdown failed, stopping anyway:", err)
+	}
+}
+
+// endSession records when and why the session ended, and who ended it if it
+// was stopped on request. Sessions started before they were tracked only get
+// their end.
+func (h *Handler) endSession(stopTime time.Time, reason string, actor *mcapi.Actor) error {
+	session, err := mcapi.GetSession(h.Config, h.State)
+	if err != nil && !errors.Is(err, mcapi.ErrStateNotFound) {
+		return err
+	}
+	session.StopTime = stopTime.Unix()
+	session.StopReason = reason
+	session.StoppedBy = actor
+	return mcapi.PutSession(h.Config, h.State, session)
+}
+
+// Handle is main entry point to lambda function
+func (h *Handler) Handle(request Event) (events.APIGatewayProxyResponse, error) {
+	fmt.Println("Event:", request)
+	respond := mcapi.NewResponder(h.Config, request.APIGatewayProxyRequest)
+
+	// the instance may have been started outside the API, so it is checked
+	// rather than taking a stored stopped for granted
+	lifecycle, err := mcapi.SyncLifecycle(h.Config, h.Clients.EC2, h.State)
+	if err != nil {
+		return respond.Error(err), nil
+	}
+	fmt.Println("lifecycle:", lifecycle)
+	if lifecycle == mcapi.LifecycleStopped {
+		return respond.OK(mcapi.TransitionResult{From: lifecycle, To: lifecycle}), nil
+	}
+
+	switch request.Source {
+	case "aws.events":
+		// if lambda was triggered by scheduled event, first check to see if
+		// server is scheduuled to stop yet
+		shouldStop, err := h.isScheduledToStop()
+		if err != nil {
+			return respond.Error(err), nil
+		}
+
+		if !shouldStop {
+			return respond.OK("Not yet scheduled to stop"), nil
+		}
+
+		// a timer running out should not kick players mid-session
+		stopTime, putOff, err := h.putOffForPlayers(time.Now())
+		if err != nil {
+			return respond.Error(err), nil
+		}
+		if putOff {
+			return respond.OK(fmt.Sprintf("Players online, stop put off until %d", stopTime.Unix())), nil
+		}
+		return h.stop(respond, lifecycle, mcapi.LogoutScheduled, nil)
+	case StopSource:
+		return h.stop(respond, lifecycle, mcapi.LogoutManual, request.Actor)
+	}
+	return h.requestStop(respond, lifecycle, request.APIGatewayProxyRequest)
+}
+
+// requestStop moves the server to stopping and hands the stop itself to an
+// asynchronous invocation, responding with 202 straight away. A server left
+// stopping is handed over again, so a stop that failed can be retried.
+func (h *Handler) requestStop(respond *mcapi.Responder, lifecycle mcapi.Lifecycle, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	if lifecycle != mcapi.LifecycleStopping {
+		err := mcapi.Transition(h.Config, h.State, lifecycle, mcapi.LifecycleStopping)
+		if err != nil {
+			return respond.Error(err), nil
+		}
+	}
+
+	actor := mcapi.RequestActor(h.Config, h.Clients.DynamoDB, request)
+	if actor != nil {
+		fmt.Println("Stop requested by", actor.CognitoUser)
+	}
+	err := h.Clients.Invoker.Invoke(h.Config.FunctionName, stopRequest{Source: StopSource, Actor: actor})
+	if err != nil {
+		return respond.Error(err), nil
+	}
+	return respond.Accepted(mcapi.TransitionResult{From: lifecycle, To: mcapi.LifecycleStopping, Changed: true}), nil
+}
+
+// stop shuts the server down, stops its instance and cleans up after the
+// session, moving the server from stopping to stopped. Sessions still open are
+// closed with reason, and the session is recorded as stopped by actor, if any.
+func (h *Handler) stop(respond *mcapi.Responder, lifecycle mcapi.Lifecycle, reason string, actor *mcapi.Actor) (events.APIGatewayProxyResponse, error) {
+	// a server left stopping by a failed stop is already there, so just run
+	// through the stop again
+	if lifecycle != mcapi.LifecycleStopping {
+		err := mcapi.Transition(h.Config, h.State, lifecycle, mcapi.LifecycleStopping)
+		if err != nil {
+			return respond.Error(err), nil
+		}
+	}
+
+	h.shutdown()
+
+	fmt.Println("Stopping instance", h.Config.ServerID, "...")
+	input := &ec2.StopInstancesInput{
+		InstanceIds: []*string{
+			aws.String(h.Config.ServerID),
+		},
+	}
+	result, err := h.Clients.EC2.StopInstances(input)
+	if err != nil {
+		return respond.Error(err), nil
+	}
+	if len(result.StoppingInstances) < 1 {
+		err = mcapi.NewError(mcapi.CodeNotFound, "Could not find instance with ID %s", h.Config.ServerID)
+		return respond.Error(err), nil
+	}
+	fmt.Println("status:", result.StoppingInstances)
+
+	// nobody can stay logged in to a stopped server. Sessions left open are
+	// only bookkeeping, so failing to close them does not fail the stop.
+	if actor != nil {
+		fmt.Println("Stopped by", actor.CognitoUser)
+	}
+	stopTime := time.Now()
+	_, err = mcapi.CloseOpenSessions(h.Config, h.Clients.DynamoDB, stopTime, reason)
+	if err != nil {
+		fmt.Println("WARNING: could not close open sessions:", err)
+	}
+
+	// if server is successfully stopped, cancel the scheduled stop
+	err = h.Clients.Scheduler.Cancel()
+	if err != nil {
+		return respond.Error(err), nil
+	}
+
+	// the session is kept as the last one, for the backup taken once the
+	// instance has stopped
+	err = h.endSession(stopTime, reason, actor)
+	if err != nil {
+		return respond.Error(err), nil
+	}
+
+	// then delete state values, just to clean everything up
+	for _, keyName := range []string{h.Config.TimerKeyName, h.Config.ServerStatusKeyName} {
+		err = h.State.Delete(keyName)
+		if err != nil && !errors.Is(err, mcapi.ErrStateNotFound) {
+			return respond.Error(err), nil
+		}
+	}
+
+	err = mcapi.Transition(h.Config, h.State, mcapi.LifecycleStopping, mcapi.LifecycleStopped)
+	if err != nil {
+		return respond.Error(err), nil
+	}
+
+	return respond.OK(mcapi.TransitionResult{From: lifecycle, To: mcapi.LifecycleStopped, Changed: true}), nil
+}
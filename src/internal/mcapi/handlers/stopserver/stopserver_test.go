@@ -0,0 +1,691 @@
+package stopserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"mcapi"
+	"mcapi/mcapitest"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// running sets up a running server with an armed stop timer
+func running(stopTime int64) func(c *mcapitest.Clients) {
+	return func(c *mcapitest.Clients) {
+		cfg := mcapitest.Config()
+		c.EC2.SetState(cfg.ServerID, "running")
+		c.SSM.Set(cfg.TimerKeyName, strconv.FormatInt(stopTime, 10))
+		c.SSM.Set(cfg.ServerStatusKeyName, "started")
+		c.SSM.Set(cfg.LifecycleKeyName, "started")
+		c.SSM.Set(cfg.SessionKeyName, `{"startTime": 1000, "extensions": 0}`)
+		c.Scheduler.Schedule(time.Unix(stopTime, 0))
+	}
+}
+
+// login records a player's latest session in the login table. A zero logout
+// time leaves the session open.
+func login(username string, loginTime, logoutTime int64) func(c *mcapitest.Clients) {
+	return func(c *mcapitest.Clients) {
+		item := map[string]*dynamodb.AttributeValue{
+			"PK":        {S: aws.String(username)},
+			"SK":        {S: aws.String(mcapi.LoginVersion)},
+			"LoginTime": {N: aws.String(strconv.FormatInt(loginTime, 10))},
+		}
+		if logoutTime != 0 {
+			item["LogoutTime"] = &dynamodb.AttributeValue{N: aws.String(strconv.FormatInt(logoutTime, 10))}
+		}
+		c.DynamoDB.Put(mcapitest.Config().UserLoginTableName, item)
+	}
+}
+
+// session replaces the session of a running server with one started at
+// startTime
+func session(startTime int64) func(c *mcapitest.Clients) {
+	return func(c *mcapitest.Clients) {
+		c.SSM.Set(mcapitest.Config().SessionKeyName, fmt.Sprintf(`{"startTime": %d, "extensions": 0}`, startTime))
+	}
+}
+
+// idle enables the idle stop after 15 minutes
+func idle(cfg *mcapi.Config) {
+	cfg.IdleTimeout = 15 * time.Minute
+}
+
+// loggedOut checks username's session was closed with reason
+func loggedOut(username, reason string) func(t *testing.T, c *mcapitest.Clients) {
+	return func(t *testing.T, c *mcapitest.Clients) {
+		var logins []mcapi.DynamoDbItem
+		if err := dynamodbattribute.UnmarshalListOfMaps(c.DynamoDB.Items(mcapitest.Config().UserLoginTableName), &logins); err != nil {
+			t.Fatal(err)
+		}
+		for _, l := range logins {
+			if l.PK != username || l.SK != mcapi.LoginVersion {
+				continue
+			}
+			if l.Online() || l.LogoutReason != reason {
+				t.Errorf("%s online %t with logout reason %q, want logged out with %q", username, l.Online(), l.LogoutReason, reason)
+			}
+			return
+		}
+		t.Errorf("no session of %s", username)
+	}
+}
+
+// all runs each setup in turn
+func all(setups ...func(c *mcapitest.Clients)) func(c *mcapitest.Clients) {
+	return func(c *mcapitest.Clients) {
+		for _, setup := range setups {
+			setup(c)
+		}
+	}
+}
+
+// handOver checks a requested stop was accepted and handed to a single
+// asynchronous invocation, then runs that and returns its response
+func handOver(t *testing.T, h *Handler, resp events.APIGatewayProxyResponse, invocations []mcapitest.Invocation) events.APIGatewayProxyResponse {
+	t.Helper()
+	if resp.StatusCode != 202 {
+		t.Fatalf("status = %d, want 202 (body %q)", resp.StatusCode, resp.Body)
+	}
+	if got, _ := h.State.Get(h.Config.LifecycleKeyName); got != "stopping" {
+		t.Errorf("lifecycle = %q when accepted, want stopping", got)
+	}
+	if len(invocations) != 1 || invocations[0].Function != h.Config.FunctionName {
+		t.Fatalf("invocations = %v, want one of %s", invocations, h.Config.FunctionName)
+	}
+	var event Event
+	if err := json.Unmarshal(invocations[0].Payload, &event); err != nil {
+		t.Fatal(err)
+	}
+	if event.Source != StopSource {
+		t.Errorf("handed over with source %q, want %q", event.Source, StopSource)
+	}
+	resp, err := h.Handle(event)
+	if err != nil {
+		t.Fatalf("Handle of handed over stop returned error: %v", err)
+	}
+	return resp
+}
+
+func TestHandle(t *testing.T) {
+	cfg := mcapitest.Config()
+	past := time.Now().Unix() - 60
+	future := time.Now().Unix() + 3600
+	tests := []struct {
+		name   string
+		event  Event
+		config func(cfg *mcapi.Config)
+		setup  func(c *mcapitest.Clients)
+		// accepted requests are handed to an asynchronous invocation, whose
+		// response is checked against statusCode and body
+		accepted   bool
+		statusCode int
+		body       string
+		stopped    bool
+		check      func(t *testing.T, c *mcapitest.Clients)
+	}{
+		{
+			name:       "manual stop cleans up",
+			accepted:   true,
+			setup:      running(future),
+			statusCode: 200,
+			body:       "success",
+			stopped:    true,
+		},
+		{
+			name:     "manual stop records the signed in user",
+			accepted: true,
+			event: Event{APIGatewayProxyRequest: events.APIGatewayProxyRequest{
+				RequestContext: events.APIGatewayProxyRequestContext{
+					Authorizer: map[string]interface{}{
+						"claims": map[string]interface{}{"sub": "sub-alice", "cognito:username": "alice"},
+					},
+				},
+			}},
+			setup:      running(future),
+			statusCode: 200,
+			body:       "success",
+			stopped:    true,
+			check: func(t *testing.T, c *mcapitest.Clients) {
+				if got, _ := c.SSM.Get(cfg.SessionKeyName); !strings.Contains(got, `"stoppedBy":{"cognitoUser":"alice"}`) {
+					t.Errorf("session = %q, want it stopped by alice", got)
+				}
+			},
+		},
+		{
+			name:       "scheduled stop before stop time",
+			event:      Event{Source: "aws.events"},
+			setup:      running(future),
+			statusCode: 200,
+			body:       "Not yet scheduled to stop",
+		},
+		{
+			name:  "scheduled stop fired early is rescheduled",
+			event: Event{Source: "aws.events"},
+			setup: func(c *mcapitest.Clients) {
+				running(future)(c)
+				c.Scheduler.Cancel()
+			},
+			statusCode: 200,
+			body:       "Not yet scheduled to stop",
+			check: func(t *testing.T, c *mcapitest.Clients) {
+				if at, ok := c.Scheduler.At(); !ok || at.Unix() != future {
+					t.Errorf("stop scheduled at %d (armed %t), want %d", at.Unix(), ok, future)
+				}
+				if c.EC2.Called("StopInstances") {
+					t.Error("server stopped before stop time")
+				}
+			},
+		},
+		{
+			name:       "scheduled stop after stop time",
+			event:      Event{Source: "aws.events"},
+			setup:      running(past),
+			statusCode: 200,
+			body:       "success",
+			stopped:    true,
+		},
+		{
+			name:       "scheduled stop with players online is put off",
+			event:      Event{Source: "aws.events"},
+			setup:      all(running(past), login("steve", past-600, 0), login("alex", past-900, past-300)),
+			statusCode: 200,
+			body:       "Players online, stop put off",
+			check: func(t *testing.T, c *mcapitest.Clients) {
+				if c.EC2.Called("StopInstances") {
+					t.Error("server stopped with players online")
+				}
+				grace := time.Now().Add(cfg.GracePeriod).Unix()
+				if at, ok := c.Scheduler.At(); !ok || at.Unix() < grace-5 || at.Unix() > grace {
+					t.Errorf("stop scheduled at %d (armed %t), want about %d", at.Unix(), ok, grace)
+				}
+				if got, _ := c.SSM.Get(cfg.TimerKeyName); got != strconv.FormatInt(grace, 10) && got != strconv.FormatInt(grace-1, 10) {
+					t.Errorf("stop time = %s, want about %d", got, grace)
+				}
+				if got, _ := c.SSM.Get(cfg.SessionKeyName); !strings.Contains(got, `"graceExtensions":1`) {
+					t.Errorf("session = %s, want one grace extension", got)
+				}
+			},
+		},
+		{
+			name:       "scheduled stop with players logged out",
+			event:      Event{Source: "aws.events"},
+			setup:      all(running(past), login("alex", past-900, past-300)),
+			statusCode: 200,
+			body:       "success",
+			stopped:    true,
+		},
+		{
+			name:  "scheduled stop after max grace extensions",
+			event: Event{Source: "aws.events"},
+			setup: all(running(past), login("steve", past-600, 0), func(c *mcapitest.Clients) {
+				c.SSM.Set(cfg.SessionKeyName, `{"startTime": 1000, "extensions": 0, "graceExtensions": 4}`)
+			}),
+			statusCode: 200,
+			body:       "success",
+			stopped:    true,
+		},
+		{
+			name:       "scheduled stop with stop policy",
+			event:      Event{Source: "aws.events"},
+			config:     func(cfg *mcapi.Config) { cfg.OnlinePolicy = mcapi.OnlinePolicyStop },
+			setup:      all(running(past), login("steve", past-600, 0)),
+			statusCode: 200,
+			body:       "success",
+			stopped:    true,
+		},
+		{
+			name:  "scheduled stop when players cannot be checked",
+			event: Event{Source: "aws.events"},
+			setup: all(running(past), func(c *mcapitest.Clients) {
+				c.DynamoDB.Fail("Query", awserr.New("ResourceNotFoundException", "no table", nil))
+			}),
+			statusCode: 200,
+			body:       "success",
+			stopped:    true,
+		},
+		{
+			name:       "idle server is stopped early",
+			event:      Event{Source: "aws.events"},
+			config:     idle,
+			setup:      all(running(future), session(past-1200), login("alex", past-3600, past-3000)),
+			statusCode: 200,
+			body:       "success",
+			stopped:    true,
+		},
+		{
+			name:       "idle check with players online",
+			event:      Event{Source: "aws.events"},
+			config:     idle,
+			setup:      all(running(future), session(past-1200), login("steve", past-600, 0)),
+			statusCode: 200,
+			body:       "Not yet scheduled to stop",
+			check: func(t *testing.T, c *mcapitest.Clients) {
+				if c.EC2.Called("StopInstances") {
+					t.Error("server stopped with players online")
+				}
+				check := time.Now().Add(15 * time.Minute).Unix()
+				if at, ok := c.Scheduler.At(); !ok || at.Unix() < check-5 || at.Unix() > check {
+					t.Errorf("next check at %d (armed %t), want about %d", at.Unix(), ok, check)
+				}
+			},
+		},
+		{
+			name:       "idle check after a recent logout",
+			event:      Event{Source: "aws.events"},
+			config:     idle,
+			setup:      all(running(future), session(past-3600), login("alex", past-1800, past-240)),
+			statusCode: 200,
+			body:       "Not yet scheduled to stop",
+			check: func(t *testing.T, c *mcapitest.Clients) {
+				if at, ok := c.Scheduler.At(); !ok || at.Unix() != past-240+900 {
+					t.Errorf("next check at %d (armed %t), want %d", at.Unix(), ok, past-240+900)
+				}
+			},
+		},
+		{
+			name:   "idle check when logins cannot be read",
+			event:  Event{Source: "aws.events"},
+			config: idle,
+			setup: all(running(future), session(past-1200), func(c *mcapitest.Clients) {
+				c.DynamoDB.Fail("Query", awserr.New("ResourceNotFoundException", "no table", nil))
+			}),
+			statusCode: 200,
+			body:       "Not yet scheduled to stop",
+			check: func(t *testing.T, c *mcapitest.Clients) {
+				if c.EC2.Called("StopInstances") {
+					t.Error("server stopped without knowing it was idle")
+				}
+			},
+		},
+		{
+			name:       "manual stop with players online",
+			accepted:   true,
+			setup:      all(running(future), login("steve", past-600, 0)),
+			statusCode: 200,
+			body:       "success",
+			stopped:    true,
+			check:      loggedOut("steve", mcapi.LogoutManual),
+		},
+		{
+			name:       "shuts the server down before stopping",
+			accepted:   true,
+			setup:      running(future),
+			statusCode: 200,
+			body:       "success",
+			stopped:    true,
+			check: func(t *testing.T, c *mcapitest.Clients) {
+				ran := c.Commands.Ran()
+				if len(ran) != 1 || strings.Join(ran[0], " ") != "AWS-RunShellScript systemctl stop minecraft" {
+					t.Errorf("ran %v, want the shutdown command", ran)
+				}
+			},
+		},
+		{
+			name:       "graceful shutdown disabled",
+			accepted:   true,
+			config:     func(cfg *mcapi.Config) { cfg.ShutdownDocument = "" },
+			setup:      running(future),
+			statusCode: 200,
+			body:       "success",
+			stopped:    true,
+			check: func(t *testing.T, c *mcapitest.Clients) {
+				if c.Commands.Called("Run") {
+					t.Error("shutdown command run while disabled")
+				}
+			},
+		},
+		{
+			name:     "graceful shutdown fails",
+			accepted: true,
+			setup: all(running(future), func(c *mcapitest.Clients) {
+				c.Commands.Fail("Run", awserr.New("InvalidInstanceId", "not connected", nil))
+			}),
+			statusCode: 200,
+			body:       "success",
+			stopped:    true,
+		},
+		{
+			name:       "scheduled stop logs players out",
+			event:      Event{Source: "aws.events"},
+			config:     func(cfg *mcapi.Config) { cfg.OnlinePolicy = mcapi.OnlinePolicyStop },
+			setup:      all(running(past), login("steve", past-600, 0)),
+			statusCode: 200,
+			body:       "success",
+			stopped:    true,
+			check:      loggedOut("steve", mcapi.LogoutScheduled),
+		},
+		{
+			name:     "closing sessions fails",
+			accepted: true,
+			setup: all(running(future), login("steve", past-600, 0), func(c *mcapitest.Clients) {
+				c.DynamoDB.Fail("TransactWriteItems", awserr.New("AccessDeniedException", "denied", nil))
+			}),
+			statusCode: 200,
+			body:       "success",
+			stopped:    true,
+		},
+		{
+			name:  "scheduled stop without timer",
+			event: Event{Source: "aws.events"},
+			setup: func(c *mcapitest.Clients) {
+				c.EC2.SetState(cfg.ServerID, "running")
+				c.SSM.Set(cfg.LifecycleKeyName, "started")
+			},
+			statusCode: 404,
+			body:       "state not found",
+		},
+		{
+			name: "already stopped is a no-op",
+			setup: func(c *mcapitest.Clients) {
+				c.EC2.SetState(cfg.ServerID, "stopped")
+			},
+			statusCode: 200,
+			body:       "Server is already stopped",
+			check: func(t *testing.T, c *mcapitest.Clients) {
+				if c.EC2.Called("StopInstances") {
+					t.Error("stopped server was stopped again")
+				}
+			},
+		},
+		{
+			name:  "scheduled stop of stopped server is a no-op",
+			event: Event{Source: "aws.events"},
+			setup: func(c *mcapitest.Clients) {
+				c.EC2.SetState(cfg.ServerID, "stopped")
+			},
+			statusCode: 200,
+			body:       "Server is already stopped",
+		},
+		{
+			name:     "started outside the API is stopped",
+			accepted: true,
+			setup: func(c *mcapitest.Clients) {
+				c.EC2.SetState(cfg.ServerID, "running")
+				c.SSM.Set(cfg.LifecycleKeyName, "stopped")
+			},
+			statusCode: 200,
+			body:       "success",
+			stopped:    true,
+		},
+		{
+			name:     "state lost while running is stopped",
+			accepted: true,
+			setup: func(c *mcapitest.Clients) {
+				c.EC2.SetState(cfg.ServerID, "running")
+			},
+			statusCode: 200,
+			body:       "success",
+			stopped:    true,
+		},
+		{
+			name:     "stop while starting",
+			accepted: true,
+			setup: func(c *mcapitest.Clients) {
+				c.EC2.SetState(cfg.ServerID, "pending")
+				c.SSM.Set(cfg.LifecycleKeyName, "starting")
+				c.SSM.Set(cfg.TimerKeyName, strconv.FormatInt(future, 10))
+			},
+			statusCode: 200,
+			body:       "success",
+			stopped:    true,
+		},
+		{
+			name:     "retries a stop left stopping",
+			accepted: true,
+			setup: func(c *mcapitest.Clients) {
+				c.EC2.SetState(cfg.ServerID, "running")
+				c.SSM.Set(cfg.LifecycleKeyName, "stopping")
+			},
+			statusCode: 200,
+			body:       "success",
+			stopped:    true,
+		},
+		{
+			name: "unknown instance",
+			setup: func(c *mcapitest.Clients) {
+				c.SSM.Set(cfg.LifecycleKeyName, "started")
+			},
+			statusCode: 404,
+			body:       "Could not find instance",
+		},
+		{
+			name:     "stop fails",
+			accepted: true,
+			setup: func(c *mcapitest.Clients) {
+				running(future)(c)
+				c.EC2.Fail("StopInstances", awserr.New("UnauthorizedOperation", "denied", nil))
+			},
+			statusCode: 403,
+			body:       "UnauthorizedOperation",
+		},
+		{
+			name: "handing over fails",
+			setup: func(c *mcapitest.Clients) {
+				running(future)(c)
+				c.Invoker.Fail("Invoke", awserr.New("TooManyRequestsException", "slow down", nil))
+			},
+			statusCode: 429,
+			body:       "TooManyRequestsException",
+			check: func(t *testing.T, c *mcapitest.Clients) {
+				if c.EC2.Called("StopInstances") {
+					t.Error("instance stopped by the request itself")
+				}
+				if got, _ := c.SSM.Get(cfg.LifecycleKeyName); got != "stopping" {
+					t.Errorf("lifecycle = %q, want stopping so the stop can be retried", got)
+				}
+			},
+		},
+		{
+			name:     "nothing scheduled is tolerated",
+			accepted: true,
+			setup: func(c *mcapitest.Clients) {
+				c.EC2.SetState(cfg.ServerID, "running")
+				c.SSM.Set(cfg.LifecycleKeyName, "started")
+			},
+			statusCode: 200,
+			body:       "success",
+			stopped:    true,
+		},
+		{
+			name:     "cancelling scheduled stop fails",
+			accepted: true,
+			setup: func(c *mcapitest.Clients) {
+				running(future)(c)
+				c.Scheduler.Fail("Cancel", awserr.New("AccessDeniedException", "denied", nil))
+			},
+			statusCode: 403,
+			body:       "AccessDeniedException",
+			check: func(t *testing.T, c *mcapitest.Clients) {
+				if got, _ := c.SSM.Get(cfg.LifecycleKeyName); got != "stopping" {
+					t.Errorf("lifecycle = %q, want stopping so the stop can be retried", got)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := mcapitest.NewClients()
+			if tt.setup != nil {
+				tt.setup(c)
+			}
+			cfg := mcapitest.Config()
+			if tt.config != nil {
+				tt.config(cfg)
+			}
+			h := &Handler{Config: cfg, Clients: c.Clients(), State: mcapi.NewSSMStateStore(cfg, c.SSM)}
+
+			resp, err := h.Handle(tt.event)
+			if err != nil {
+				t.Fatalf("Handle returned error: %v", err)
+			}
+			invocations := c.Invoker.Take()
+			if tt.accepted {
+				resp = handOver(t, h, resp, invocations)
+			} else if len(invocations) > 0 {
+				t.Errorf("stop handed over %d times, want it run straight away", len(invocations))
+			}
+			if resp.StatusCode != tt.statusCode {
+				t.Errorf("status = %d, want %d (body %q)", resp.StatusCode, tt.statusCode, resp.Body)
+			}
+			if !strings.Contains(resp.Body, tt.body) {
+				t.Errorf("body = %q, want it to contain %q", resp.Body, tt.body)
+			}
+			if tt.check != nil {
+				tt.check(t, c)
+			}
+			if !tt.stopped {
+				return
+			}
+			if got := c.EC2.State(cfg.ServerID); got != "stopping" {
+				t.Errorf("instance state = %q, want stopping", got)
+			}
+			if _, ok := c.Scheduler.At(); ok {
+				t.Error("scheduled stop not cancelled")
+			}
+			for _, keyName := range []string{cfg.TimerKeyName, cfg.ServerStatusKeyName} {
+				if _, ok := c.SSM.Get(keyName); ok {
+					t.Errorf("parameter %s not deleted", keyName)
+				}
+			}
+			if got, _ := c.SSM.Get(cfg.SessionKeyName); !strings.Contains(got, `"stopTime":`) || !strings.Contains(got, `"stopReason":`) {
+				t.Errorf("session = %q, want it ended", got)
+			}
+			if got, _ := c.SSM.Get(cfg.LifecycleKeyName); got != "stopped" {
+				t.Errorf("lifecycle = %q, want stopped", got)
+			}
+		})
+	}
+}
+
+func TestHandleWarnings(t *testing.T) {
+	cfg := mcapitest.Config()
+	// a few seconds inside the ten minute warning
+	stopTime := time.Now().Add(10*time.Minute - 5*time.Second).Unix()
+	// well inside it, as when the check before it ran late
+	lateStopTime := time.Now().Add(8 * time.Minute).Unix()
+	warnings := func(cfg *mcapi.Config) {
+		cfg.ShutdownWarnings = mcapi.DefaultShutdownWarnings
+	}
+	tests := []struct {
+		name      string
+		config    func(cfg *mcapi.Config)
+		setup     func(c *mcapitest.Clients)
+		body      string
+		commands  []string
+		scheduled int64
+		session   string
+	}{
+		{
+			name:      "broadcasts the warning due",
+			config:    warnings,
+			setup:     running(stopTime),
+			body:      "Not yet scheduled to stop",
+			commands:  []string{"say Server stopping in 10 minutes"},
+			scheduled: stopTime - 300,
+			session:   fmt.Sprintf(`"warnings":[{"stopTime":%d,"minutes":10,`, stopTime),
+		},
+		{
+			name:      "late warning tells the time left",
+			config:    warnings,
+			setup:     running(lateStopTime),
+			body:      "Not yet scheduled to stop",
+			commands:  []string{"say Server stopping in 8 minutes"},
+			scheduled: lateStopTime - 300,
+			session:   fmt.Sprintf(`"warnings":[{"stopTime":%d,"minutes":10,`, lateStopTime),
+		},
+		{
+			name:   "warning already broadcast",
+			config: warnings,
+			setup: all(running(stopTime), func(c *mcapitest.Clients) {
+				c.SSM.Set(cfg.SessionKeyName, fmt.Sprintf(`{"startTime": 1000, "warnings": [{"stopTime": %d, "minutes": 10, "sentAt": 1000}]}`, stopTime))
+			}),
+			body:      "Not yet scheduled to stop",
+			scheduled: stopTime - 300,
+		},
+		{
+			name:   "warning of an earlier stop time is broadcast again",
+			config: warnings,
+			setup: all(running(stopTime), func(c *mcapitest.Clients) {
+				c.SSM.Set(cfg.SessionKeyName, fmt.Sprintf(`{"startTime": 1000, "warnings": [{"stopTime": %d, "minutes": 10, "sentAt": 1000}]}`, stopTime-900))
+			}),
+			body:      "Not yet scheduled to stop",
+			commands:  []string{"say Server stopping in 10 minutes"},
+			scheduled: stopTime - 300,
+		},
+		{
+			name:   "broadcast fails",
+			config: warnings,
+			setup: all(running(stopTime), func(c *mcapitest.Clients) {
+				c.RCON.Fail("Command", mcapi.NewError(mcapi.CodeUnavailable, "RCON"))
+			}),
+			body:      "Not yet scheduled to stop",
+			scheduled: stopTime - 300,
+			session:   `"error":"RCON"`,
+		},
+		{
+			name: "warnings disabled",
+			config: func(cfg *mcapi.Config) {
+				warnings(cfg)
+				cfg.ShutdownWarnings = nil
+			},
+			setup:     running(stopTime),
+			body:      "Not yet scheduled to stop",
+			scheduled: stopTime,
+		},
+		{
+			name: "nothing to broadcast with",
+			config: func(cfg *mcapi.Config) {
+				warnings(cfg)
+				cfg.RCONPasswordParameter = ""
+			},
+			setup:     running(stopTime),
+			body:      "Not yet scheduled to stop",
+			scheduled: stopTime,
+		},
+		{
+			name:      "stop put off for players is warned of again",
+			config:    warnings,
+			setup:     all(running(time.Now().Unix()-60), login("steve", 1000, 0)),
+			body:      "Players online, stop put off",
+			scheduled: time.Now().Add(cfg.GracePeriod - 10*time.Minute).Unix(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := mcapitest.NewClients()
+			tt.setup(c)
+			cfg := mcapitest.Config()
+			tt.config(cfg)
+			h := &Handler{Config: cfg, Clients: c.Clients(), State: mcapi.NewSSMStateStore(cfg, c.SSM)}
+
+			resp, err := h.Handle(Event{Source: "aws.events"})
+			if err != nil {
+				t.Fatalf("Handle returned error: %v", err)
+			}
+			if resp.StatusCode != 200 || !strings.Contains(resp.Body, tt.body) {
+				t.Errorf("response = %d %q, want 200 containing %q", resp.StatusCode, resp.Body, tt.body)
+			}
+			if got := c.RCON.Commands(); fmt.Sprint(got) != fmt.Sprint(tt.commands) {
+				t.Errorf("RCON commands = %q, want %q", got, tt.commands)
+			}
+			if at, ok := c.Scheduler.At(); !ok || at.Unix() < tt.scheduled-1 || at.Unix() > tt.scheduled {
+				t.Errorf("stop scheduled at %d (armed %t), want %d", at.Unix(), ok, tt.scheduled)
+			}
+			if got, _ := c.SSM.Get(cfg.SessionKeyName); !strings.Contains(got, tt.session) {
+				t.Errorf("session = %s, want it to contain %s", got, tt.session)
+			}
+		})
+	}
+}
@@ -0,0 +1,183 @@
+// Package updatetimer updates the scheduled stop time of the minecraft server.
+// The new stop time is worked out here from the requested operation, never
+// taken from the client as is.
+package updatetimer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"mcapi"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// Timer operations
+const (
+	// OpExtend pushes the stop time back by Minutes, or the configured
+	// extension if unset
+	OpExtend = "extend"
+	// OpSet sets the stop time to StopTime
+	OpSet = "set"
+	// OpReset sets the stop time to a full session from now
+	OpReset = "reset"
+)
+
+// Body to marshal json request into
+type Body struct {
+	Operation string `json:"operation"`
+	// Minutes is the extension for extend
+	Minutes int `json:"minutes"`
+	// StopTime is the unix timestamp for set
+	StopTime int64 `json:"stopTime"`
+	// Value is the unix timestamp sent by the website before operations
+	// existed. It is treated as a set.
+	Value string `json:"value"`
+}
+
+// Result is the updated timer
+type Result struct {
+	Operation string `json:"operation"`
+	StopTime  int64  `json:"stopTime"`
+	// Clamped is true if the stop time was capped at the max session
+	Clamped bool `json:"clamped"`
+}
+
+// LegacyBody implements mcapi.Legacy
+func (r Result) LegacyBody() string {
+	return "success"
+}
+
+// Handler updates the server stop timer using the injected AWS clients
+type Handler struct {
+	Config  *mcapi.Config
+	Clients *mcapi.Clients
+	State   mcapi.StateStore
+}
+
+// parseBody parses and validates the request body
+func parseBody(requestBody string) (Body, error) {
+	var body Body
+	err := json.Unmarshal([]byte(requestBody), &body)
+	if err != nil {
+		return body, mcapi.InvalidRequest(err)
+	}
+	if body.Operation == "" && body.Value != "" {
+		body.Operation = OpSet
+		body.StopTime, err = strconv.ParseInt(body.Value, 10, 64)
+		if err != nil {
+			return body, mcapi.NewError(mcapi.CodeInvalidRequest, "value must be a unix timestamp")
+		}
+	}
+	switch body.Operation {
+	case OpExtend:
+		if body.Minutes < 0 {
+			return body, mcapi.NewError(mcapi.CodeInvalidRequest, "minutes must be positive")
+		}
+	case OpSet:
+		if body.StopTime <= 0 {
+			return body, mcapi.NewError(mcapi.CodeInvalidRequest, "stopTime must be a unix timestamp")
+		}
+	case OpReset:
+	default:
+		return body, mcapi.NewError(mcapi.CodeInvalidRequest, "operation must be one of %s, %s or %s", OpExtend, OpSet, OpReset)
+	}
+	return body, nil
+}
+
+// stopTime works out the new stop time for the operation
+func (h *Handler) stopTime(body Body, now time.Time) (time.Time, error) {
+	switch body.Operation {
+	case OpExtend:
+		current, err := mcapi.GetStopTime(h.Config, h.State)
+		if err != nil {
+			return time.Time{}, err
+		}
+		extension := h.Config.SessionExtension
+		if body.Minutes > 0 {
+			extension = time.Duration(body.Minutes) * time.Minute
+		}
+		// an overdue timer is extended from now rather than from the past
+		if current.Before(now) {
+			current = now
+		}
+		return current.Add(extension), nil
+	case OpSet:
+		stopTime := time.Unix(body.StopTime, 0)
+		if !stopTime.After(now) {
+			return time.Time{}, mcapi.NewError(mcapi.CodeInvalidRequest, "stopTime must be in the future")
+		}
+		return stopTime, nil
+	default:
+		return now.Add(h.Config.SessionLength), nil
+	}
+}
+
+// countExtension adds one to the session's extension count. Sessions started
+// before they were tracked start counting from zero.
+func (h *Handler) countExtension() error {
+	session, err := mcapi.GetSession(h.Config, h.State)
+	if err != nil && !errors.Is(err, mcapi.ErrStateNotFound) {
+		return err
+	}
+	session.Extensions++
+	fmt.Println("extensions:", session.Extensions)
+	return mcapi.PutSession(h.Config, h.State, session)
+}
+
+// Handle is main entry point to lambda function
+func (h *Handler) Handle(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	respond := mcapi.NewResponder(h.Config, request)
+
+	// parse request body
+	body, err := parseBody(request.Body)
+	if err != nil {
+		return respond.Error(err), nil
+	}
+	fmt.Println("operation:", body.Operation)
+
+	// a stopped server has no timer to update, and setting one would not
+	// schedule a stop anyway
+	lifecycle, err := mcapi.GetLifecycle(h.Config, h.State)
+	if err != nil {
+		return respond.Error(err), nil
+	}
+	if lifecycle != mcapi.LifecycleStarting && lifecycle != mcapi.LifecycleStarted {
+		err = mcapi.NewError(mcapi.CodeConflict, "Server is not running (%s)", lifecycle)
+		return respond.Error(err), nil
+	}
+
+	now := time.Now()
+	stopTime, err := h.stopTime(body, now)
+	if err != nil {
+		return respond.Error(err), nil
+	}
+	stopTime, clamped := mcapi.ClampStopTime(h.Config, now, stopTime)
+	fmt.Println("new stop time:", stopTime.Unix(), "clamped:", clamped)
+
+	// set stop time as unix timestamp in the state store
+	err = mcapi.PutStopTime(h.Config, h.State, stopTime)
+	if err != nil {
+		return respond.Error(err), nil
+	}
+	fmt.Println("Set stop time")
+
+	// move the scheduled stop along with the timer, keeping any idle check
+	// due before it
+	err = h.Clients.Scheduler.Schedule(mcapi.CheckTime(h.Config, now, stopTime))
+	if err != nil {
+		return respond.Error(err), nil
+	}
+
+	if body.Operation == OpExtend {
+		err = h.countExtension()
+		if err != nil {
+			return respond.Error(err), nil
+		}
+	}
+
+	return respond.OK(Result{Operation: body.Operation, StopTime: stopTime.Unix(), Clamped: clamped}), nil
+}
@@ -0,0 +1,123 @@
+package updatetimer
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"mcapi"
+	"mcapi/mcapitest"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+func TestHandle(t *testing.T) {
+	cfg := mcapitest.Config()
+	now := time.Now().Unix()
+	tests := []struct {
+		name       string
+		lifecycle  string
+		timer      int64 // seconds from now, unset if 0
+		request    string
+		fail       error
+		failAt     string
+		statusCode int
+		body       string
+		want       int64 // seconds from now the timer should end up at
+		extensions int
+	}{
+		{name: "extend by default", lifecycle: "started", timer: 600, request: `{"operation": "extend"}`, statusCode: 200, body: "success", want: 600 + 1800, extensions: 1},
+		{name: "extend by minutes", lifecycle: "started", timer: 600, request: `{"operation": "extend", "minutes": 10}`, statusCode: 200, body: "success", want: 1200},
+		{name: "extend clamped to max", lifecycle: "started", timer: 6000, request: `{"operation": "extend"}`, statusCode: 200, body: "success", want: 7200},
+		{name: "extend overdue timer from now", lifecycle: "started", timer: -300, request: `{"operation": "extend", "minutes": 5}`, statusCode: 200, body: "success", want: 300},
+		{name: "extend while starting", lifecycle: "starting", timer: 600, request: `{"operation": "extend", "minutes": 5}`, statusCode: 200, body: "success", want: 900},
+		{name: "extend without timer", lifecycle: "started", request: `{"operation": "extend"}`, statusCode: 404, body: "state not found"},
+		{name: "set", lifecycle: "started", timer: 600, request: `{"operation": "set", "stopTime": ` + strconv.FormatInt(now+3600, 10) + `}`, statusCode: 200, body: "success", want: 3600},
+		{name: "set clamped to max", lifecycle: "started", timer: 600, request: `{"operation": "set", "stopTime": ` + strconv.FormatInt(now+86400, 10) + `}`, statusCode: 200, body: "success", want: 7200},
+		{name: "set in the past", lifecycle: "started", timer: 600, request: `{"operation": "set", "stopTime": ` + strconv.FormatInt(now-60, 10) + `}`, statusCode: 400, body: "stopTime must be in the future", want: 600},
+		{name: "legacy value", lifecycle: "started", timer: 600, request: `{"value": "` + strconv.FormatInt(now+3600, 10) + `"}`, statusCode: 200, body: "success", want: 3600},
+		{name: "legacy value not a timestamp", lifecycle: "started", timer: 600, request: `{"value": "soon"}`, statusCode: 400, body: "unix timestamp", want: 600},
+		{name: "reset", lifecycle: "started", timer: 600, request: `{"operation": "reset"}`, statusCode: 200, body: "success", want: 7140},
+		{name: "unknown operation", lifecycle: "started", timer: 600, request: `{"operation": "double"}`, statusCode: 400, body: "operation must be one of", want: 600},
+		{name: "negative minutes", lifecycle: "started", timer: 600, request: `{"operation": "extend", "minutes": -5}`, statusCode: 400, body: "minutes must be positive", want: 600},
+		{name: "malformed body", lifecycle: "started", timer: 600, request: `{"operation": 1}`, statusCode: 400, want: 600},
+		{name: "server stopped", request: `{"operation": "reset"}`, statusCode: 409, body: "Server is not running (stopped)"},
+		{
+			name:       "reschedule fails",
+			lifecycle:  "started",
+			timer:      600,
+			request:    `{"operation": "reset"}`,
+			fail:       awserr.New("ThrottlingException", "slow down", nil),
+			failAt:     "Schedule",
+			statusCode: 429,
+			body:       "ThrottlingException",
+			want:       7140,
+		},
+		{name: "server stopping", lifecycle: "stopping", timer: 600, request: `{"operation": "extend"}`, statusCode: 409, body: "Server is not running (stopping)", want: 600},
+		{
+			name:       "put fails",
+			lifecycle:  "started",
+			timer:      600,
+			request:    `{"operation": "reset"}`,
+			fail:       awserr.New("AccessDeniedException", "denied", nil),
+			statusCode: 403,
+			body:       "AccessDeniedException",
+			want:       600,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := mcapitest.NewClients()
+			if tt.lifecycle != "" {
+				c.SSM.Set(cfg.LifecycleKeyName, tt.lifecycle)
+			}
+			if tt.timer != 0 {
+				c.SSM.Set(cfg.TimerKeyName, strconv.FormatInt(now+tt.timer, 10))
+			}
+			if tt.failAt == "Schedule" {
+				c.Scheduler.Fail("Schedule", tt.fail)
+			} else {
+				c.SSM.Fail("PutParameter", tt.fail)
+			}
+			h := &Handler{Config: cfg, Clients: c.Clients(), State: mcapi.NewSSMStateStore(cfg, c.SSM)}
+
+			resp, err := h.Handle(events.APIGatewayProxyRequest{Body: tt.request})
+			if err != nil {
+				t.Fatalf("Handle returned error: %v", err)
+			}
+			if resp.StatusCode != tt.statusCode {
+				t.Errorf("status = %d, want %d (body %q)", resp.StatusCode, tt.statusCode, resp.Body)
+			}
+			if !strings.Contains(resp.Body, tt.body) {
+				t.Errorf("body = %q, want it to contain %q", resp.Body, tt.body)
+			}
+			if tt.extensions > 0 {
+				session, err := mcapi.GetSession(cfg, h.State)
+				if err != nil || session.Extensions != tt.extensions {
+					t.Errorf("session = %+v, %v, want %d extensions", session, err, tt.extensions)
+				}
+			}
+			value, ok := c.SSM.Get(cfg.TimerKeyName)
+			if tt.want == 0 {
+				if ok {
+					t.Errorf("timer = %q, want it unset", value)
+				}
+				return
+			}
+			stopTime, _ := strconv.ParseInt(value, 10, 64)
+			if d := stopTime - now; d < tt.want-5 || d > tt.want+5 {
+				t.Errorf("stop time is %ds from now, want about %ds", d, tt.want)
+			}
+			at, armed := c.Scheduler.At()
+			if tt.statusCode == 200 && (!armed || at.Unix() != stopTime) {
+				t.Errorf("stop scheduled at %d (armed %t), want %d", at.Unix(), armed, stopTime)
+			}
+			if tt.statusCode != 200 && armed {
+				t.Error("stop rescheduled by failed update")
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+// Package upsertlogin records login sessions in the login table.
+package upsertlogin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"mcapi"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// DynamoDbItem is a login session passed in the request body
+type DynamoDbItem = mcapi.DynamoDbItem
+
+// NewDynamoDbItem Creates and returns new DynamoDbItem
+func NewDynamoDbItem(body string) (*DynamoDbItem, error) {
+	fmt.Println("[NewDynamoDbItem]", "body:", body)
+	var b DynamoDbItem
+	err := json.Unmarshal([]byte(body), &b)
+	if err != nil {
+		fmt.Println("[NewDynamoDbItem]", err)
+		return nil, err
+	}
+
+	fmt.Println("[NewDynamoDbItem]", "Created new DynamoDbItem")
+	fmt.Println("[NewDynamoDbItem]", b)
+	return &b, nil
+}
+
+// NewAttributeValue creates and returns new dynamodb.AttributeValue. This is
+// the object type containing the item data exptected by the dynamodb API
+func NewAttributeValue(b *DynamoDbItem) (map[string]*dynamodb.AttributeValue, error) {
+	item, err := dynamodbattribute.MarshalMap(b)
+	if err != nil {
+		fmt.Println("[NewAttributeValue]", err)
+		return nil, err
+	}
+	fmt.Println("[NewAttributeValue]", "Created item")
+	fmt.Println("[NewAttributeValue", item)
+	return item, nil
+}
+
+// Handler records login sessions using the injected AWS clients
+type Handler struct {
+	Config  *mcapi.Config
+	Clients *mcapi.Clients
+}
+
+// identify keys the session by the player's UUID, as sent by the server or
+// resolved from their name, so the sessions of a renamed player stay together.
+// A name that cannot be resolved keys the session instead, rather than lose it.
+func (h *Handler) identify(item *DynamoDbItem) error {
+	if !mcapi.IsPlayerName(item.Username) {
+		return mcapi.NewError(mcapi.CodeInvalidRequest, "Username must be a minecraft player name, got %q", item.Username)
+	}
+	if item.UUID != "" {
+		uuid, err := mcapi.NormalizeUUID(item.UUID)
+		if err != nil {
+			return err
+		}
+		item.PK = uuid
+		return nil
+	}
+	profile, err := h.Clients.Resolver.Resolve(item.Username)
+	if err != nil {
+		fmt.Println("WARNING: could not resolve", item.Username, "so keying the session by name:", err)
+		item.PK = item.Username
+		return nil
+	}
+	fmt.Println("[identify]", item.Username, "is", profile.UUID)
+	item.PK = profile.UUID
+	return nil
+}
+
+// Handle is the main function for lambda
+func (h *Handler) Handle(ctx context.Context, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	// get item attributes
+	respond := mcapi.NewResponder(h.Config, event)
+	fmt.Println("[Handler]", "Updating table ", h.Config.UserLoginTableName)
+	b, err := NewDynamoDbItem(event.Body)
+	if err != nil {
+		return respond.Error(mcapi.InvalidRequest(err)), nil
+	}
+	err = h.identify(b)
+	if err != nil {
+		return respond.Error(err), nil
+	}
+	attrVal, err := NewAttributeValue(b)
+	if err != nil {
+		return respond.Error(err), nil
+	}
+	fmt.Println("[Handler]", "Rettrieved attrVal")
+	input := &dynamodb.PutItemInput{
+		Item:                   attrVal,
+		ReturnConsumedCapacity: aws.String("TOTAL"),
+		TableName:              aws.String(h.Config.UserLoginTableName),
+	}
+	fmt.Println("[Handler]", "Created input")
+	fmt.Println("[Handler]", input)
+
+	// create item
+	result, err := h.Clients.DynamoDB.PutItem(input)
+	if err != nil {
+		return respond.Error(err), nil
+	}
+	fmt.Println("[Handler]", "Called PutItem")
+
+	// sessions keyed by name would otherwise show as a second player, still
+	// online if never closed. Failing to move them is only logged, as the
+	// session is recorded and they are moved with the next one.
+	if b.PK != b.Username {
+		moved, err := mcapi.MergeLegacyLogins(h.Config, h.Clients.DynamoDB, b.PK, b.Username, b.LoginTime)
+		if err != nil {
+			fmt.Println("WARNING: could not merge the sessions of", b.Username, "keyed by name:", err)
+		} else if moved > 0 {
+			fmt.Println("[Handler]", "Merged", moved, "sessions of", b.Username, "keyed by name")
+		}
+	}
+
+	// return stringified json result
+	fmt.Println("logins:", result)
+	return respond.OK(result), nil
+}
@@ -0,0 +1,148 @@
+package upsertlogin
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"mcapi"
+	"mcapi/mcapitest"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+func TestHandle(t *testing.T) {
+	steve := "069a79f4-44e9-4726-a5be-fca90e38aaf5"
+	tests := []struct {
+		name       string
+		body       string
+		setup      func(c *mcapitest.Clients)
+		statusCode int
+		want       string // PK of the stored session
+		resolved   int
+	}{
+		{
+			name:       "name resolved",
+			body:       `{"Username": "Steve", "Version": "v1", "LoginTime": 300}`,
+			statusCode: 200,
+			want:       steve,
+			resolved:   1,
+		},
+		{
+			name:       "uuid sent",
+			body:       `{"Username": "Steve", "UUID": "069A79F444E94726A5BEFCA90E38AAF5", "Version": "v1", "LoginTime": 300}`,
+			statusCode: 200,
+			want:       steve,
+		},
+		{
+			name:       "unknown player keyed by name",
+			body:       `{"Username": "Notch", "Version": "v1", "LoginTime": 300}`,
+			statusCode: 200,
+			want:       "Notch",
+			resolved:   1,
+		},
+		{
+			name: "lookup failing keyed by name",
+			body: `{"Username": "Steve", "Version": "v1", "LoginTime": 300}`,
+			setup: func(c *mcapitest.Clients) {
+				c.Resolver.Fail("Resolve", errors.New("api.mojang.com unavailable"))
+			},
+			statusCode: 200,
+			want:       "Steve",
+			resolved:   1,
+		},
+		{name: "invalid username", body: `{"Username": "Steve; op Steve", "Version": "v1"}`, statusCode: 400},
+		{name: "invalid uuid", body: `{"Username": "Steve", "UUID": "nope", "Version": "v1"}`, statusCode: 400},
+		{name: "invalid body", body: `{`, statusCode: 400},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := mcapitest.Config()
+			c := mcapitest.NewClients()
+			c.Resolver.SetProfile("Steve", steve)
+			c.Resolver.SetProfile("Notch", "")
+			if tt.setup != nil {
+				tt.setup(c)
+			}
+			h := &Handler{Config: cfg, Clients: c.Clients()}
+
+			resp, err := h.Handle(context.Background(), events.APIGatewayProxyRequest{Body: tt.body})
+			if err != nil {
+				t.Fatalf("Handle returned error: %v", err)
+			}
+			if resp.StatusCode != tt.statusCode {
+				t.Fatalf("status = %d, want %d (body %q)", resp.StatusCode, tt.statusCode, resp.Body)
+			}
+			if got := len(c.Resolver.Resolved()); got != tt.resolved {
+				t.Errorf("resolved %v, want %d lookups", c.Resolver.Resolved(), tt.resolved)
+			}
+			if tt.statusCode != 200 {
+				return
+			}
+			logins, err := mcapi.UnmarshalLogins(c.DynamoDB.Items(cfg.UserLoginTableName))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(logins) != 1 || logins[0].PK != tt.want || logins[0].Username == "" {
+				t.Errorf("stored %+v, want one session keyed by %s", logins, tt.want)
+			}
+			if tt.want == steve && logins[0].UUID != steve {
+				t.Errorf("stored %+v, want Steve's UUID", logins)
+			}
+		})
+	}
+}
+
+func TestHandleMergesLegacyLogins(t *testing.T) {
+	steve := "069a79f4-44e9-4726-a5be-fca90e38aaf5"
+	cfg := mcapitest.Config()
+	c := mcapitest.NewClients()
+	c.Resolver.SetProfile("Steve", steve)
+	// sessions keyed by name: a closed older version and one never closed
+	for _, l := range []mcapi.DynamoDbItem{
+		{PK: "Steve", SK: "150", LoginTime: 100, LogoutTime: 150, LogoutReason: mcapi.LogoutManual},
+		{PK: "Steve", SK: mcapi.LoginVersion, LoginTime: 200},
+	} {
+		av, err := dynamodbattribute.MarshalMap(l)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.DynamoDB.Put(cfg.UserLoginTableName, av)
+	}
+	h := &Handler{Config: cfg, Clients: c.Clients()}
+
+	body := `{"Username": "Steve", "Version": "v1", "LoginTime": 300}`
+	resp, err := h.Handle(context.Background(), events.APIGatewayProxyRequest{Body: body})
+	if err != nil {
+		t.Fatalf("Handle returned error: %v", err)
+	}
+	if resp.StatusCode != 200 {
+		t.Fatalf("status = %d, want 200 (body %q)", resp.StatusCode, resp.Body)
+	}
+
+	current, err := mcapi.GetLogins(cfg, c.DynamoDB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(current) != 1 || current[0].PK != steve || current[0].LoginTime != 300 {
+		t.Errorf("current sessions = %+v, want only Steve's keyed by UUID", current)
+	}
+	logins, err := mcapi.UnmarshalLogins(c.DynamoDB.Items(cfg.UserLoginTableName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed := map[string]mcapi.DynamoDbItem{}
+	for _, l := range logins {
+		if l.PK != steve {
+			t.Errorf("session %+v left keyed by name", l)
+		}
+		closed[l.SK] = l
+	}
+	if l := closed["150"]; l.LoginTime != 100 || l.LogoutReason != mcapi.LogoutManual {
+		t.Errorf("older session = %+v, want it moved as is", l)
+	}
+	if l := closed["300"]; l.LoginTime != 200 || l.LogoutReason != mcapi.LogoutMerged {
+		t.Errorf("open session = %+v, want it closed at 300 as merged", l)
+	}
+}
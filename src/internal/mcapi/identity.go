@@ -0,0 +1,30 @@
+package mcapi
+
+import (
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// claim returns a claim of the Cognito authorizer that authorized request, or
+// "" if it was not authorized by it, as with API key requests
+func claim(request events.APIGatewayProxyRequest, name string) string {
+	claims, ok := request.RequestContext.Authorizer["claims"].(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	value, _ := claims[name].(string)
+	return value
+}
+
+// CognitoUser returns the username of the website user who sent request, from
+// the claims of the Cognito authorizer, or "" if the request was not
+// authorized by it, as with API key requests
+func CognitoUser(request events.APIGatewayProxyRequest) string {
+	return claim(request, "cognito:username")
+}
+
+// CognitoSub returns the subject of the website user who sent request, which
+// unlike the username never changes, or "" if the request was not authorized
+// by Cognito
+func CognitoSub(request events.APIGatewayProxyRequest) string {
+	return claim(request, "sub")
+}
@@ -0,0 +1,45 @@
+package mcapi
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/aws/aws-sdk-go/service/lambda/lambdaiface"
+)
+
+// Invoker hands work that outlasts API Gateway's 29 second limit to an
+// asynchronous invocation of a lambda function, so the request can return
+// straight away
+type Invoker interface {
+	// Invoke queues an invocation of function with payload as its JSON event,
+	// without waiting for it to run
+	Invoke(function string, payload interface{}) error
+}
+
+// LambdaInvoker invokes functions with the Event invocation type. Lambda
+// retries an asynchronous invocation that fails up to twice.
+type LambdaInvoker struct {
+	Lambda lambdaiface.LambdaAPI
+}
+
+// NewLambdaInvoker creates and returns new LambdaInvoker
+func NewLambdaInvoker(svc lambdaiface.LambdaAPI) *LambdaInvoker {
+	return &LambdaInvoker{Lambda: svc}
+}
+
+// Invoke implements Invoker
+func (i *LambdaInvoker) Invoke(function string, payload interface{}) error {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	fmt.Println("[LambdaInvoker]", "invoking", function+":", string(b))
+	_, err = i.Lambda.Invoke(&lambda.InvokeInput{
+		FunctionName:   aws.String(function),
+		InvocationType: aws.String(lambda.InvocationTypeEvent),
+		Payload:        b,
+	})
+	return err
+}
@@ -0,0 +1,179 @@
+package mcapi
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+)
+
+// Lifecycle is the state of the server as driven by the API, as opposed to the
+// EC2 instance state
+type Lifecycle string
+
+// Server lifecycle states. A server moves stopped → starting → started →
+// stopping → stopped, and may also be stopped while still starting. A stopped
+// server has a backup restored onto it by moving stopped → restoring → stopped.
+const (
+	LifecycleStopped   Lifecycle = "stopped"
+	LifecycleStarting  Lifecycle = "starting"
+	LifecycleStarted   Lifecycle = "started"
+	LifecycleStopping  Lifecycle = "stopping"
+	LifecycleRestoring Lifecycle = "restoring"
+)
+
+// transitions lists the states each state may move to
+var transitions = map[Lifecycle][]Lifecycle{
+	LifecycleStopped:   {LifecycleStarting, LifecycleRestoring},
+	LifecycleStarting:  {LifecycleStarted, LifecycleStopping},
+	LifecycleStarted:   {LifecycleStopping},
+	LifecycleStopping:  {LifecycleStopped},
+	LifecycleRestoring: {LifecycleStopped},
+}
+
+// CanTransition reports whether the server may move from l to next
+func (l Lifecycle) CanTransition(next Lifecycle) bool {
+	for _, t := range transitions[l] {
+		if t == next {
+			return true
+		}
+	}
+	return false
+}
+
+// up reports whether l is on its way up or up
+func (l Lifecycle) up() bool {
+	return l == LifecycleStarting || l == LifecycleStarted
+}
+
+// instanceLifecycles maps EC2 instance state names to the lifecycle state the
+// instance is in
+var instanceLifecycles = map[string]Lifecycle{
+	ec2.InstanceStateNamePending:      LifecycleStarting,
+	ec2.InstanceStateNameRunning:      LifecycleStarted,
+	ec2.InstanceStateNameStopping:     LifecycleStopping,
+	ec2.InstanceStateNameShuttingDown: LifecycleStopping,
+	ec2.InstanceStateNameStopped:      LifecycleStopped,
+}
+
+// InstanceState returns the EC2 state name of the server's instance
+func InstanceState(cfg *Config, svc ec2iface.EC2API) (string, error) {
+	result, err := svc.DescribeInstances(&ec2.DescribeInstancesInput{
+		InstanceIds: []*string{aws.String(cfg.ServerID)},
+	})
+	if err != nil {
+		return "", err
+	}
+	for _, r := range result.Reservations {
+		for _, i := range r.Instances {
+			if i.State != nil {
+				return aws.StringValue(i.State.Name), nil
+			}
+		}
+	}
+	return "", NewError(CodeNotFound, "Could not find instance with ID %s", cfg.ServerID)
+}
+
+// GetLifecycle returns the lifecycle state kept in the store. Servers started
+// before the lifecycle was tracked have no lifecycle value, so it falls back
+// to started if the service status is set and stopped otherwise.
+func GetLifecycle(cfg *Config, store StateStore) (Lifecycle, error) {
+	value, err := store.Get(cfg.LifecycleKeyName)
+	if err == nil {
+		return Lifecycle(value), nil
+	}
+	if !errors.Is(err, ErrStateNotFound) {
+		return "", err
+	}
+	_, err = store.Get(cfg.ServerStatusKeyName)
+	if err == nil {
+		return LifecycleStarted, nil
+	}
+	if !errors.Is(err, ErrStateNotFound) {
+		return "", err
+	}
+	return LifecycleStopped, nil
+}
+
+// SyncLifecycle returns the lifecycle state kept in the store, checked against
+// the state of the instance. The instance can be started or stopped outside
+// the API, and the stored state can be lost, so a stored state that has the
+// instance up while it is down, or down while it is up, is replaced with the
+// state the instance is actually in. A server left stopping is kept stopping,
+// as the stop that left it there is rerun to finish it. A server left
+// restoring after its restore is over is moved back to stopped.
+func SyncLifecycle(cfg *Config, svc ec2iface.EC2API, store StateStore) (Lifecycle, error) {
+	stored, err := GetLifecycle(cfg, store)
+	if err != nil {
+		return "", err
+	}
+	if stored == LifecycleRestoring {
+		stored, err = endStaleRestore(cfg, store, time.Now())
+		if err != nil {
+			return "", err
+		}
+	}
+	state, err := InstanceState(cfg, svc)
+	if err != nil {
+		return "", err
+	}
+	actual, ok := instanceLifecycles[state]
+	if !ok || !(stored == LifecycleStopped && actual.up() || stored.up() && !actual.up()) {
+		return stored, nil
+	}
+	fmt.Println("[SyncLifecycle]", "stored lifecycle is", stored, "but instance is", state)
+	err = swapLifecycle(cfg, store, stored, actual)
+	if err != nil {
+		return "", err
+	}
+	return actual, nil
+}
+
+// swapLifecycle replaces the stored lifecycle state with next if it is still
+// current, returning a CONFLICT error if another request changed it first.
+// Servers started before the lifecycle was tracked have no stored value.
+func swapLifecycle(cfg *Config, store StateStore, current, next Lifecycle) error {
+	old := string(current)
+	_, err := store.Get(cfg.LifecycleKeyName)
+	if errors.Is(err, ErrStateNotFound) {
+		old = ""
+	} else if err != nil {
+		return err
+	}
+	err = store.Swap(cfg.LifecycleKeyName, old, string(next))
+	if errors.Is(err, ErrStateConflict) {
+		return &Error{Code: CodeConflict, Message: fmt.Sprintf("Server is no longer %s", current), Err: err}
+	}
+	return err
+}
+
+// Transition moves the stored lifecycle state from current to next, returning
+// a CONFLICT error if the state machine does not allow it or if the state is
+// no longer current, such as when two requests race to start the server
+func Transition(cfg *Config, store StateStore, current, next Lifecycle) error {
+	if !current.CanTransition(next) {
+		return NewError(CodeConflict, "Server cannot go from %s to %s", current, next)
+	}
+	fmt.Println("[Transition]", current, "->", next)
+	return swapLifecycle(cfg, store, current, next)
+}
+
+// TransitionResult is returned by the handlers that move the server through
+// its lifecycle. Changed is false when the server was already in (or on its
+// way to) the requested state and nothing was done.
+type TransitionResult struct {
+	From    Lifecycle `json:"from"`
+	To      Lifecycle `json:"to"`
+	Changed bool      `json:"changed"`
+}
+
+// LegacyBody implements Legacy
+func (r TransitionResult) LegacyBody() string {
+	if r.Changed {
+		return "success"
+	}
+	return "Server is already " + string(r.To)
+}
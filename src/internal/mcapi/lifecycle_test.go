@@ -0,0 +1,130 @@
+package mcapi_test
+
+import (
+	"testing"
+
+	"mcapi"
+	"mcapi/mcapitest"
+)
+
+func TestLifecycleTransitions(t *testing.T) {
+	allowed := map[[2]mcapi.Lifecycle]bool{
+		{mcapi.LifecycleStopped, mcapi.LifecycleStarting}:  true,
+		{mcapi.LifecycleStopped, mcapi.LifecycleRestoring}: true,
+		{mcapi.LifecycleStarting, mcapi.LifecycleStarted}:  true,
+		{mcapi.LifecycleStarting, mcapi.LifecycleStopping}: true,
+		{mcapi.LifecycleStarted, mcapi.LifecycleStopping}:  true,
+		{mcapi.LifecycleStopping, mcapi.LifecycleStopped}:  true,
+		{mcapi.LifecycleRestoring, mcapi.LifecycleStopped}: true,
+	}
+	states := []mcapi.Lifecycle{mcapi.LifecycleStopped, mcapi.LifecycleStarting, mcapi.LifecycleStarted, mcapi.LifecycleStopping, mcapi.LifecycleRestoring}
+	for _, from := range states {
+		for _, to := range states {
+			if got := from.CanTransition(to); got != allowed[[2]mcapi.Lifecycle{from, to}] {
+				t.Errorf("%s -> %s allowed = %t", from, to, got)
+			}
+		}
+	}
+}
+
+func TestGetLifecycle(t *testing.T) {
+	cfg := mcapitest.Config()
+	tests := []struct {
+		name   string
+		values map[string]string
+		want   mcapi.Lifecycle
+	}{
+		{"nothing stored", nil, mcapi.LifecycleStopped},
+		{"stored", map[string]string{cfg.LifecycleKeyName: "stopping"}, mcapi.LifecycleStopping},
+		{"started before lifecycle was tracked", map[string]string{cfg.ServerStatusKeyName: "started"}, mcapi.LifecycleStarted},
+	}
+	for _, tt := range tests {
+		store := mcapi.NewMemoryStateStore()
+		for k, v := range tt.values {
+			store.Put(k, v)
+		}
+		got, err := mcapi.GetLifecycle(cfg, store)
+		if err != nil || got != tt.want {
+			t.Errorf("%s: got %q, %v, want %q", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestTransition(t *testing.T) {
+	cfg := mcapitest.Config()
+	store := mcapi.NewMemoryStateStore()
+	if err := mcapi.Transition(cfg, store, mcapi.LifecycleStopped, mcapi.LifecycleStarting); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := store.Get(cfg.LifecycleKeyName); got != "starting" {
+		t.Errorf("lifecycle = %q, want starting", got)
+	}
+	err := mcapi.Transition(cfg, store, mcapi.LifecycleStarting, mcapi.LifecycleStopped)
+	if e := mcapi.Classify(err); e.Code != mcapi.CodeConflict {
+		t.Errorf("invalid transition returned %v, want CONFLICT", err)
+	}
+	if got, _ := store.Get(cfg.LifecycleKeyName); got != "starting" {
+		t.Errorf("lifecycle = %q after invalid transition, want starting", got)
+	}
+}
+
+func TestTransitionRace(t *testing.T) {
+	cfg := mcapitest.Config()
+	store := mcapi.NewMemoryStateStore()
+	// two requests both read stopped, the first one claims the start
+	if err := mcapi.Transition(cfg, store, mcapi.LifecycleStopped, mcapi.LifecycleStarting); err != nil {
+		t.Fatal(err)
+	}
+	err := mcapi.Transition(cfg, store, mcapi.LifecycleStopped, mcapi.LifecycleStarting)
+	if e := mcapi.Classify(err); e.Code != mcapi.CodeConflict {
+		t.Errorf("losing transition returned %v, want CONFLICT", err)
+	}
+}
+
+func TestSyncLifecycle(t *testing.T) {
+	cfg := mcapitest.Config()
+	tests := []struct {
+		stored   string
+		instance string
+		want     mcapi.Lifecycle
+	}{
+		{"", "stopped", mcapi.LifecycleStopped},
+		{"", "running", mcapi.LifecycleStarted},
+		{"stopped", "running", mcapi.LifecycleStarted},
+		{"stopped", "pending", mcapi.LifecycleStarting},
+		{"stopped", "stopping", mcapi.LifecycleStopped},
+		{"started", "stopped", mcapi.LifecycleStopped},
+		{"starting", "stopped", mcapi.LifecycleStopped},
+		{"started", "stopping", mcapi.LifecycleStopping},
+		{"started", "running", mcapi.LifecycleStarted},
+		{"starting", "running", mcapi.LifecycleStarting},
+		{"stopping", "running", mcapi.LifecycleStopping},
+		{"stopping", "stopped", mcapi.LifecycleStopping},
+	}
+	for _, tt := range tests {
+		c := mcapitest.NewClients()
+		c.EC2.SetState(cfg.ServerID, tt.instance)
+		store := mcapi.NewMemoryStateStore()
+		if tt.stored != "" {
+			store.Put(cfg.LifecycleKeyName, tt.stored)
+		}
+		got, err := mcapi.SyncLifecycle(cfg, c.EC2, store)
+		if err != nil || got != tt.want {
+			t.Errorf("stored %q, instance %s: got %q, %v, want %q", tt.stored, tt.instance, got, err, tt.want)
+		}
+		// nothing is written when the fallback already fits the instance
+		want := string(tt.want)
+		if tt.stored == "" && tt.want == mcapi.LifecycleStopped {
+			want = ""
+		}
+		if stored, _ := store.Get(cfg.LifecycleKeyName); stored != want {
+			t.Errorf("stored %q, instance %s: stored %q after sync, want %q", tt.stored, tt.instance, stored, want)
+		}
+	}
+
+	c := mcapitest.NewClients()
+	_, err := mcapi.SyncLifecycle(cfg, c.EC2, mcapi.NewMemoryStateStore())
+	if e := mcapi.Classify(err); e.Code != mcapi.CodeNotFound {
+		t.Errorf("unknown instance returned %v, want NOT_FOUND", err)
+	}
+}
@@ -0,0 +1,270 @@
+package mcapi
+
+import (
+	"crypto/rand"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+// Partition keys of account linking items in the login table. Like
+// StatePartitionKey they cannot collide with a player's sessions.
+const (
+	// LinkCodePartitionKey holds the link codes waiting to be redeemed, with
+	// the code as SK
+	LinkCodePartitionKey = "#linkcode"
+	// LinkPartitionKey holds every link twice, once under the Cognito sub and
+	// once under the player UUID, so it can be found from either side
+	LinkPartitionKey = "#link"
+)
+
+// SK prefixes of the two items of a link
+const (
+	linkBySub  = "sub#"
+	linkByUUID = "uuid#"
+)
+
+// linkCodeAlphabet leaves out letters and digits easily mistaken for one
+// another when typed in game
+const linkCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// linkCodeLength is long enough not to be guessed within a code's short life
+const linkCodeLength = 8
+
+// LinkCode is a one-time code a website user types in game to link their
+// minecraft account
+type LinkCode struct {
+	Code        string `json:"code" dynamodbav:"SK"`
+	Sub         string `json:"-" dynamodbav:"Sub"`
+	CognitoUser string `json:"cognitoUser" dynamodbav:"CognitoUser"`
+	// Expires is the unix timestamp the code stops working at. It is the
+	// table's TTL attribute, so expired codes are eventually deleted.
+	Expires int64 `json:"expires" dynamodbav:"Expires"`
+}
+
+// Link ties a website user to their minecraft account
+type Link struct {
+	Sub         string `json:"sub" dynamodbav:"Sub"`
+	CognitoUser string `json:"cognitoUser" dynamodbav:"CognitoUser"`
+	UUID        string `json:"uuid" dynamodbav:"UUID"`
+	// Username is the player's name when the link was made
+	Username string `json:"username" dynamodbav:"Username"`
+	// LinkedAt is the unix timestamp the code was redeemed at
+	LinkedAt int64 `json:"linkedAt" dynamodbav:"LinkedAt"`
+}
+
+// newLinkCode returns a random code from linkCodeAlphabet
+func newLinkCode() (string, error) {
+	b := make([]byte, linkCodeLength)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	for i := range b {
+		b[i] = linkCodeAlphabet[int(b[i])%len(linkCodeAlphabet)]
+	}
+	return string(b), nil
+}
+
+// itemKey returns the primary key of the item with pk and sk
+func itemKey(pk, sk string) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		"PK": {S: aws.String(pk)},
+		"SK": {S: aws.String(sk)},
+	}
+}
+
+// CreateLinkCode stores and returns a new link code for the website user,
+// valid for cfg.LinkCodeTTL from now
+func CreateLinkCode(cfg *Config, svc dynamodbiface.DynamoDBAPI, sub, cognitoUser string, now time.Time) (LinkCode, error) {
+	if sub == "" {
+		return LinkCode{}, NewError(CodeForbidden, "Linking an account needs a signed in website user")
+	}
+	code, err := newLinkCode()
+	if err != nil {
+		return LinkCode{}, err
+	}
+	linkCode := LinkCode{Code: code, Sub: sub, CognitoUser: cognitoUser, Expires: now.Add(cfg.LinkCodeTTL).Unix()}
+	item, err := dynamodbattribute.MarshalMap(linkCode)
+	if err != nil {
+		return LinkCode{}, err
+	}
+	item["PK"] = &dynamodb.AttributeValue{S: aws.String(LinkCodePartitionKey)}
+	_, err = svc.PutItem(&dynamodb.PutItemInput{
+		TableName: aws.String(cfg.UserLoginTableName),
+		Item:      item,
+	})
+	return linkCode, err
+}
+
+// findLink returns the link stored under sk, reporting whether there is one
+func findLink(cfg *Config, svc dynamodbiface.DynamoDBAPI, sk string) (Link, bool, error) {
+	var link Link
+	result, err := svc.GetItem(&dynamodb.GetItemInput{
+		TableName:      aws.String(cfg.UserLoginTableName),
+		Key:            itemKey(LinkPartitionKey, sk),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil || len(result.Item) == 0 {
+		return link, false, err
+	}
+	err = dynamodbattribute.UnmarshalMap(result.Item, &link)
+	return link, err == nil, err
+}
+
+// GetLinkBySub returns the link of the website user with the Cognito sub, or a
+// NOT_FOUND error if they have not linked an account
+func GetLinkBySub(cfg *Config, svc dynamodbiface.DynamoDBAPI, sub string) (Link, error) {
+	link, ok, err := findLink(cfg, svc, linkBySub+sub)
+	if err == nil && !ok {
+		err = NewError(CodeNotFound, "No linked account")
+	}
+	return link, err
+}
+
+// GetLinks returns every link
+func GetLinks(cfg *Config, svc dynamodbiface.DynamoDBAPI) ([]Link, error) {
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(cfg.UserLoginTableName),
+		KeyConditionExpression: aws.String("PK = :pk"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":pk": {S: aws.String(LinkPartitionKey)},
+		},
+	}
+	var links []Link
+	for {
+		result, err := svc.Query(input)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range result.Items {
+			// each link is stored twice, so only take one side
+			if !strings.HasPrefix(aws.StringValue(item["SK"].S), linkBySub) {
+				continue
+			}
+			var link Link
+			err = dynamodbattribute.UnmarshalMap(item, &link)
+			if err != nil {
+				return nil, err
+			}
+			links = append(links, link)
+		}
+		if len(result.LastEvaluatedKey) == 0 {
+			return links, nil
+		}
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+}
+
+// linkItem returns the item of link stored under sk
+func linkItem(cfg *Config, link Link, sk string) (*dynamodb.TransactWriteItem, error) {
+	item, err := dynamodbattribute.MarshalMap(link)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range itemKey(LinkPartitionKey, sk) {
+		item[k] = v
+	}
+	return &dynamodb.TransactWriteItem{Put: &dynamodb.Put{
+		TableName: aws.String(cfg.UserLoginTableName),
+		Item:      item,
+	}}, nil
+}
+
+// unlinkItem returns the deletion of the link item stored under sk
+func unlinkItem(cfg *Config, sk string) *dynamodb.TransactWriteItem {
+	return &dynamodb.TransactWriteItem{Delete: &dynamodb.Delete{
+		TableName: aws.String(cfg.UserLoginTableName),
+		Key:       itemKey(LinkPartitionKey, sk),
+	}}
+}
+
+// RedeemLinkCode links the website user who asked for code to the player who
+// typed it in game, as reported by the server. The code is used up whether or
+// not the link is stored. A website user links a single account, and an
+// account a single website user, so a new link replaces the previous links of
+// either side. It returns a NOT_FOUND error if the code is unknown, used or
+// expired.
+func RedeemLinkCode(cfg *Config, svc dynamodbiface.DynamoDBAPI, code, uuid, username string, now time.Time) (Link, error) {
+	// deleting the code is what redeems it, so it cannot be redeemed twice
+	result, err := svc.DeleteItem(&dynamodb.DeleteItemInput{
+		TableName:    aws.String(cfg.UserLoginTableName),
+		Key:          itemKey(LinkCodePartitionKey, strings.ToUpper(code)),
+		ReturnValues: aws.String(dynamodb.ReturnValueAllOld),
+	})
+	if err != nil {
+		return Link{}, err
+	}
+	var linkCode LinkCode
+	err = dynamodbattribute.UnmarshalMap(result.Attributes, &linkCode)
+	if err != nil {
+		return Link{}, err
+	}
+	// expired codes linger until the TTL gets round to deleting them
+	if len(result.Attributes) == 0 || linkCode.Expires <= now.Unix() {
+		return Link{}, NewError(CodeNotFound, "Link code %s is unknown or expired", code)
+	}
+
+	link := Link{Sub: linkCode.Sub, CognitoUser: linkCode.CognitoUser, UUID: uuid, Username: username, LinkedAt: now.Unix()}
+	var items []*dynamodb.TransactWriteItem
+	for _, sk := range []string{linkBySub + link.Sub, linkByUUID + link.UUID} {
+		item, err := linkItem(cfg, link, sk)
+		if err != nil {
+			return Link{}, err
+		}
+		items = append(items, item)
+	}
+	// drop the other side of the links being replaced
+	previous, ok, err := findLink(cfg, svc, linkBySub+link.Sub)
+	if err != nil {
+		return Link{}, err
+	}
+	if ok && previous.UUID != link.UUID {
+		fmt.Println("[RedeemLinkCode]", link.CognitoUser, "was linked to", previous.Username)
+		items = append(items, unlinkItem(cfg, linkByUUID+previous.UUID))
+	}
+	previous, ok, err = findLink(cfg, svc, linkByUUID+link.UUID)
+	if err != nil {
+		return Link{}, err
+	}
+	if ok && previous.Sub != link.Sub {
+		fmt.Println("[RedeemLinkCode]", link.Username, "was linked to", previous.CognitoUser)
+		items = append(items, unlinkItem(cfg, linkBySub+previous.Sub))
+	}
+
+	_, err = svc.TransactWriteItems(&dynamodb.TransactWriteItemsInput{TransactItems: items})
+	return link, err
+}
+
+// Actor is who started or stopped the server: the website user, and the
+// minecraft account they linked, if any
+type Actor struct {
+	CognitoUser string `json:"cognitoUser"`
+	Username    string `json:"username,omitempty"`
+	UUID        string `json:"uuid,omitempty"`
+}
+
+// RequestActor returns the website user who sent request, with their linked
+// account, or nil if the request was not sent by a signed in user. Failing to
+// look the link up only leaves it out.
+func RequestActor(cfg *Config, svc dynamodbiface.DynamoDBAPI, request events.APIGatewayProxyRequest) *Actor {
+	sub := CognitoSub(request)
+	if sub == "" {
+		return nil
+	}
+	actor := &Actor{CognitoUser: CognitoUser(request)}
+	link, ok, err := findLink(cfg, svc, linkBySub+sub)
+	if err != nil {
+		fmt.Println("WARNING: could not look up linked account of", actor.CognitoUser+":", err)
+	}
+	if ok {
+		actor.Username, actor.UUID = link.Username, link.UUID
+	}
+	return actor
+}
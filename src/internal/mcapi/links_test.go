@@ -0,0 +1,157 @@
+package mcapi_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"mcapi"
+	"mcapi/mcapitest"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+const (
+	steveUUID = "069a79f4-44e9-4726-a5be-fca90e38aaf5"
+	alexUUID  = "853c80ef-3c37-49fd-aa49-938b674adae6"
+)
+
+// link redeems a new code of the website user sub for the player
+func link(t *testing.T, cfg *mcapi.Config, svc *mcapitest.FakeDynamoDB, sub, uuid, username string, now time.Time) mcapi.Link {
+	t.Helper()
+	code, err := mcapi.CreateLinkCode(cfg, svc, sub, "user-"+sub, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := mcapi.RedeemLinkCode(cfg, svc, strings.ToLower(code.Code), uuid, username, now)
+	if err != nil {
+		t.Fatalf("redeeming %s: %v", code.Code, err)
+	}
+	return l
+}
+
+func isNotFound(err error) bool {
+	var e *mcapi.Error
+	return errors.As(err, &e) && e.Code == mcapi.CodeNotFound
+}
+
+func TestRedeemLinkCode(t *testing.T) {
+	cfg := mcapitest.Config()
+	now := time.Unix(1600000000, 0)
+	tests := []struct {
+		name    string
+		redeem  time.Duration // after the code was created
+		twice   bool
+		created bool
+	}{
+		{name: "redeemed", redeem: time.Minute, created: true},
+		{name: "redeemed twice", redeem: time.Minute, twice: true, created: true},
+		{name: "expired", redeem: cfg.LinkCodeTTL},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := mcapitest.NewClients()
+			code, err := mcapi.CreateLinkCode(cfg, c.DynamoDB, "sub-1", "alice", now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if code.Expires != now.Add(cfg.LinkCodeTTL).Unix() {
+				t.Errorf("expires = %d, want %d", code.Expires, now.Add(cfg.LinkCodeTTL).Unix())
+			}
+			l, err := mcapi.RedeemLinkCode(cfg, c.DynamoDB, code.Code, steveUUID, "Steve", now.Add(tt.redeem))
+			if tt.twice && err == nil {
+				_, err = mcapi.RedeemLinkCode(cfg, c.DynamoDB, code.Code, alexUUID, "Alex", now.Add(tt.redeem))
+				if !isNotFound(err) {
+					t.Errorf("redeeming again = %v, want NOT_FOUND", err)
+				}
+				err = nil
+			}
+			if !tt.created {
+				if !isNotFound(err) {
+					t.Errorf("RedeemLinkCode = %v, want NOT_FOUND", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := mcapi.Link{Sub: "sub-1", CognitoUser: "alice", UUID: steveUUID, Username: "Steve", LinkedAt: now.Add(tt.redeem).Unix()}
+			if l != want {
+				t.Errorf("link = %+v, want %+v", l, want)
+			}
+			got, err := mcapi.GetLinkBySub(cfg, c.DynamoDB, "sub-1")
+			if err != nil || got != want {
+				t.Errorf("GetLinkBySub = %+v, %v, want %+v", got, err, want)
+			}
+		})
+	}
+}
+
+func TestCreateLinkCodeSignedOut(t *testing.T) {
+	c := mcapitest.NewClients()
+	_, err := mcapi.CreateLinkCode(mcapitest.Config(), c.DynamoDB, "", "", time.Now())
+	var e *mcapi.Error
+	if !errors.As(err, &e) || e.Code != mcapi.CodeForbidden {
+		t.Errorf("CreateLinkCode = %v, want FORBIDDEN", err)
+	}
+}
+
+func TestRelink(t *testing.T) {
+	cfg := mcapitest.Config()
+	c := mcapitest.NewClients()
+	now := time.Unix(1600000000, 0)
+	link(t, cfg, c.DynamoDB, "sub-1", steveUUID, "Steve", now)
+	// the user links another account, then another user takes it over
+	link(t, cfg, c.DynamoDB, "sub-1", alexUUID, "Alex", now)
+	link(t, cfg, c.DynamoDB, "sub-2", alexUUID, "Alex", now)
+
+	links, err := mcapi.GetLinks(cfg, c.DynamoDB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(links) != 1 || links[0].Sub != "sub-2" || links[0].UUID != alexUUID {
+		t.Errorf("links = %+v, want only sub-2 linked to Alex", links)
+	}
+	if _, err := mcapi.GetLinkBySub(cfg, c.DynamoDB, "sub-1"); !isNotFound(err) {
+		t.Errorf("GetLinkBySub(sub-1) = %v, want NOT_FOUND", err)
+	}
+	// a link item for each side, and nothing left of the earlier links
+	if got := len(c.DynamoDB.Items(cfg.UserLoginTableName)); got != 2 {
+		t.Errorf("stored %d items, want 2", got)
+	}
+}
+
+func TestRequestActor(t *testing.T) {
+	cfg := mcapitest.Config()
+	tests := []struct {
+		name string
+		sub  string
+		fail error
+		want *mcapi.Actor
+	}{
+		{name: "linked", sub: "sub-1", want: &mcapi.Actor{CognitoUser: "alice", Username: "Steve", UUID: steveUUID}},
+		{name: "not linked", sub: "sub-2", want: &mcapi.Actor{CognitoUser: "alice"}},
+		{name: "lookup fails", sub: "sub-1", fail: awserr.New(dynamodb.ErrCodeInternalServerError, "oops", nil), want: &mcapi.Actor{CognitoUser: "alice"}},
+		{name: "not signed in"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := mcapitest.NewClients()
+			link(t, cfg, c.DynamoDB, "sub-1", steveUUID, "Steve", time.Now())
+			c.DynamoDB.Fail("GetItem", tt.fail)
+			request := events.APIGatewayProxyRequest{}
+			if tt.sub != "" {
+				request.RequestContext.Authorizer = map[string]interface{}{
+					"claims": map[string]interface{}{"sub": tt.sub, "cognito:username": "alice"},
+				}
+			}
+			got := mcapi.RequestActor(cfg, c.DynamoDB, request)
+			if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+				t.Errorf("RequestActor = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
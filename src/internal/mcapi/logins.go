@@ -0,0 +1,329 @@
+package mcapi
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+// LoginVersion is the SK of the current version of login items. Older
+// versions of a user's sessions are kept under the unix time they were
+// replaced at.
+const LoginVersion = "v1"
+
+// Reasons a session was closed by the API rather than by the player logging
+// out
+const (
+	// LogoutScheduled is a session closed by the scheduled stop
+	LogoutScheduled = "scheduled"
+	// LogoutManual is a session closed by a stop requested through /stop
+	LogoutManual = "manual"
+	// LogoutShutdown is a session closed through /logoutUsers as the server
+	// shuts down
+	LogoutShutdown = "shutdown"
+	// LogoutMerged is a session keyed by name closed as the player's next
+	// session was keyed by their UUID
+	LogoutMerged = "merged"
+)
+
+// DynamoDbItem is a login session in the login table, keyed on player UUID
+// (PK) and version (SK). Sessions recorded before players were keyed by UUID
+// have their name as PK instead, and no Username.
+type DynamoDbItem struct {
+	PK string `json:"-" dynamodbav:"PK"`
+	// Username is the player's name as of the session, so renamed players
+	// keep their sessions
+	Username   string `json:"Username" dynamodbav:"Username,omitempty"`
+	SK         string `json:"Version" dynamodbav:"SK"`
+	LoginTime  int32  `json:"LoginTime" dynamodbav:"LoginTime"`
+	LogoutTime int32  `json:"LogoutTime" dynamodbav:"LogoutTime,omitempty"`
+	// LogoutReason is set on sessions closed by the API
+	LogoutReason string `json:"LogoutReason,omitempty" dynamodbav:"LogoutReason,omitempty"`
+	// UUID is the player's UUID, filled in from PK when read. It is empty for
+	// sessions keyed by name.
+	UUID string `json:"UUID,omitempty" dynamodbav:"-"`
+	// CognitoUser is the website user who linked the player's account. It is
+	// filled in from the links when returned, not stored with the session.
+	CognitoUser string `json:"CognitoUser,omitempty" dynamodbav:"-"`
+}
+
+// UnmarshalLogins returns the sessions in items, with their UUID and Username
+// filled in from PK. A PK is either a UUID or a name, as names are never
+// formatted like one.
+func UnmarshalLogins(items []map[string]*dynamodb.AttributeValue) ([]DynamoDbItem, error) {
+	logins := []DynamoDbItem{}
+	err := dynamodbattribute.UnmarshalListOfMaps(items, &logins)
+	if err != nil {
+		return nil, err
+	}
+	for i := range logins {
+		if playerUUID.MatchString(logins[i].PK) {
+			logins[i].UUID = logins[i].PK
+		}
+		if logins[i].Username == "" {
+			logins[i].Username = logins[i].PK
+		}
+	}
+	return logins, nil
+}
+
+// Online reports whether the session is still open, which is when the user has
+// not logged out since they last logged in
+func (i DynamoDbItem) Online() bool {
+	return i.LogoutTime == 0 || i.LogoutTime < i.LoginTime
+}
+
+// GetLogins returns the latest session of every user in the login table
+func GetLogins(cfg *Config, svc dynamodbiface.DynamoDBAPI) ([]DynamoDbItem, error) {
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(cfg.UserLoginTableName),
+		IndexName:              aws.String("Version"),
+		KeyConditionExpression: aws.String("SK = :v"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":v": {S: aws.String(LoginVersion)},
+		},
+	}
+	var logins []DynamoDbItem
+	for {
+		result, err := svc.Query(input)
+		if err != nil {
+			return nil, err
+		}
+		page, err := UnmarshalLogins(result.Items)
+		if err != nil {
+			return nil, err
+		}
+		logins = append(logins, page...)
+		if len(result.LastEvaluatedKey) == 0 {
+			return logins, nil
+		}
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+}
+
+// MergeLegacyLogins moves the sessions recorded under the player's name, before
+// players were keyed by UUID or when their name could not be resolved, under
+// uuid, so GetLogins returns a single latest session for the player. The
+// latest of them is kept as an older version, closed at loginTime, when the
+// player's current session started, if it is still open. It returns how many
+// sessions were moved.
+func MergeLegacyLogins(cfg *Config, svc dynamodbiface.DynamoDBAPI, uuid, name string, loginTime int32) (int, error) {
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(cfg.UserLoginTableName),
+		KeyConditionExpression: aws.String("PK = :pk"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":pk": {S: aws.String(name)},
+		},
+	}
+	var legacy []DynamoDbItem
+	for {
+		result, err := svc.Query(input)
+		if err != nil {
+			return 0, err
+		}
+		page, err := UnmarshalLogins(result.Items)
+		if err != nil {
+			return 0, err
+		}
+		legacy = append(legacy, page...)
+		if len(result.LastEvaluatedKey) == 0 {
+			break
+		}
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+
+	moved := 0
+	for _, l := range legacy {
+		session := l
+		session.PK = uuid
+		if l.SK == LoginVersion {
+			if l.Online() {
+				session.LogoutTime = loginTime
+				session.LogoutReason = LogoutMerged
+			}
+			session.SK = strconv.Itoa(int(session.LogoutTime))
+		}
+		item, err := dynamodbattribute.MarshalMap(session)
+		if err != nil {
+			return moved, err
+		}
+		fmt.Println("[MergeLegacyLogins]", "moving", name, l.SK, "to", uuid, session.SK)
+		_, err = svc.TransactWriteItems(&dynamodb.TransactWriteItemsInput{
+			TransactItems: []*dynamodb.TransactWriteItem{
+				{Put: &dynamodb.Put{TableName: aws.String(cfg.UserLoginTableName), Item: item}},
+				{Delete: &dynamodb.Delete{
+					TableName: aws.String(cfg.UserLoginTableName),
+					Key: map[string]*dynamodb.AttributeValue{
+						"PK": {S: aws.String(l.PK)},
+						"SK": {S: aws.String(l.SK)},
+					},
+				}},
+			},
+		})
+		if err != nil {
+			return moved, err
+		}
+		moved++
+	}
+	return moved, nil
+}
+
+// OnlinePlayers returns the names of the players with an open session in the
+// login table
+func OnlinePlayers(cfg *Config, svc dynamodbiface.DynamoDBAPI) ([]string, error) {
+	logins, err := GetLogins(cfg, svc)
+	if err != nil {
+		return nil, err
+	}
+	var players []string
+	for _, l := range logins {
+		if l.Online() {
+			players = append(players, l.Username)
+		}
+	}
+	fmt.Println("[OnlinePlayers]", "online:", players)
+	return players, nil
+}
+
+// closeSessionsPerTransaction is how many sessions are closed per
+// transaction. Each takes two of the 25 items a transaction allows.
+const closeSessionsPerTransaction = 12
+
+// openCondition holds while the session is the one that was read and is still
+// open, so a user who logged out (or back in) meanwhile is left alone
+const openCondition = "LoginTime = :login AND (attribute_not_exists(LogoutTime) OR LogoutTime < LoginTime)"
+
+// closeItems returns the transaction items closing session: a conditional
+// update of the current version, and a copy of the closed session kept as an
+// older version
+func closeItems(cfg *Config, session DynamoDbItem) ([]*dynamodb.TransactWriteItem, error) {
+	version := session
+	version.SK = strconv.Itoa(int(session.LogoutTime))
+	item, err := dynamodbattribute.MarshalMap(version)
+	if err != nil {
+		return nil, err
+	}
+	update := &dynamodb.Update{
+		TableName: aws.String(cfg.UserLoginTableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			"PK": {S: aws.String(session.PK)},
+			"SK": {S: aws.String(LoginVersion)},
+		},
+		UpdateExpression:    aws.String("SET LogoutTime = :logout"),
+		ConditionExpression: aws.String(openCondition),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":logout": {N: aws.String(strconv.Itoa(int(session.LogoutTime)))},
+			":login":  {N: aws.String(strconv.Itoa(int(session.LoginTime)))},
+		},
+	}
+	if session.LogoutReason != "" {
+		update.UpdateExpression = aws.String("SET LogoutTime = :logout, LogoutReason = :reason")
+		update.ExpressionAttributeValues[":reason"] = &dynamodb.AttributeValue{S: aws.String(session.LogoutReason)}
+	}
+	return []*dynamodb.TransactWriteItem{
+		{Update: update},
+		{Put: &dynamodb.Put{TableName: aws.String(cfg.UserLoginTableName), Item: item}},
+	}, nil
+}
+
+// cancellationError returns an error for the first item of a cancelled
+// transaction that failed for any reason but its condition, such as throttling,
+// a conflicting transaction or validation, or nil if every item that failed
+// only failed its condition. The error carries the reason code as its AWS error
+// code, so it is classified by it.
+func cancellationError(err error) error {
+	var cancelled *dynamodb.TransactionCanceledException
+	if !errors.As(err, &cancelled) {
+		return err
+	}
+	for _, r := range cancelled.CancellationReasons {
+		switch code := aws.StringValue(r.Code); code {
+		case "", "None", "ConditionalCheckFailed":
+		default:
+			return awserr.New(code, aws.StringValue(r.Message), err)
+		}
+	}
+	return nil
+}
+
+// closeSessions closes the sessions, already given their logout time, in a
+// single transaction, returning the sessions closed. If the transaction is
+// cancelled because a session changed meanwhile, each session is retried on
+// its own and the changed ones skipped. A transaction cancelled for any other
+// reason fails.
+func closeSessions(cfg *Config, svc dynamodbiface.DynamoDBAPI, sessions []DynamoDbItem) ([]DynamoDbItem, error) {
+	input := &dynamodb.TransactWriteItemsInput{}
+	for _, s := range sessions {
+		items, err := closeItems(cfg, s)
+		if err != nil {
+			return nil, err
+		}
+		input.TransactItems = append(input.TransactItems, items...)
+	}
+	_, err := svc.TransactWriteItems(input)
+	if AWSErrorCode(err) == dynamodb.ErrCodeTransactionCanceledException {
+		if err := cancellationError(err); err != nil {
+			return nil, err
+		}
+		if len(sessions) == 1 {
+			fmt.Println("[closeSessions]", sessions[0].Username, "changed meanwhile, skipping")
+			return nil, nil
+		}
+		fmt.Println("[closeSessions]", "transaction cancelled, closing sessions one by one")
+		var closed []DynamoDbItem
+		for _, s := range sessions {
+			c, err := closeSessions(cfg, svc, []DynamoDbItem{s})
+			if err != nil {
+				return closed, err
+			}
+			closed = append(closed, c...)
+		}
+		return closed, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// CloseOpenSessions closes every open session in the login table at
+// logoutTime, tagged with reason, returning the sessions closed
+func CloseOpenSessions(cfg *Config, svc dynamodbiface.DynamoDBAPI, logoutTime time.Time, reason string) ([]DynamoDbItem, error) {
+	logins, err := GetLogins(cfg, svc)
+	if err != nil {
+		return nil, err
+	}
+	var open []DynamoDbItem
+	for _, l := range logins {
+		if l.Online() {
+			l.LogoutTime = int32(logoutTime.Unix())
+			l.LogoutReason = reason
+			open = append(open, l)
+		}
+	}
+	if len(open) == 0 {
+		fmt.Println("[CloseOpenSessions]", "All users already logged out. No action taken.")
+	}
+
+	closed := []DynamoDbItem{}
+	for start := 0; start < len(open); start += closeSessionsPerTransaction {
+		end := start + closeSessionsPerTransaction
+		if end > len(open) {
+			end = len(open)
+		}
+		c, err := closeSessions(cfg, svc, open[start:end])
+		closed = append(closed, c...)
+		if err != nil {
+			return closed, err
+		}
+	}
+	fmt.Println("[CloseOpenSessions]", "closed:", closed)
+	return closed, nil
+}
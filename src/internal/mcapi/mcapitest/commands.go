@@ -0,0 +1,34 @@
+package mcapitest
+
+import (
+	"time"
+)
+
+// FakeCommandRunner is an mcapi.CommandRunner remembering the commands it ran
+type FakeCommandRunner struct {
+	recorder
+	ran [][]string
+}
+
+// NewFakeCommandRunner creates and returns new FakeCommandRunner
+func NewFakeCommandRunner() *FakeCommandRunner {
+	return &FakeCommandRunner{}
+}
+
+// Run implements mcapi.CommandRunner
+func (f *FakeCommandRunner) Run(document string, commands []string, timeout time.Duration) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("Run"); err != nil {
+		return err
+	}
+	f.ran = append(f.ran, append([]string{document}, commands...))
+	return nil
+}
+
+// Ran returns the document and commands of each run so far, in order
+func (f *FakeCommandRunner) Ran() [][]string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([][]string(nil), f.ran...)
+}
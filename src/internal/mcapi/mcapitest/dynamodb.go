@@ -0,0 +1,413 @@
+package mcapitest
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+// item is a single dynamodb item
+type item map[string]*dynamodb.AttributeValue
+
+// FakeDynamoDB is an in-memory dynamodbiface.DynamoDBAPI. Tables are keyed on
+// PK/SK like the login table. Queries only support equality key conditions
+// joined with AND, which is all the handlers use.
+type FakeDynamoDB struct {
+	dynamodbiface.DynamoDBAPI
+	recorder
+	tables map[string][]item
+	// rangeKeys maps index names to the attribute query results are sorted by
+	rangeKeys map[string]string
+	// PageSize is the most items a Query returns at once, standing in for the
+	// 1 MB limit of the real table. Zero returns them all.
+	PageSize int
+}
+
+// NewFakeDynamoDB creates and returns new FakeDynamoDB with no items. The
+// Username and Version indexes of the login table are sorted like the real
+// table.
+func NewFakeDynamoDB() *FakeDynamoDB {
+	return &FakeDynamoDB{
+		tables: map[string][]item{},
+		rangeKeys: map[string]string{
+			"Username": "LoginTime",
+			"Version":  "PK",
+		},
+	}
+}
+
+// Items returns a copy of every item in the table
+func (f *FakeDynamoDB) Items(table string) []map[string]*dynamodb.AttributeValue {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var items []map[string]*dynamodb.AttributeValue
+	for _, i := range f.tables[table] {
+		items = append(items, i)
+	}
+	return items
+}
+
+// key returns the primary key of i
+func key(i item) string {
+	var pk, sk string
+	if v := i["PK"]; v != nil {
+		pk = aws.StringValue(v.S)
+	}
+	if v := i["SK"]; v != nil {
+		sk = aws.StringValue(v.S)
+	}
+	return pk + "/" + sk
+}
+
+// Put stores an item directly, replacing any item with the same key
+func (f *FakeDynamoDB) Put(table string, i map[string]*dynamodb.AttributeValue) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.put(table, i)
+}
+
+func (f *FakeDynamoDB) put(table string, i item) {
+	if n := f.find(table, i); n >= 0 {
+		f.tables[table][n] = i
+		return
+	}
+	f.tables[table] = append(f.tables[table], i)
+}
+
+// PutItem stores the item, replacing any item with the same key, if the
+// condition holds for the item it replaces
+func (f *FakeDynamoDB) PutItem(input *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("PutItem"); err != nil {
+		return nil, err
+	}
+	table := aws.StringValue(input.TableName)
+	current := item{}
+	if n := f.find(table, input.Item); n >= 0 {
+		current = f.tables[table][n]
+	}
+	ok, err := matches(current, aws.StringValue(input.ConditionExpression), input.ExpressionAttributeNames, input.ExpressionAttributeValues)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "The conditional request failed", nil)
+	}
+	f.put(table, input.Item)
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+// conditions parses an equality key condition expression into attribute name
+// and value pairs
+func conditions(expr string, names map[string]*string, values map[string]*dynamodb.AttributeValue) (map[string]*dynamodb.AttributeValue, error) {
+	conds := map[string]*dynamodb.AttributeValue{}
+	for _, part := range strings.Split(expr, " AND ") {
+		fields := strings.Fields(part)
+		if len(fields) != 3 || fields[1] != "=" {
+			return nil, awserr.New("ValidationException", "unsupported key condition: "+part, nil)
+		}
+		name := fields[0]
+		if n, ok := names[name]; ok {
+			name = aws.StringValue(n)
+		}
+		value, ok := values[fields[2]]
+		if !ok {
+			return nil, awserr.New("ValidationException", "missing value for "+fields[2], nil)
+		}
+		conds[name] = value
+	}
+	return conds, nil
+}
+
+// less orders attribute values by number or string
+func less(a, b *dynamodb.AttributeValue) bool {
+	if a == nil || b == nil {
+		return b != nil
+	}
+	if a.N != nil && b.N != nil {
+		var x, y float64
+		fmt.Sscan(aws.StringValue(a.N), &x)
+		fmt.Sscan(aws.StringValue(b.N), &y)
+		return x < y
+	}
+	return aws.StringValue(a.S) < aws.StringValue(b.S)
+}
+
+// Query returns the items matching the key condition, sorted by the range key
+// of the queried index
+func (f *FakeDynamoDB) Query(input *dynamodb.QueryInput) (*dynamodb.QueryOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("Query"); err != nil {
+		return nil, err
+	}
+	conds, err := conditions(aws.StringValue(input.KeyConditionExpression), input.ExpressionAttributeNames, input.ExpressionAttributeValues)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []map[string]*dynamodb.AttributeValue
+	for _, i := range f.tables[aws.StringValue(input.TableName)] {
+		matches := true
+		for name, value := range conds {
+			if i[name] == nil || i[name].String() != value.String() {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			items = append(items, i)
+		}
+	}
+
+	rangeKey := "SK"
+	if input.IndexName != nil {
+		rangeKey = f.rangeKeys[aws.StringValue(input.IndexName)]
+	}
+	if rangeKey != "" {
+		sort.SliceStable(items, func(a, b int) bool {
+			return less(items[a][rangeKey], items[b][rangeKey])
+		})
+	}
+	if input.ScanIndexForward != nil && !*input.ScanIndexForward {
+		for a, b := 0, len(items)-1; a < b; a, b = a+1, b-1 {
+			items[a], items[b] = items[b], items[a]
+		}
+	}
+	if input.ExclusiveStartKey != nil {
+		start := key(input.ExclusiveStartKey)
+		for n, i := range items {
+			if key(i) == start {
+				items = items[n+1:]
+				break
+			}
+		}
+	}
+	output := &dynamodb.QueryOutput{}
+	if f.PageSize > 0 && len(items) > f.PageSize {
+		items = items[:f.PageSize]
+		last := items[len(items)-1]
+		output.LastEvaluatedKey = map[string]*dynamodb.AttributeValue{"PK": last["PK"], "SK": last["SK"]}
+	}
+	output.Items = items
+	output.Count = aws.Int64(int64(len(items)))
+	return output, nil
+}
+
+// find returns the index of the item with the given key in the table, or -1
+func (f *FakeDynamoDB) find(table string, k map[string]*dynamodb.AttributeValue) int {
+	for n, i := range f.tables[table] {
+		if key(i) == key(k) {
+			return n
+		}
+	}
+	return -1
+}
+
+// GetItem returns the item with the given key, or no item
+func (f *FakeDynamoDB) GetItem(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("GetItem"); err != nil {
+		return nil, err
+	}
+	table := aws.StringValue(input.TableName)
+	output := &dynamodb.GetItemOutput{}
+	if n := f.find(table, input.Key); n >= 0 {
+		output.Item = f.tables[table][n]
+	}
+	return output, nil
+}
+
+// DeleteItem removes the item with the given key, returning it when asked for
+// ALL_OLD. Deleting a missing item succeeds.
+func (f *FakeDynamoDB) DeleteItem(input *dynamodb.DeleteItemInput) (*dynamodb.DeleteItemOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("DeleteItem"); err != nil {
+		return nil, err
+	}
+	table := aws.StringValue(input.TableName)
+	output := &dynamodb.DeleteItemOutput{}
+	n := f.find(table, input.Key)
+	if n < 0 {
+		return output, nil
+	}
+	if aws.StringValue(input.ReturnValues) == dynamodb.ReturnValueAllOld {
+		output.Attributes = f.tables[table][n]
+	}
+	f.tables[table] = append(f.tables[table][:n], f.tables[table][n+1:]...)
+	return output, nil
+}
+
+// operand returns the value of an expression operand: a :value placeholder or
+// an attribute name
+func operand(i item, name string, names map[string]*string, values map[string]*dynamodb.AttributeValue) *dynamodb.AttributeValue {
+	if strings.HasPrefix(name, ":") {
+		return values[name]
+	}
+	if n, ok := names[name]; ok {
+		name = aws.StringValue(n)
+	}
+	return i[name]
+}
+
+// matches evaluates a condition expression against i. Conditions are
+// comparisons with = or < and attribute_exists/attribute_not_exists, joined
+// with AND, with OR inside parentheses.
+func matches(i item, expr string, names map[string]*string, values map[string]*dynamodb.AttributeValue) (bool, error) {
+	if expr == "" {
+		return true, nil
+	}
+	for _, and := range strings.Split(expr, " AND ") {
+		held := false
+		if strings.HasPrefix(and, "(") && strings.HasSuffix(and, ")") {
+			and = and[1 : len(and)-1]
+		}
+		for _, or := range strings.Split(and, " OR ") {
+			ok, err := compare(i, strings.TrimSpace(or), names, values)
+			if err != nil {
+				return false, err
+			}
+			held = held || ok
+		}
+		if !held {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// compare evaluates a single comparison or function of a condition expression
+func compare(i item, cond string, names map[string]*string, values map[string]*dynamodb.AttributeValue) (bool, error) {
+	for _, fn := range []string{"attribute_not_exists", "attribute_exists"} {
+		if strings.HasPrefix(cond, fn+"(") && strings.HasSuffix(cond, ")") {
+			exists := operand(i, cond[len(fn)+1:len(cond)-1], names, values) != nil
+			return exists == (fn == "attribute_exists"), nil
+		}
+	}
+	fields := strings.Fields(cond)
+	if len(fields) != 3 {
+		return false, awserr.New("ValidationException", "unsupported condition: "+cond, nil)
+	}
+	a, b := operand(i, fields[0], names, values), operand(i, fields[2], names, values)
+	switch fields[1] {
+	case "=":
+		return a != nil && b != nil && a.String() == b.String(), nil
+	case "<":
+		return a != nil && b != nil && less(a, b), nil
+	}
+	return false, awserr.New("ValidationException", "unsupported condition: "+cond, nil)
+}
+
+// update applies a SET update expression to a copy of i
+func update(i item, expr string, names map[string]*string, values map[string]*dynamodb.AttributeValue) (item, error) {
+	if !strings.HasPrefix(expr, "SET ") {
+		return nil, awserr.New("ValidationException", "unsupported update: "+expr, nil)
+	}
+	updated := item{}
+	for name, value := range i {
+		updated[name] = value
+	}
+	for _, set := range strings.Split(strings.TrimPrefix(expr, "SET "), ",") {
+		fields := strings.Fields(set)
+		if len(fields) != 3 || fields[1] != "=" || values[fields[2]] == nil {
+			return nil, awserr.New("ValidationException", "unsupported update: "+set, nil)
+		}
+		name := fields[0]
+		if n, ok := names[name]; ok {
+			name = aws.StringValue(n)
+		}
+		updated[name] = values[fields[2]]
+	}
+	return updated, nil
+}
+
+// TransactWriteItems applies the puts, updates and deletes all together if
+// every condition holds, or cancels the transaction with the reason of each
+// item
+func (f *FakeDynamoDB) TransactWriteItems(input *dynamodb.TransactWriteItemsInput) (*dynamodb.TransactWriteItemsOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("TransactWriteItems"); err != nil {
+		return nil, err
+	}
+
+	type write struct {
+		table  string
+		item   item
+		delete bool
+	}
+	var writes []write
+	var reasons []*dynamodb.CancellationReason
+	cancelled := false
+	for _, t := range input.TransactItems {
+		var table, cond string
+		var key item
+		var names map[string]*string
+		var values map[string]*dynamodb.AttributeValue
+		switch {
+		case t.Put != nil:
+			table, cond, key = aws.StringValue(t.Put.TableName), aws.StringValue(t.Put.ConditionExpression), t.Put.Item
+			names, values = t.Put.ExpressionAttributeNames, t.Put.ExpressionAttributeValues
+		case t.Update != nil:
+			table, cond, key = aws.StringValue(t.Update.TableName), aws.StringValue(t.Update.ConditionExpression), t.Update.Key
+			names, values = t.Update.ExpressionAttributeNames, t.Update.ExpressionAttributeValues
+		case t.Delete != nil:
+			table, cond, key = aws.StringValue(t.Delete.TableName), aws.StringValue(t.Delete.ConditionExpression), t.Delete.Key
+			names, values = t.Delete.ExpressionAttributeNames, t.Delete.ExpressionAttributeValues
+		default:
+			return nil, awserr.New("ValidationException", "unsupported transaction item", nil)
+		}
+
+		current, found := item{}, false
+		if n := f.find(table, key); n >= 0 {
+			current, found = f.tables[table][n], true
+		}
+		ok, err := matches(current, cond, names, values)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			cancelled = true
+			reasons = append(reasons, &dynamodb.CancellationReason{Code: aws.String("ConditionalCheckFailed")})
+			continue
+		}
+		reasons = append(reasons, &dynamodb.CancellationReason{Code: aws.String("None")})
+
+		next := key
+		if t.Update != nil {
+			// updating a missing item creates it
+			if !found {
+				current = key
+			}
+			next, err = update(current, aws.StringValue(t.Update.UpdateExpression), names, values)
+			if err != nil {
+				return nil, err
+			}
+		}
+		writes = append(writes, write{table, next, t.Delete != nil})
+	}
+	if cancelled {
+		return nil, &dynamodb.TransactionCanceledException{
+			Message_:            aws.String("Transaction cancelled"),
+			CancellationReasons: reasons,
+		}
+	}
+	for _, w := range writes {
+		if !w.delete {
+			f.put(w.table, w.item)
+			continue
+		}
+		if n := f.find(w.table, w.item); n >= 0 {
+			f.tables[w.table] = append(f.tables[w.table][:n], f.tables[w.table][n+1:]...)
+		}
+	}
+	return &dynamodb.TransactWriteItemsOutput{}, nil
+}
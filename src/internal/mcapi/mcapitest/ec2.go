@@ -0,0 +1,522 @@
+package mcapitest
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+)
+
+// Zone is the availability zone of every fake instance
+const Zone = "us-east-1a"
+
+// FakeEC2 is an in-memory ec2iface.EC2API tracking instance states, their
+// volumes and the snapshots taken of them. Unknown instance IDs are left out
+// of results, mirroring an empty API response.
+type FakeEC2 struct {
+	ec2iface.EC2API
+	recorder
+	states map[string]string
+	// volumes maps instance IDs to their volume IDs by device name
+	volumes     map[string]map[string]string
+	rootDevices map[string]string
+	// detached holds the volumes not attached to any instance
+	detached  map[string]*ec2.Volume
+	launched  map[string]time.Time
+	addresses map[string][2]string
+	private   map[string]string
+	checks    map[string][2]string
+	created   int
+	snapshots []*ec2.Snapshot
+}
+
+// NewFakeEC2 creates and returns new FakeEC2 with no instances
+func NewFakeEC2() *FakeEC2 {
+	return &FakeEC2{
+		states:      map[string]string{},
+		volumes:     map[string]map[string]string{},
+		rootDevices: map[string]string{},
+		detached:    map[string]*ec2.Volume{},
+		launched:    map[string]time.Time{},
+		addresses:   map[string][2]string{},
+		private:     map[string]string{},
+		checks:      map[string][2]string{},
+	}
+}
+
+// SetAddress gives the instance a public IP address and DNS name, reported
+// while it is running
+func (f *FakeEC2) SetAddress(instanceID, ip, dns string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.addresses[instanceID] = [2]string{ip, dns}
+}
+
+// SetPrivateAddress gives the instance a private IP address, kept in every
+// state
+func (f *FakeEC2) SetPrivateAddress(instanceID, ip string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.private[instanceID] = ip
+}
+
+// SetLaunchTime sets the time the instance was last started. StartInstances
+// sets it to now.
+func (f *FakeEC2) SetLaunchTime(instanceID string, t time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.launched[instanceID] = t
+}
+
+// SetChecks sets the system and instance status check results of the
+// instance. Without them running instances pass both checks.
+func (f *FakeEC2) SetChecks(instanceID, system, instance string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.checks[instanceID] = [2]string{system, instance}
+}
+
+// SetState adds the instance or moves it to the given state name
+func (f *FakeEC2) SetState(instanceID, state string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.states[instanceID] = state
+}
+
+// State returns the current state name of the instance
+func (f *FakeEC2) State(instanceID string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.states[instanceID]
+}
+
+// transition moves every known instance in ids to state and returns the
+// resulting state changes
+func (f *FakeEC2) transition(ids []*string, state string) []*ec2.InstanceStateChange {
+	var changes []*ec2.InstanceStateChange
+	for _, id := range aws.StringValueSlice(ids) {
+		previous, ok := f.states[id]
+		if !ok {
+			continue
+		}
+		f.states[id] = state
+		changes = append(changes, &ec2.InstanceStateChange{
+			InstanceId:    aws.String(id),
+			PreviousState: &ec2.InstanceState{Name: aws.String(previous)},
+			CurrentState:  &ec2.InstanceState{Name: aws.String(state)},
+		})
+	}
+	return changes
+}
+
+// StartInstances moves the instances to pending, failing for instances that
+// are still stopping
+func (f *FakeEC2) StartInstances(input *ec2.StartInstancesInput) (*ec2.StartInstancesOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("StartInstances"); err != nil {
+		return nil, err
+	}
+	// like EC2, refuse to start an instance that has not finished stopping
+	for _, id := range aws.StringValueSlice(input.InstanceIds) {
+		if f.states[id] == ec2.InstanceStateNameStopping {
+			return nil, awserr.New("IncorrectInstanceState", "The instance '"+id+"' is not in a state from which it can be started.", nil)
+		}
+	}
+	changes := f.transition(input.InstanceIds, ec2.InstanceStateNamePending)
+	for _, c := range changes {
+		f.launched[aws.StringValue(c.InstanceId)] = time.Now()
+	}
+	return &ec2.StartInstancesOutput{StartingInstances: changes}, nil
+}
+
+// StopInstances moves the instances to stopping
+func (f *FakeEC2) StopInstances(input *ec2.StopInstancesInput) (*ec2.StopInstancesOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("StopInstances"); err != nil {
+		return nil, err
+	}
+	changes := f.transition(input.InstanceIds, ec2.InstanceStateNameStopping)
+	return &ec2.StopInstancesOutput{StoppingInstances: changes}, nil
+}
+
+// DescribeInstanceStatus returns the state and status checks of every known
+// instance in the input
+func (f *FakeEC2) DescribeInstanceStatus(input *ec2.DescribeInstanceStatusInput) (*ec2.DescribeInstanceStatusOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("DescribeInstanceStatus"); err != nil {
+		return nil, err
+	}
+	output := &ec2.DescribeInstanceStatusOutput{}
+	for _, id := range aws.StringValueSlice(input.InstanceIds) {
+		state, ok := f.states[id]
+		if !ok {
+			continue
+		}
+		checks, ok := f.checks[id]
+		switch {
+		case ok:
+		case state == ec2.InstanceStateNameRunning:
+			checks = [2]string{ec2.SummaryStatusOk, ec2.SummaryStatusOk}
+		default:
+			checks = [2]string{ec2.SummaryStatusNotApplicable, ec2.SummaryStatusNotApplicable}
+		}
+		output.InstanceStatuses = append(output.InstanceStatuses, &ec2.InstanceStatus{
+			InstanceId:     aws.String(id),
+			InstanceState:  &ec2.InstanceState{Name: aws.String(state)},
+			SystemStatus:   &ec2.InstanceStatusSummary{Status: aws.String(checks[0])},
+			InstanceStatus: &ec2.InstanceStatusSummary{Status: aws.String(checks[1])},
+		})
+	}
+	return output, nil
+}
+
+// SetVolume attaches the EBS volume to the instance as device. The first
+// device attached is the root device.
+func (f *FakeEC2) SetVolume(instanceID, device, volumeID string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.volumes[instanceID] == nil {
+		f.volumes[instanceID] = map[string]string{}
+		f.rootDevices[instanceID] = device
+	}
+	f.volumes[instanceID][device] = volumeID
+}
+
+// Volume returns the ID of the volume attached to the instance as device
+func (f *FakeEC2) Volume(instanceID, device string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.volumes[instanceID][device]
+}
+
+// Detached returns the detached volume with the ID, or nil
+func (f *FakeEC2) Detached(volumeID string) *ec2.Volume {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.detached[volumeID]
+}
+
+// Snapshots returns every snapshot, in the order they were taken
+func (f *FakeEC2) Snapshots() []*ec2.Snapshot {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]*ec2.Snapshot(nil), f.snapshots...)
+}
+
+// AddSnapshot stores a snapshot directly
+func (f *FakeEC2) AddSnapshot(snapshot *ec2.Snapshot) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.snapshots = append(f.snapshots, snapshot)
+}
+
+// DescribeInstances returns every known instance in the input with its state,
+// launch time and volumes, and its public address while running
+func (f *FakeEC2) DescribeInstances(input *ec2.DescribeInstancesInput) (*ec2.DescribeInstancesOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("DescribeInstances"); err != nil {
+		return nil, err
+	}
+	output := &ec2.DescribeInstancesOutput{}
+	for _, id := range aws.StringValueSlice(input.InstanceIds) {
+		state, ok := f.states[id]
+		if !ok {
+			continue
+		}
+		instance := &ec2.Instance{
+			InstanceId:     aws.String(id),
+			State:          &ec2.InstanceState{Name: aws.String(state)},
+			RootDeviceName: aws.String(f.rootDevices[id]),
+			Placement:      &ec2.Placement{AvailabilityZone: aws.String(Zone)},
+		}
+		if t, ok := f.launched[id]; ok {
+			instance.LaunchTime = aws.Time(t)
+		}
+		if ip, ok := f.private[id]; ok {
+			instance.PrivateIpAddress = aws.String(ip)
+		}
+		if a, ok := f.addresses[id]; ok && state == ec2.InstanceStateNameRunning {
+			instance.PublicIpAddress = aws.String(a[0])
+			instance.PublicDnsName = aws.String(a[1])
+		}
+		for device, volumeID := range f.volumes[id] {
+			instance.BlockDeviceMappings = append(instance.BlockDeviceMappings, &ec2.InstanceBlockDeviceMapping{
+				DeviceName: aws.String(device),
+				Ebs:        &ec2.EbsInstanceBlockDevice{VolumeId: aws.String(volumeID)},
+			})
+		}
+		output.Reservations = append(output.Reservations, &ec2.Reservation{Instances: []*ec2.Instance{instance}})
+	}
+	return output, nil
+}
+
+// CreateSnapshot takes a pending snapshot of the volume, with the tags of the
+// snapshot tag specification
+func (f *FakeEC2) CreateSnapshot(input *ec2.CreateSnapshotInput) (*ec2.Snapshot, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("CreateSnapshot"); err != nil {
+		return nil, err
+	}
+	snapshot := &ec2.Snapshot{
+		SnapshotId:  aws.String(fmt.Sprintf("snap-%017d", len(f.snapshots)+1)),
+		VolumeId:    input.VolumeId,
+		Description: input.Description,
+		StartTime:   aws.Time(time.Now()),
+		State:       aws.String(ec2.SnapshotStatePending),
+		Progress:    aws.String("0%"),
+		VolumeSize:  aws.Int64(8),
+	}
+	for _, spec := range input.TagSpecifications {
+		if aws.StringValue(spec.ResourceType) == ec2.ResourceTypeSnapshot {
+			snapshot.Tags = append(snapshot.Tags, spec.Tags...)
+		}
+	}
+	f.snapshots = append(f.snapshots, snapshot)
+	return snapshot, nil
+}
+
+// matchesFilters reports whether the snapshot matches every tag: filter
+func matchesFilters(snapshot *ec2.Snapshot, filters []*ec2.Filter) bool {
+	for _, filter := range filters {
+		name := aws.StringValue(filter.Name)
+		if !strings.HasPrefix(name, "tag:") {
+			continue
+		}
+		found := false
+		for _, t := range snapshot.Tags {
+			for _, v := range filter.Values {
+				if aws.StringValue(t.Key) == strings.TrimPrefix(name, "tag:") && aws.StringValue(t.Value) == aws.StringValue(v) {
+					found = true
+				}
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// DescribeSnapshots returns the snapshots in the input, or those matching its
+// tag filters
+func (f *FakeEC2) DescribeSnapshots(input *ec2.DescribeSnapshotsInput) (*ec2.DescribeSnapshotsOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("DescribeSnapshots"); err != nil {
+		return nil, err
+	}
+	ids := map[string]bool{}
+	for _, id := range aws.StringValueSlice(input.SnapshotIds) {
+		ids[id] = true
+	}
+	output := &ec2.DescribeSnapshotsOutput{}
+	for _, s := range f.snapshots {
+		if len(ids) > 0 && !ids[aws.StringValue(s.SnapshotId)] {
+			continue
+		}
+		if matchesFilters(s, input.Filters) {
+			output.Snapshots = append(output.Snapshots, s)
+		}
+	}
+	return output, nil
+}
+
+// DescribeSnapshotsPages calls fn with every snapshot as a single page
+func (f *FakeEC2) DescribeSnapshotsPages(input *ec2.DescribeSnapshotsInput, fn func(*ec2.DescribeSnapshotsOutput, bool) bool) error {
+	output, err := f.DescribeSnapshots(input)
+	if err != nil {
+		return err
+	}
+	fn(output, true)
+	return nil
+}
+
+// DeleteSnapshot removes the snapshot
+func (f *FakeEC2) DeleteSnapshot(input *ec2.DeleteSnapshotInput) (*ec2.DeleteSnapshotOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("DeleteSnapshot"); err != nil {
+		return nil, err
+	}
+	for n, s := range f.snapshots {
+		if aws.StringValue(s.SnapshotId) == aws.StringValue(input.SnapshotId) {
+			f.snapshots = append(f.snapshots[:n], f.snapshots[n+1:]...)
+			return &ec2.DeleteSnapshotOutput{}, nil
+		}
+	}
+	return nil, awserr.New("InvalidSnapshot.NotFound", "The snapshot '"+aws.StringValue(input.SnapshotId)+"' does not exist.", nil)
+}
+
+// attachedTo returns the instance and device the volume is attached as
+func (f *FakeEC2) attachedTo(volumeID string) (instanceID, device string, ok bool) {
+	for id, devices := range f.volumes {
+		for d, v := range devices {
+			if v == volumeID {
+				return id, d, true
+			}
+		}
+	}
+	return "", "", false
+}
+
+// volumeNotFound returns the error EC2 returns for unknown volumes
+func volumeNotFound(volumeID string) error {
+	return awserr.New("InvalidVolume.NotFound", "The volume '"+volumeID+"' does not exist.", nil)
+}
+
+// DescribeVolumes returns the volumes in the input. Attached volumes are
+// in-use gp2 volumes.
+func (f *FakeEC2) DescribeVolumes(input *ec2.DescribeVolumesInput) (*ec2.DescribeVolumesOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("DescribeVolumes"); err != nil {
+		return nil, err
+	}
+	output := &ec2.DescribeVolumesOutput{}
+	for _, id := range aws.StringValueSlice(input.VolumeIds) {
+		if v, ok := f.detached[id]; ok {
+			output.Volumes = append(output.Volumes, v)
+			continue
+		}
+		instanceID, device, ok := f.attachedTo(id)
+		if !ok {
+			return nil, volumeNotFound(id)
+		}
+		output.Volumes = append(output.Volumes, &ec2.Volume{
+			VolumeId:         aws.String(id),
+			VolumeType:       aws.String(ec2.VolumeTypeGp2),
+			AvailabilityZone: aws.String(Zone),
+			State:            aws.String(ec2.VolumeStateInUse),
+			Attachments: []*ec2.VolumeAttachment{{
+				InstanceId: aws.String(instanceID),
+				Device:     aws.String(device),
+				State:      aws.String(ec2.VolumeAttachmentStateAttached),
+			}},
+		})
+	}
+	return output, nil
+}
+
+// WaitUntilVolumeAvailableWithContext returns at once, failing if ctx is done
+// or unless every volume in the input is detached
+func (f *FakeEC2) WaitUntilVolumeAvailableWithContext(ctx aws.Context, input *ec2.DescribeVolumesInput, opts ...request.WaiterOption) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("WaitUntilVolumeAvailable"); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return awserr.New(request.CanceledErrorCode, "waiter context canceled", err)
+	}
+	for _, id := range aws.StringValueSlice(input.VolumeIds) {
+		if _, ok := f.detached[id]; !ok {
+			return awserr.New("ResourceNotReady", "exceeded wait attempts", nil)
+		}
+	}
+	return nil
+}
+
+// CreateVolume creates an available volume, with the tags of the volume tag
+// specification
+func (f *FakeEC2) CreateVolume(input *ec2.CreateVolumeInput) (*ec2.Volume, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("CreateVolume"); err != nil {
+		return nil, err
+	}
+	f.created++
+	volume := &ec2.Volume{
+		VolumeId:         aws.String(fmt.Sprintf("vol-%017d", f.created)),
+		SnapshotId:       input.SnapshotId,
+		AvailabilityZone: input.AvailabilityZone,
+		VolumeType:       input.VolumeType,
+		State:            aws.String(ec2.VolumeStateAvailable),
+	}
+	for _, spec := range input.TagSpecifications {
+		if aws.StringValue(spec.ResourceType) == ec2.ResourceTypeVolume {
+			volume.Tags = append(volume.Tags, spec.Tags...)
+		}
+	}
+	f.detached[aws.StringValue(volume.VolumeId)] = volume
+	return volume, nil
+}
+
+// DeleteVolume deletes a detached volume
+func (f *FakeEC2) DeleteVolume(input *ec2.DeleteVolumeInput) (*ec2.DeleteVolumeOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("DeleteVolume"); err != nil {
+		return nil, err
+	}
+	id := aws.StringValue(input.VolumeId)
+	if _, ok := f.detached[id]; !ok {
+		return nil, volumeNotFound(id)
+	}
+	delete(f.detached, id)
+	return &ec2.DeleteVolumeOutput{}, nil
+}
+
+// DetachVolume detaches the volume from its instance
+func (f *FakeEC2) DetachVolume(input *ec2.DetachVolumeInput) (*ec2.VolumeAttachment, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("DetachVolume"); err != nil {
+		return nil, err
+	}
+	id := aws.StringValue(input.VolumeId)
+	instanceID, device, ok := f.attachedTo(id)
+	if !ok {
+		return nil, volumeNotFound(id)
+	}
+	delete(f.volumes[instanceID], device)
+	f.detached[id] = &ec2.Volume{
+		VolumeId:         aws.String(id),
+		VolumeType:       aws.String(ec2.VolumeTypeGp2),
+		AvailabilityZone: aws.String(Zone),
+		State:            aws.String(ec2.VolumeStateAvailable),
+	}
+	return &ec2.VolumeAttachment{
+		InstanceId: aws.String(instanceID),
+		VolumeId:   aws.String(id),
+		Device:     aws.String(device),
+		State:      aws.String(ec2.VolumeAttachmentStateDetaching),
+	}, nil
+}
+
+// AttachVolume attaches a detached volume to the instance as device, failing
+// if the device is taken
+func (f *FakeEC2) AttachVolume(input *ec2.AttachVolumeInput) (*ec2.VolumeAttachment, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("AttachVolume"); err != nil {
+		return nil, err
+	}
+	id, instanceID, device := aws.StringValue(input.VolumeId), aws.StringValue(input.InstanceId), aws.StringValue(input.Device)
+	if _, ok := f.detached[id]; !ok {
+		return nil, volumeNotFound(id)
+	}
+	if _, taken := f.volumes[instanceID][device]; taken {
+		return nil, awserr.New("InvalidParameterValue", "Attachment point "+device+" is already in use", nil)
+	}
+	if f.volumes[instanceID] == nil {
+		f.volumes[instanceID] = map[string]string{}
+	}
+	delete(f.detached, id)
+	f.volumes[instanceID][device] = id
+	return &ec2.VolumeAttachment{
+		InstanceId: input.InstanceId,
+		VolumeId:   input.VolumeId,
+		Device:     input.Device,
+		State:      aws.String(ec2.VolumeAttachmentStateAttaching),
+	}, nil
+}
@@ -0,0 +1,152 @@
+package mcapitest
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/cloudwatchevents"
+	"github.com/aws/aws-sdk-go/service/cloudwatchevents/cloudwatcheventsiface"
+)
+
+// FakeEvents is an in-memory cloudwatcheventsiface.CloudWatchEventsAPI holding
+// rules and their targets
+type FakeEvents struct {
+	cloudwatcheventsiface.CloudWatchEventsAPI
+	recorder
+	rules   map[string]*cloudwatchevents.PutRuleInput
+	targets map[string]map[string]*cloudwatchevents.Target
+}
+
+// NewFakeEvents creates and returns new FakeEvents with no rules
+func NewFakeEvents() *FakeEvents {
+	return &FakeEvents{
+		rules:   map[string]*cloudwatchevents.PutRuleInput{},
+		targets: map[string]map[string]*cloudwatchevents.Target{},
+	}
+}
+
+// Rule returns the last PutRule input for the rule, or nil if it does not
+// exist
+func (f *FakeEvents) Rule(name string) *cloudwatchevents.PutRuleInput {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.rules[name]
+}
+
+// Targets returns the targets of the rule keyed by target ID
+func (f *FakeEvents) Targets(name string) map[string]*cloudwatchevents.Target {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	targets := map[string]*cloudwatchevents.Target{}
+	for id, t := range f.targets[name] {
+		targets[id] = t
+	}
+	return targets
+}
+
+func ruleNotFound(name string) error {
+	return awserr.New(cloudwatchevents.ErrCodeResourceNotFoundException, "Rule "+name+" does not exist.", nil)
+}
+
+// PutRule creates or replaces the rule
+func (f *FakeEvents) PutRule(input *cloudwatchevents.PutRuleInput) (*cloudwatchevents.PutRuleOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("PutRule"); err != nil {
+		return nil, err
+	}
+	name := aws.StringValue(input.Name)
+	f.rules[name] = input
+	return &cloudwatchevents.PutRuleOutput{RuleArn: aws.String("arn:aws:events:us-east-1:123456789012:rule/" + name)}, nil
+}
+
+// PutTargets adds or replaces targets on an existing rule
+func (f *FakeEvents) PutTargets(input *cloudwatchevents.PutTargetsInput) (*cloudwatchevents.PutTargetsOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("PutTargets"); err != nil {
+		return nil, err
+	}
+	name := aws.StringValue(input.Rule)
+	if _, ok := f.rules[name]; !ok {
+		return nil, ruleNotFound(name)
+	}
+	if f.targets[name] == nil {
+		f.targets[name] = map[string]*cloudwatchevents.Target{}
+	}
+	for _, t := range input.Targets {
+		f.targets[name][aws.StringValue(t.Id)] = t
+	}
+	return &cloudwatchevents.PutTargetsOutput{FailedEntryCount: aws.Int64(0)}, nil
+}
+
+// RemoveTargets removes targets from an existing rule
+func (f *FakeEvents) RemoveTargets(input *cloudwatchevents.RemoveTargetsInput) (*cloudwatchevents.RemoveTargetsOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("RemoveTargets"); err != nil {
+		return nil, err
+	}
+	name := aws.StringValue(input.Rule)
+	if _, ok := f.rules[name]; !ok {
+		return nil, ruleNotFound(name)
+	}
+	for _, id := range aws.StringValueSlice(input.Ids) {
+		delete(f.targets[name], id)
+	}
+	return &cloudwatchevents.RemoveTargetsOutput{FailedEntryCount: aws.Int64(0)}, nil
+}
+
+// DeleteRule deletes the rule. Like the real service, deleting a missing rule
+// succeeds, but deleting a rule that still has targets fails.
+func (f *FakeEvents) DeleteRule(input *cloudwatchevents.DeleteRuleInput) (*cloudwatchevents.DeleteRuleOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("DeleteRule"); err != nil {
+		return nil, err
+	}
+	name := aws.StringValue(input.Name)
+	if len(f.targets[name]) > 0 {
+		return nil, awserr.New("ValidationException", "Rule can't be deleted since it has targets.", nil)
+	}
+	delete(f.rules, name)
+	delete(f.targets, name)
+	return &cloudwatchevents.DeleteRuleOutput{}, nil
+}
+
+// DescribeRule returns the name, schedule and state of an existing rule
+func (f *FakeEvents) DescribeRule(input *cloudwatchevents.DescribeRuleInput) (*cloudwatchevents.DescribeRuleOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("DescribeRule"); err != nil {
+		return nil, err
+	}
+	name := aws.StringValue(input.Name)
+	rule, ok := f.rules[name]
+	if !ok {
+		return nil, ruleNotFound(name)
+	}
+	return &cloudwatchevents.DescribeRuleOutput{
+		Name:               rule.Name,
+		Description:        rule.Description,
+		ScheduleExpression: rule.ScheduleExpression,
+		State:              rule.State,
+	}, nil
+}
+
+// ListTargetsByRule returns every target of an existing rule in one page
+func (f *FakeEvents) ListTargetsByRule(input *cloudwatchevents.ListTargetsByRuleInput) (*cloudwatchevents.ListTargetsByRuleOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("ListTargetsByRule"); err != nil {
+		return nil, err
+	}
+	name := aws.StringValue(input.Rule)
+	if _, ok := f.rules[name]; !ok {
+		return nil, ruleNotFound(name)
+	}
+	output := &cloudwatchevents.ListTargetsByRuleOutput{}
+	for _, t := range f.targets[name] {
+		output.Targets = append(output.Targets, t)
+	}
+	return output, nil
+}
@@ -0,0 +1,56 @@
+package mcapitest
+
+import (
+	"encoding/json"
+)
+
+// Invocation is an invocation queued with FakeInvoker
+type Invocation struct {
+	Function string
+	// Payload is the JSON event the function is invoked with
+	Payload []byte
+}
+
+// FakeInvoker is an mcapi.Invoker queueing invocations instead of running
+// them, so tests and the local simulator can run them when they choose
+type FakeInvoker struct {
+	recorder
+	invocations []Invocation
+	taken       int
+}
+
+// NewFakeInvoker creates and returns new FakeInvoker
+func NewFakeInvoker() *FakeInvoker {
+	return &FakeInvoker{}
+}
+
+// Invoke implements mcapi.Invoker
+func (f *FakeInvoker) Invoke(function string, payload interface{}) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("Invoke"); err != nil {
+		return err
+	}
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	f.invocations = append(f.invocations, Invocation{Function: function, Payload: b})
+	return nil
+}
+
+// Invocations returns every invocation queued so far, in order
+func (f *FakeInvoker) Invocations() []Invocation {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Invocation(nil), f.invocations...)
+}
+
+// Take returns the invocations queued since the last Take, in order
+func (f *FakeInvoker) Take() []Invocation {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	taken := append([]Invocation(nil), f.invocations[f.taken:]...)
+	f.taken = len(f.invocations)
+	return taken
+}
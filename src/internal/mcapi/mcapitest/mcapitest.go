@@ -0,0 +1,147 @@
+// Package mcapitest provides in-memory fakes of the AWS services used by the
+// minecraft API handlers, so handlers can be exercised without credentials.
+//
+// Each fake embeds its SDK interface, so calling an operation the fake does not
+// implement panics rather than silently succeeding.
+package mcapitest
+
+import (
+	"sync"
+	"time"
+
+	"mcapi"
+)
+
+// InstanceID is the instance ID used by Config
+const InstanceID = "i-0123456789abcdef0"
+
+// PrivateIP is the private IP address NewClients gives the instance
+const PrivateIP = "10.0.0.7"
+
+// Config returns a Config suitable for tests
+func Config() *mcapi.Config {
+	return &mcapi.Config{
+		Region:                "us-east-1",
+		ServerID:              InstanceID,
+		CloudfrontOrigin:      "https://example.cloudfront.net",
+		TimerKeyName:          "minecraftServerStopTime",
+		ServerStatusKeyName:   "minecraftServerStatus",
+		LifecycleKeyName:      "minecraftServerLifecycle",
+		SessionKeyName:        "minecraftServerSession",
+		RestoreKeyName:        "minecraftServerRestore",
+		CloudwatchRuleName:    "StopMinecraftServer",
+		StopServerArn:         "arn:aws:lambda:us-east-1:123456789012:function:stopServer",
+		FunctionName:          "mcapi-test",
+		UserLoginTableName:    "minecraft-logins",
+		APIKey:                "test-api-key",
+		SessionLength:         mcapi.DefaultSessionLength,
+		SessionExtension:      mcapi.DefaultSessionExtension,
+		MaxSession:            mcapi.DefaultMaxSession,
+		GracePeriod:           mcapi.DefaultGracePeriod,
+		MaxGraceExtensions:    mcapi.DefaultMaxGraceExtensions,
+		ShutdownDocument:      "AWS-RunShellScript",
+		ShutdownCommand:       "systemctl stop minecraft",
+		ShutdownTimeout:       mcapi.DefaultShutdownTimeout,
+		BackupRetention:       mcapi.DefaultBackupRetention,
+		ServerPort:            mcapi.DefaultServerPort,
+		PingTimeout:           time.Second,
+		RCONPort:              mcapi.DefaultRCONPort,
+		RCONPasswordParameter: "/minecraft/rcon-password",
+		RCONTimeout:           time.Second,
+		SyncWhitelist:         true,
+		LinkCodeTTL:           mcapi.DefaultLinkCodeTTL,
+		ProfileCacheTTL:       mcapi.DefaultProfileCacheTTL,
+	}
+}
+
+// Clients bundles a fake for every client in mcapi.Clients
+type Clients struct {
+	EC2       *FakeEC2
+	SSM       *FakeSSM
+	Events    *FakeEvents
+	DynamoDB  *FakeDynamoDB
+	Scheduler *FakeScheduler
+	Commands  *FakeCommandRunner
+	Pinger    *FakePinger
+	RCON      *FakeRCON
+	Resolver  *FakeResolver
+	Invoker   *FakeInvoker
+}
+
+// NewClients creates and returns new set of empty fakes. The instance of
+// Config has PrivateIP once its state is set.
+func NewClients() *Clients {
+	c := &Clients{
+		EC2:       NewFakeEC2(),
+		SSM:       NewFakeSSM(),
+		Events:    NewFakeEvents(),
+		DynamoDB:  NewFakeDynamoDB(),
+		Scheduler: NewFakeScheduler(),
+		Commands:  NewFakeCommandRunner(),
+		Pinger:    NewFakePinger(),
+		RCON:      NewFakeRCON(),
+		Resolver:  NewFakeResolver(),
+		Invoker:   NewFakeInvoker(),
+	}
+	c.EC2.SetPrivateAddress(InstanceID, PrivateIP)
+	return c
+}
+
+// Clients returns the fakes as mcapi.Clients to inject into a handler
+func (c *Clients) Clients() *mcapi.Clients {
+	return &mcapi.Clients{
+		EC2:       c.EC2,
+		SSM:       c.SSM,
+		Events:    c.Events,
+		DynamoDB:  c.DynamoDB,
+		Scheduler: c.Scheduler,
+		Commands:  c.Commands,
+		Pinger:    c.Pinger,
+		RCON:      c.RCON,
+		Resolver:  c.Resolver,
+		Invoker:   c.Invoker,
+	}
+}
+
+// recorder tracks the operations called on a fake and the errors to fail them
+// with
+type recorder struct {
+	mu    sync.Mutex
+	errs  map[string]error
+	calls []string
+}
+
+// Fail makes every following call of operation op return err. A nil err clears
+// the failure.
+func (r *recorder) Fail(op string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.errs == nil {
+		r.errs = map[string]error{}
+	}
+	r.errs[op] = err
+}
+
+// Calls returns the names of the operations called so far, in order
+func (r *recorder) Calls() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.calls...)
+}
+
+// Called reports whether operation op has been called
+func (r *recorder) Called(op string) bool {
+	for _, c := range r.Calls() {
+		if c == op {
+			return true
+		}
+	}
+	return false
+}
+
+// call records op and returns the error it should fail with, if any. The
+// caller must hold r.mu.
+func (r *recorder) call(op string) error {
+	r.calls = append(r.calls, op)
+	return r.errs[op]
+}
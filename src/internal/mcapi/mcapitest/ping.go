@@ -0,0 +1,228 @@
+package mcapitest
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"sync"
+
+	"mcapi"
+)
+
+// FakePinger is an mcapi.Pinger answering with a set result. Until one is
+// set every ping fails as if nothing were listening.
+type FakePinger struct {
+	recorder
+	result    *mcapi.PingResult
+	addresses []string
+}
+
+// NewFakePinger creates and returns new FakePinger with nothing listening
+func NewFakePinger() *FakePinger {
+	return &FakePinger{}
+}
+
+// SetResult makes the following pings succeed with result, or fail again if
+// result is nil
+func (f *FakePinger) SetResult(result *mcapi.PingResult) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.result = result
+}
+
+// Ping implements mcapi.Pinger
+func (f *FakePinger) Ping(address string) (mcapi.PingResult, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.addresses = append(f.addresses, address)
+	if err := f.call("Ping"); err != nil {
+		return mcapi.PingResult{}, err
+	}
+	if f.result == nil {
+		return mcapi.PingResult{}, errors.New("dial tcp " + address + ": connect: connection refused")
+	}
+	return *f.result, nil
+}
+
+// Pinged returns the addresses pinged so far, in order
+func (f *FakePinger) Pinged() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.addresses...)
+}
+
+// PingServer is a local TCP server answering the Server List Ping with a
+// fixed status, for testing mcapi.ServerListPinger. Its fields are read by the
+// connections it serves, so they must be set before Start.
+type PingServer struct {
+	// Status is the JSON status response
+	Status string
+	// Silent servers accept connections but never answer
+	Silent bool
+	// NoPong servers answer the status but not the ping
+	NoPong bool
+
+	listener net.Listener
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+	hosts    []string
+}
+
+// NewPingServer creates and returns new PingServer listening on a free local
+// port with status as its JSON status
+func NewPingServer(status string) (*PingServer, error) {
+	s := &PingServer{Status: status}
+	if err := s.Start(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Start listens on a free local port and serves pings until Close
+func (s *PingServer) Start() error {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return err
+	}
+	s.listener = l
+	s.wg.Add(1)
+	go s.serve()
+	return nil
+}
+
+// Addr returns the host:port the server listens on
+func (s *PingServer) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Hosts returns the server addresses sent in the handshakes so far
+func (s *PingServer) Hosts() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.hosts...)
+}
+
+// Close stops the server and waits for open connections to finish
+func (s *PingServer) Close() {
+	s.listener.Close()
+	s.wg.Wait()
+}
+
+func (s *PingServer) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer conn.Close()
+			s.handle(conn)
+		}()
+	}
+}
+
+// handle answers a single ping. Malformed packets end the connection.
+func (s *PingServer) handle(conn net.Conn) {
+	r := bufio.NewReader(conn)
+	if s.Silent {
+		io.Copy(ioutil.Discard, r)
+		return
+	}
+	id, handshake, err := readPacket(r)
+	if err != nil || id != 0x00 {
+		return
+	}
+	// protocol version, then the server address
+	body := bytes.NewReader(handshake)
+	if _, err := readVarInt(body); err != nil {
+		return
+	}
+	n, err := readVarInt(body)
+	if err != nil || int(n) > body.Len() {
+		return
+	}
+	host := make([]byte, n)
+	body.Read(host)
+	s.mu.Lock()
+	s.hosts = append(s.hosts, string(host))
+	s.mu.Unlock()
+
+	if id, _, err := readPacket(r); err != nil || id != 0x00 {
+		return
+	}
+	var status bytes.Buffer
+	writeVarInt(&status, int32(len(s.Status)))
+	status.WriteString(s.Status)
+	writePacket(conn, 0x00, status.Bytes())
+
+	id, payload, err := readPacket(r)
+	if err != nil || id != 0x01 || s.NoPong {
+		return
+	}
+	writePacket(conn, 0x01, payload)
+}
+
+// writeVarInt writes value as a protocol VarInt
+func writeVarInt(w *bytes.Buffer, value int32) {
+	v := uint32(value)
+	for v&^0x7f != 0 {
+		w.WriteByte(byte(v&0x7f | 0x80))
+		v >>= 7
+	}
+	w.WriteByte(byte(v))
+}
+
+// readVarInt reads a protocol VarInt
+func readVarInt(r io.ByteReader) (int32, error) {
+	var v uint32
+	for i := 0; i < 5; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		v |= uint32(b&0x7f) << (7 * i)
+		if b&0x80 == 0 {
+			return int32(v), nil
+		}
+	}
+	return 0, errors.New("VarInt is too long")
+}
+
+// writePacket writes a length-prefixed packet
+func writePacket(w io.Writer, id int32, data []byte) error {
+	var body bytes.Buffer
+	writeVarInt(&body, id)
+	body.Write(data)
+	var packet bytes.Buffer
+	writeVarInt(&packet, int32(body.Len()))
+	packet.Write(body.Bytes())
+	_, err := w.Write(packet.Bytes())
+	return err
+}
+
+// readPacket reads a length-prefixed packet, returning its ID and data
+func readPacket(r *bufio.Reader) (int32, []byte, error) {
+	n, err := readVarInt(r)
+	if err != nil {
+		return 0, nil, err
+	}
+	if n <= 0 {
+		return 0, nil, errors.New("empty packet")
+	}
+	packet := make([]byte, n)
+	if _, err := io.ReadFull(r, packet); err != nil {
+		return 0, nil, err
+	}
+	body := bytes.NewReader(packet)
+	id, err := readVarInt(body)
+	if err != nil {
+		return 0, nil, err
+	}
+	return id, packet[len(packet)-body.Len():], nil
+}
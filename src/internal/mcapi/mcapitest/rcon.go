@@ -0,0 +1,208 @@
+package mcapitest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+)
+
+// FakeRCON is an mcapi.RCON answering commands with set outputs
+type FakeRCON struct {
+	recorder
+	outputs   map[string]string
+	commands  []string
+	addresses []string
+}
+
+// NewFakeRCON creates and returns new FakeRCON answering every command with
+// empty output
+func NewFakeRCON() *FakeRCON {
+	return &FakeRCON{outputs: map[string]string{}}
+}
+
+// SetOutput sets the output of command
+func (f *FakeRCON) SetOutput(command, output string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.outputs[command] = output
+}
+
+// Command implements mcapi.RCON
+func (f *FakeRCON) Command(address, command string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("Command"); err != nil {
+		return "", err
+	}
+	f.addresses = append(f.addresses, address)
+	f.commands = append(f.commands, command)
+	return f.outputs[command], nil
+}
+
+// Commands returns the commands run so far, in order
+func (f *FakeRCON) Commands() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.commands...)
+}
+
+// Addresses returns the addresses commands were run at, in order
+func (f *FakeRCON) Addresses() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.addresses...)
+}
+
+// RCONServer is a local TCP server speaking RCON the way minecraft does, for
+// testing mcapi.RCONClient
+type RCONServer struct {
+	Password string
+	// Output returns the output of a command. Nil answers every command with
+	// empty output.
+	Output func(command string) string
+	// FragmentSize is the most output sent per packet, 4096 by default
+	FragmentSize int
+	// AuthPreamble sends an empty response ahead of the auth response, as
+	// Source engine servers do
+	AuthPreamble bool
+	// Silent servers accept connections but never answer
+	Silent bool
+
+	listener net.Listener
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+	commands []string
+}
+
+// NewRCONServer creates and returns new RCONServer listening on a free local
+// port for the password
+func NewRCONServer(password string) (*RCONServer, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &RCONServer{Password: password, FragmentSize: 4096, listener: l}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// Addr returns the host:port the server listens on
+func (s *RCONServer) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Commands returns the commands run by authenticated clients so far
+func (s *RCONServer) Commands() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.commands...)
+}
+
+// Close stops the server and waits for open connections to finish
+func (s *RCONServer) Close() {
+	s.listener.Close()
+	s.wg.Wait()
+}
+
+func (s *RCONServer) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer conn.Close()
+			s.handle(conn)
+		}()
+	}
+}
+
+// handle answers packets until the client disconnects
+func (s *RCONServer) handle(conn net.Conn) {
+	r := bufio.NewReader(conn)
+	authed := false
+	for {
+		id, typ, body, err := readRCONPacket(r)
+		if err != nil {
+			return
+		}
+		if s.Silent {
+			continue
+		}
+		switch typ {
+		case 3:
+			if s.AuthPreamble {
+				writeRCONPacket(conn, id, 0, "")
+			}
+			authed = body == s.Password
+			if !authed {
+				id = -1
+			}
+			writeRCONPacket(conn, id, 2, "")
+		case 2:
+			if !authed {
+				writeRCONPacket(conn, -1, 2, "")
+				continue
+			}
+			s.mu.Lock()
+			s.commands = append(s.commands, body)
+			s.mu.Unlock()
+			output := ""
+			if s.Output != nil {
+				output = s.Output(body)
+			}
+			// always at least one packet, empty for commands without output
+			for {
+				n := len(output)
+				if n > s.FragmentSize {
+					n = s.FragmentSize
+				}
+				writeRCONPacket(conn, id, 0, output[:n])
+				output = output[n:]
+				if output == "" {
+					break
+				}
+			}
+		default:
+			writeRCONPacket(conn, id, 0, fmt.Sprintf("Unknown request %x", typ))
+		}
+	}
+}
+
+// writeRCONPacket writes an RCON packet
+func writeRCONPacket(w io.Writer, id, typ int32, body string) error {
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, int32(len(body)+10))
+	binary.Write(&b, binary.LittleEndian, id)
+	binary.Write(&b, binary.LittleEndian, typ)
+	b.WriteString(body)
+	b.Write([]byte{0, 0})
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// readRCONPacket reads an RCON packet
+func readRCONPacket(r io.Reader) (id, typ int32, body string, err error) {
+	var length int32
+	if err = binary.Read(r, binary.LittleEndian, &length); err != nil {
+		return 0, 0, "", err
+	}
+	if length < 10 {
+		return 0, 0, "", fmt.Errorf("RCON packet length %d too short", length)
+	}
+	b := make([]byte, length)
+	if _, err = io.ReadFull(r, b); err != nil {
+		return 0, 0, "", err
+	}
+	id = int32(binary.LittleEndian.Uint32(b[0:4]))
+	typ = int32(binary.LittleEndian.Uint32(b[4:8]))
+	return id, typ, string(bytes.TrimRight(b[8:], "\x00")), nil
+}
@@ -0,0 +1,57 @@
+package mcapitest
+
+import (
+	"strings"
+
+	"mcapi"
+)
+
+// FakeResolver is an mcapi.Resolver knowing every player by their offline
+// UUID, unless told otherwise. Like Mojang, it does not mind the case of
+// names.
+type FakeResolver struct {
+	recorder
+	profiles map[string]*mcapi.Profile
+	resolved []string
+}
+
+// NewFakeResolver creates and returns new FakeResolver
+func NewFakeResolver() *FakeResolver {
+	return &FakeResolver{profiles: map[string]*mcapi.Profile{}}
+}
+
+// SetProfile makes username resolve to uuid, or to nobody if uuid is empty
+func (f *FakeResolver) SetProfile(username, uuid string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var profile *mcapi.Profile
+	if uuid != "" {
+		profile = &mcapi.Profile{UUID: uuid, Username: username}
+	}
+	f.profiles[strings.ToLower(username)] = profile
+}
+
+// Resolve implements mcapi.Resolver
+func (f *FakeResolver) Resolve(username string) (mcapi.Profile, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.resolved = append(f.resolved, username)
+	if err := f.call("Resolve"); err != nil {
+		return mcapi.Profile{}, err
+	}
+	profile, ok := f.profiles[strings.ToLower(username)]
+	if !ok {
+		return mcapi.OfflineResolver{}.Resolve(username)
+	}
+	if profile == nil {
+		return mcapi.Profile{}, mcapi.NewError(mcapi.CodeNotFound, "No player is named %s", username)
+	}
+	return *profile, nil
+}
+
+// Resolved returns the names resolved so far, in order
+func (f *FakeResolver) Resolved() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.resolved...)
+}
@@ -0,0 +1,58 @@
+package mcapitest
+
+import (
+	"time"
+)
+
+// FakeScheduler is an in-memory mcapi.Scheduler remembering the stop time it
+// is armed for
+type FakeScheduler struct {
+	recorder
+	at    time.Time
+	armed bool
+}
+
+// NewFakeScheduler creates and returns new FakeScheduler with nothing armed
+func NewFakeScheduler() *FakeScheduler {
+	return &FakeScheduler{}
+}
+
+// Schedule implements mcapi.Scheduler
+func (f *FakeScheduler) Schedule(stopTime time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("Schedule"); err != nil {
+		return err
+	}
+	f.at, f.armed = stopTime, true
+	return nil
+}
+
+// Cancel implements mcapi.Scheduler
+func (f *FakeScheduler) Cancel() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("Cancel"); err != nil {
+		return err
+	}
+	f.at, f.armed = time.Time{}, false
+	return nil
+}
+
+// Scheduled implements mcapi.Scheduler
+func (f *FakeScheduler) Scheduled() (time.Time, bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("Scheduled"); err != nil {
+		return time.Time{}, false, err
+	}
+	return f.at, f.armed, nil
+}
+
+// At returns the time the stop is armed for without recording a call, or
+// false if it is not armed
+func (f *FakeScheduler) At() (time.Time, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.at, f.armed
+}
@@ -0,0 +1,189 @@
+package mcapitest
+
+import (
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
+)
+
+// FakeSSM is an in-memory ssmiface.SSMAPI parameter store, which also records
+// the commands sent with Run Command
+type FakeSSM struct {
+	ssmiface.SSMAPI
+	recorder
+	params   map[string]string
+	versions map[string]int64
+	// history holds every version of each parameter, oldest first
+	history  map[string][]*ssm.ParameterHistory
+	commands []*ssm.SendCommandInput
+	// polls counts the status checks of each command
+	polls         []int
+	commandStatus string
+	commandPolls  int
+}
+
+// NewFakeSSM creates and returns new FakeSSM with no parameters
+func NewFakeSSM() *FakeSSM {
+	return &FakeSSM{params: map[string]string{}, versions: map[string]int64{}, history: map[string][]*ssm.ParameterHistory{}}
+}
+
+// Set stores a parameter value directly
+func (f *FakeSSM) Set(name, value string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.set(name, value)
+}
+
+// set stores value as a new version of the parameter
+func (f *FakeSSM) set(name, value string) {
+	f.params[name] = value
+	f.versions[name]++
+	f.history[name] = append(f.history[name], &ssm.ParameterHistory{
+		Name:    aws.String(name),
+		Value:   aws.String(value),
+		Version: aws.Int64(f.versions[name]),
+	})
+}
+
+// Get returns a parameter value and whether it exists
+func (f *FakeSSM) Get(name string) (string, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	value, ok := f.params[name]
+	return value, ok
+}
+
+func parameterNotFound(name string) error {
+	return awserr.New(ssm.ErrCodeParameterNotFound, "parameter "+name+" not found", nil)
+}
+
+// PutParameter stores the parameter as a new version, failing if it exists and
+// overwrite is not set
+func (f *FakeSSM) PutParameter(input *ssm.PutParameterInput) (*ssm.PutParameterOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("PutParameter"); err != nil {
+		return nil, err
+	}
+	name := aws.StringValue(input.Name)
+	if _, ok := f.params[name]; ok && !aws.BoolValue(input.Overwrite) {
+		return nil, awserr.New(ssm.ErrCodeParameterAlreadyExists, "parameter "+name+" already exists", nil)
+	}
+	f.set(name, aws.StringValue(input.Value))
+	return &ssm.PutParameterOutput{Version: aws.Int64(f.versions[name])}, nil
+}
+
+// GetParameter returns the parameter or ParameterNotFound
+func (f *FakeSSM) GetParameter(input *ssm.GetParameterInput) (*ssm.GetParameterOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("GetParameter"); err != nil {
+		return nil, err
+	}
+	name := aws.StringValue(input.Name)
+	value, ok := f.params[name]
+	if !ok {
+		return nil, parameterNotFound(name)
+	}
+	return &ssm.GetParameterOutput{Parameter: &ssm.Parameter{
+		Name:    aws.String(name),
+		Value:   aws.String(value),
+		Version: aws.Int64(f.versions[name]),
+	}}, nil
+}
+
+// GetParameterHistory returns every version of the parameter, in a single
+// page, or ParameterNotFound
+func (f *FakeSSM) GetParameterHistory(input *ssm.GetParameterHistoryInput) (*ssm.GetParameterHistoryOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("GetParameterHistory"); err != nil {
+		return nil, err
+	}
+	name := aws.StringValue(input.Name)
+	if _, ok := f.params[name]; !ok {
+		return nil, parameterNotFound(name)
+	}
+	return &ssm.GetParameterHistoryOutput{Parameters: f.history[name]}, nil
+}
+
+// DeleteParameter removes the parameter or returns ParameterNotFound
+func (f *FakeSSM) DeleteParameter(input *ssm.DeleteParameterInput) (*ssm.DeleteParameterOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("DeleteParameter"); err != nil {
+		return nil, err
+	}
+	name := aws.StringValue(input.Name)
+	if _, ok := f.params[name]; !ok {
+		return nil, parameterNotFound(name)
+	}
+	delete(f.params, name)
+	delete(f.versions, name)
+	delete(f.history, name)
+	return &ssm.DeleteParameterOutput{}, nil
+}
+
+// SetCommandResult makes every following command report InProgress for polls
+// checks, then finish with status
+func (f *FakeSSM) SetCommandResult(status string, polls int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.commandStatus, f.commandPolls = status, polls
+}
+
+// Commands returns the commands sent so far, in order
+func (f *FakeSSM) Commands() []*ssm.SendCommandInput {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]*ssm.SendCommandInput(nil), f.commands...)
+}
+
+// SendCommand records the command
+func (f *FakeSSM) SendCommand(input *ssm.SendCommandInput) (*ssm.SendCommandOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("SendCommand"); err != nil {
+		return nil, err
+	}
+	f.commands = append(f.commands, input)
+	f.polls = append(f.polls, 0)
+	id := strconv.Itoa(len(f.commands))
+	return &ssm.SendCommandOutput{Command: &ssm.Command{CommandId: aws.String(id), DocumentName: input.DocumentName}}, nil
+}
+
+// GetCommandInvocation returns the status of a sent command, as set by
+// SetCommandResult (Success by default)
+func (f *FakeSSM) GetCommandInvocation(input *ssm.GetCommandInvocationInput) (*ssm.GetCommandInvocationOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("GetCommandInvocation"); err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(aws.StringValue(input.CommandId))
+	if err != nil || n < 1 || n > len(f.commands) {
+		return nil, awserr.New(ssm.ErrCodeInvocationDoesNotExist, "no invocation", nil)
+	}
+	status := f.commandStatus
+	if status == "" {
+		status = ssm.CommandInvocationStatusSuccess
+	}
+	if f.polls[n-1] < f.commandPolls {
+		status = ssm.CommandInvocationStatusInProgress
+	}
+	f.polls[n-1]++
+	return &ssm.GetCommandInvocationOutput{CommandId: input.CommandId, InstanceId: input.InstanceId, Status: aws.String(status)}, nil
+}
+
+// CancelCommand records the cancellation
+func (f *FakeSSM) CancelCommand(input *ssm.CancelCommandInput) (*ssm.CancelCommandOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.call("CancelCommand"); err != nil {
+		return nil, err
+	}
+	return &ssm.CancelCommandOutput{}, nil
+}
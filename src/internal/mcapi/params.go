@@ -0,0 +1,53 @@
+package mcapi
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
+)
+
+const (
+	// StatusDescription describes the server status parameter
+	StatusDescription = "Status of minecraft server. Status reflects specifically the status of the minecraft service ON the server, not the server itself."
+	// LifecycleDescription describes the server lifecycle parameter
+	LifecycleDescription = "Lifecycle state of minecraft server as driven by the API: stopped, starting, started or stopping."
+	// SessionDescription describes the server session parameter
+	SessionDescription = "Start time and extension count of the current minecraft server session, as JSON."
+	// TimerDescription describes the stop timer parameter
+	TimerDescription = "Unix timestamp for auto-shutting down minecraft server"
+)
+
+// PutParameter creates (or overwrites if it already exists) a String
+// parameter store value
+func PutParameter(svc ssmiface.SSMAPI, name, value, description string) error {
+	fmt.Println("[PutParameter]", name+":", value)
+	input := &ssm.PutParameterInput{
+		Description: aws.String(description),
+		Name:        aws.String(name),
+		Overwrite:   aws.Bool(true),
+		Value:       aws.String(value),
+		Type:        aws.String(ssm.ParameterTypeString),
+	}
+	_, err := svc.PutParameter(input)
+	return err
+}
+
+// GetParameter returns the value of a parameter store value
+func GetParameter(svc ssmiface.SSMAPI, name string) (string, error) {
+	input := &ssm.GetParameterInput{Name: aws.String(name)}
+	response, err := svc.GetParameter(input)
+	if err != nil {
+		return "", err
+	}
+	return aws.StringValue(response.Parameter.Value), nil
+}
+
+// DeleteParameter deletes a parameter store value
+func DeleteParameter(svc ssmiface.SSMAPI, name string) error {
+	fmt.Println("[DeleteParameter]", "deleting parameter", name+"...")
+	input := &ssm.DeleteParameterInput{Name: aws.String(name)}
+	_, err := svc.DeleteParameter(input)
+	return err
+}
@@ -0,0 +1,291 @@
+package mcapi
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Pinger asks the minecraft server for its status
+type Pinger interface {
+	// Ping returns the status of the server listening on address, a
+	// host:port pair
+	Ping(address string) (PingResult, error)
+}
+
+// PingResult is the status a minecraft server answers a Server List Ping with
+type PingResult struct {
+	Version  string `json:"version"`
+	Protocol int    `json:"protocol"`
+	// MOTD is the message of the day as plain text, without formatting codes
+	MOTD          string `json:"motd"`
+	PlayersOnline int    `json:"playersOnline"`
+	PlayersMax    int    `json:"playersMax"`
+	// LatencyMs is the round trip time of the ping packet
+	LatencyMs int64 `json:"latencyMs"`
+}
+
+// Packet IDs of the status state. The handshake shares the ID of the status
+// request.
+const (
+	packetHandshake = 0x00
+	packetStatus    = 0x00
+	packetPing      = 0x01
+)
+
+// pingProtocolVersion is sent in the handshake. -1 is what clients send when
+// they only want the status, whatever version the server runs.
+const pingProtocolVersion = -1
+
+// stateStatus is the next state the handshake asks for
+const stateStatus = 1
+
+// maxPacketLength is the largest packet the protocol allows
+const maxPacketLength = 1<<21 - 1
+
+// ServerListPinger pings the minecraft server with the Server List Ping
+// protocol, the one the multiplayer server list uses
+type ServerListPinger struct {
+	Timeout time.Duration
+}
+
+// NewServerListPinger creates and returns new ServerListPinger with the
+// configured timeout
+func NewServerListPinger(cfg *Config) *ServerListPinger {
+	return &ServerListPinger{Timeout: cfg.PingTimeout}
+}
+
+// Ping implements Pinger. The timeout covers the whole exchange.
+func (p *ServerListPinger) Ping(address string) (PingResult, error) {
+	host, portValue, err := net.SplitHostPort(address)
+	if err != nil {
+		return PingResult{}, err
+	}
+	port, err := strconv.ParseUint(portValue, 10, 16)
+	if err != nil {
+		return PingResult{}, fmt.Errorf("invalid port %q: %w", portValue, err)
+	}
+	conn, err := net.DialTimeout("tcp", address, p.Timeout)
+	if err != nil {
+		return PingResult{}, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(p.Timeout))
+
+	var handshake bytes.Buffer
+	writeVarInt(&handshake, pingProtocolVersion)
+	writeString(&handshake, host)
+	binary.Write(&handshake, binary.BigEndian, uint16(port))
+	writeVarInt(&handshake, stateStatus)
+	err = writePacket(conn, packetHandshake, handshake.Bytes())
+	if err != nil {
+		return PingResult{}, err
+	}
+	err = writePacket(conn, packetStatus, nil)
+	if err != nil {
+		return PingResult{}, err
+	}
+
+	r := bufio.NewReader(conn)
+	body, err := readPacket(r, packetStatus)
+	if err != nil {
+		return PingResult{}, fmt.Errorf("reading status: %w", err)
+	}
+	status, err := readString(bytes.NewReader(body))
+	if err != nil {
+		return PingResult{}, fmt.Errorf("reading status: %w", err)
+	}
+	result, err := parseStatus(status)
+	if err != nil {
+		return PingResult{}, err
+	}
+
+	// the server echoes the ping payload straight back
+	payload := make([]byte, 8)
+	binary.BigEndian.PutUint64(payload, uint64(time.Now().UnixNano()))
+	start := time.Now()
+	err = writePacket(conn, packetPing, payload)
+	if err != nil {
+		return PingResult{}, err
+	}
+	pong, err := readPacket(r, packetPing)
+	if err != nil {
+		return PingResult{}, fmt.Errorf("reading pong: %w", err)
+	}
+	if !bytes.Equal(pong, payload) {
+		return PingResult{}, errors.New("pong does not echo the ping")
+	}
+	result.LatencyMs = time.Since(start).Milliseconds()
+	return result, nil
+}
+
+// status is the JSON status response
+type status struct {
+	Version struct {
+		Name     string `json:"name"`
+		Protocol int    `json:"protocol"`
+	} `json:"version"`
+	Players struct {
+		Max    int `json:"max"`
+		Online int `json:"online"`
+	} `json:"players"`
+	Description json.RawMessage `json:"description"`
+}
+
+// parseStatus parses the JSON status response
+func parseStatus(value string) (PingResult, error) {
+	var s status
+	err := json.Unmarshal([]byte(value), &s)
+	if err != nil {
+		return PingResult{}, fmt.Errorf("invalid status: %w", err)
+	}
+	return PingResult{
+		Version:       stripFormatting(s.Version.Name),
+		Protocol:      s.Version.Protocol,
+		MOTD:          stripFormatting(chatText(s.Description)),
+		PlayersOnline: s.Players.Online,
+		PlayersMax:    s.Players.Max,
+	}, nil
+}
+
+// chatText returns the plain text of a chat component: a string, an object
+// with text and extra components, or a list of components
+func chatText(raw json.RawMessage) string {
+	if len(raw) == 0 {
+		return ""
+	}
+	var text string
+	if json.Unmarshal(raw, &text) == nil {
+		return text
+	}
+	var list []json.RawMessage
+	if json.Unmarshal(raw, &list) == nil {
+		var b strings.Builder
+		for _, c := range list {
+			b.WriteString(chatText(c))
+		}
+		return b.String()
+	}
+	var component struct {
+		Text  string            `json:"text"`
+		Extra []json.RawMessage `json:"extra"`
+	}
+	if json.Unmarshal(raw, &component) != nil {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString(component.Text)
+	for _, c := range component.Extra {
+		b.WriteString(chatText(c))
+	}
+	return b.String()
+}
+
+// stripFormatting removes the § formatting codes from text
+func stripFormatting(text string) string {
+	var b strings.Builder
+	skip := false
+	for _, r := range text {
+		switch {
+		case skip:
+			skip = false
+		case r == '§':
+			skip = true
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// writeVarInt writes value as a protocol VarInt: seven bits at a time, least
+// significant first, with the high bit set on all but the last byte
+func writeVarInt(w *bytes.Buffer, value int32) {
+	v := uint32(value)
+	for v&^0x7f != 0 {
+		w.WriteByte(byte(v&0x7f | 0x80))
+		v >>= 7
+	}
+	w.WriteByte(byte(v))
+}
+
+// readVarInt reads a protocol VarInt
+func readVarInt(r io.ByteReader) (int32, error) {
+	var v uint32
+	for i := 0; i < 5; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		v |= uint32(b&0x7f) << (7 * i)
+		if b&0x80 == 0 {
+			return int32(v), nil
+		}
+	}
+	return 0, errors.New("VarInt is too long")
+}
+
+// writeString writes value as a protocol string: its length then UTF-8 bytes
+func writeString(w *bytes.Buffer, value string) {
+	writeVarInt(w, int32(len(value)))
+	w.WriteString(value)
+}
+
+// readString reads a protocol string
+func readString(r *bytes.Reader) (string, error) {
+	n, err := readVarInt(r)
+	if err != nil {
+		return "", err
+	}
+	if n < 0 || int(n) > r.Len() {
+		return "", fmt.Errorf("string length %d out of range", n)
+	}
+	b := make([]byte, n)
+	_, err = io.ReadFull(r, b)
+	return string(b), err
+}
+
+// writePacket writes a packet: its length, then its ID and data
+func writePacket(w io.Writer, id int32, data []byte) error {
+	var body bytes.Buffer
+	writeVarInt(&body, id)
+	body.Write(data)
+	var packet bytes.Buffer
+	writeVarInt(&packet, int32(body.Len()))
+	packet.Write(body.Bytes())
+	_, err := w.Write(packet.Bytes())
+	return err
+}
+
+// readPacket reads a packet with the given ID and returns its data
+func readPacket(r *bufio.Reader, id int32) ([]byte, error) {
+	n, err := readVarInt(r)
+	if err != nil {
+		return nil, err
+	}
+	if n <= 0 || n > maxPacketLength {
+		return nil, fmt.Errorf("packet length %d out of range", n)
+	}
+	packet := make([]byte, n)
+	_, err = io.ReadFull(r, packet)
+	if err != nil {
+		return nil, err
+	}
+	body := bytes.NewReader(packet)
+	got, err := readVarInt(body)
+	if err != nil {
+		return nil, err
+	}
+	if got != id {
+		return nil, fmt.Errorf("got packet 0x%02x, want 0x%02x", got, id)
+	}
+	return packet[len(packet)-body.Len():], nil
+}
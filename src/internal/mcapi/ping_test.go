@@ -0,0 +1,86 @@
+package mcapi_test
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"mcapi"
+	"mcapi/mcapitest"
+)
+
+func TestServerListPinger(t *testing.T) {
+	tests := []struct {
+		name   string
+		status string
+		silent bool
+		noPong bool
+		want   mcapi.PingResult
+		err    string
+	}{
+		{
+			name:   "plain description",
+			status: `{"version": {"name": "1.20.1", "protocol": 763}, "players": {"max": 20, "online": 3}, "description": "A Minecraft Server"}`,
+			want:   mcapi.PingResult{Version: "1.20.1", Protocol: 763, MOTD: "A Minecraft Server", PlayersOnline: 3, PlayersMax: 20},
+		},
+		{
+			name: "chat component description",
+			status: `{"version": {"name": "Paper 1.20.1", "protocol": 763}, "players": {"max": 10, "online": 0, "sample": []},
+				"description": {"text": "§aWelcome", "extra": [{"text": " to "}, [{"text": "the "}, "§lserver"]]}, "favicon": "data:image/png;base64,"}`,
+			want: mcapi.PingResult{Version: "Paper 1.20.1", Protocol: 763, MOTD: "Welcome to the server", PlayersMax: 10},
+		},
+		{name: "invalid status", status: `not json`, err: "invalid status"},
+		{name: "no answer", status: `{}`, silent: true, err: "reading status"},
+		{name: "no pong", status: `{}`, noPong: true, err: "reading pong"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := &mcapitest.PingServer{Status: tt.status, Silent: tt.silent, NoPong: tt.noPong}
+			if err := srv.Start(); err != nil {
+				t.Fatal(err)
+			}
+			defer srv.Close()
+
+			p := &mcapi.ServerListPinger{Timeout: 200 * time.Millisecond}
+			got, err := p.Ping(srv.Addr())
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("Ping error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.LatencyMs < 0 || got.LatencyMs > 200 {
+				t.Errorf("latency = %dms, want within the timeout", got.LatencyMs)
+			}
+			got.LatencyMs = 0
+			if got != tt.want {
+				t.Errorf("Ping = %+v, want %+v", got, tt.want)
+			}
+			host, _, _ := net.SplitHostPort(srv.Addr())
+			if hosts := srv.Hosts(); len(hosts) != 1 || hosts[0] != host {
+				t.Errorf("handshake addresses = %v, want [%s]", hosts, host)
+			}
+		})
+	}
+}
+
+func TestServerListPingerClosedPort(t *testing.T) {
+	srv, err := mcapitest.NewPingServer(`{}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := srv.Addr()
+	srv.Close()
+
+	p := &mcapi.ServerListPinger{Timeout: 200 * time.Millisecond}
+	if _, err := p.Ping(addr); err == nil {
+		t.Error("Ping of a closed port succeeded")
+	}
+	if _, err := p.Ping("localhost"); err == nil {
+		t.Error("Ping without a port succeeded")
+	}
+}
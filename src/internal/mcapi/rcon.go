@@ -0,0 +1,252 @@
+package mcapi
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
+)
+
+// RCON runs commands on the console of the running minecraft server
+type RCON interface {
+	// Command runs command on the server listening for RCON on address, a
+	// host:port pair, and returns its output
+	Command(address, command string) (string, error)
+}
+
+// RCON packet types sent, and of the auth response, which shares the type of
+// commands. Command responses have type 0.
+const (
+	rconCommand      = 2
+	rconAuthResponse = 2
+	rconAuth         = 3
+	// rconMarker is a type the server does not know. Its answer comes after
+	// every fragment of the response before it, marking where that ends.
+	rconMarker = 100
+)
+
+// Limits of the minecraft RCON implementation
+const (
+	// MaxRCONCommand is the longest command the server accepts
+	MaxRCONCommand = 1446
+	// maxRCONPacket bounds the packets read. Responses are split into
+	// fragments of at most 4096 bytes.
+	maxRCONPacket = 4096 + 10
+	// minRCONPacket is the size of a packet with an empty body: the ID, type
+	// and two null bytes
+	minRCONPacket = 10
+)
+
+// rconAuthFailed is the request ID of the answer to a wrong password
+const rconAuthFailed = -1
+
+// rconPacket is a packet of the Source RCON protocol minecraft implements
+type rconPacket struct {
+	ID   int32
+	Type int32
+	Body string
+}
+
+// writeRCONPacket writes p: its little endian length, ID and type, then the
+// null terminated body and an empty null terminated string
+func writeRCONPacket(w io.Writer, p rconPacket) error {
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, int32(len(p.Body)+minRCONPacket))
+	binary.Write(&b, binary.LittleEndian, p.ID)
+	binary.Write(&b, binary.LittleEndian, p.Type)
+	b.WriteString(p.Body)
+	b.Write([]byte{0, 0})
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// readRCONPacket reads a packet
+func readRCONPacket(r io.Reader) (rconPacket, error) {
+	var length int32
+	err := binary.Read(r, binary.LittleEndian, &length)
+	if err != nil {
+		return rconPacket{}, err
+	}
+	if length < minRCONPacket || length > maxRCONPacket {
+		return rconPacket{}, fmt.Errorf("RCON packet length %d out of range", length)
+	}
+	b := make([]byte, length)
+	_, err = io.ReadFull(r, b)
+	if err != nil {
+		return rconPacket{}, err
+	}
+	return rconPacket{
+		ID:   int32(binary.LittleEndian.Uint32(b[0:4])),
+		Type: int32(binary.LittleEndian.Uint32(b[4:8])),
+		Body: string(bytes.TrimRight(b[8:], "\x00")),
+	}, nil
+}
+
+// RCONClient runs commands over the RCON protocol, opening a connection for
+// each command
+type RCONClient struct {
+	// Password is the server's rcon.password. If empty it is read from the
+	// PasswordParameter SecureString when first needed, and read again after
+	// the server refuses it, so a changed password is picked up.
+	Password          string
+	PasswordParameter string
+	SSM               ssmiface.SSMAPI
+	Timeout           time.Duration
+
+	mu sync.Mutex
+}
+
+// NewRCONClient creates and returns new RCONClient reading the password from
+// the configured parameter with svc
+func NewRCONClient(cfg *Config, svc ssmiface.SSMAPI) *RCONClient {
+	return &RCONClient{PasswordParameter: cfg.RCONPasswordParameter, SSM: svc, Timeout: cfg.RCONTimeout}
+}
+
+// password returns the password, reading it from the parameter if unset
+func (c *RCONClient) password() (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.Password != "" || c.PasswordParameter == "" {
+		return c.Password, nil
+	}
+	result, err := c.SSM.GetParameter(&ssm.GetParameterInput{
+		Name:           aws.String(c.PasswordParameter),
+		WithDecryption: aws.Bool(true),
+	})
+	if err != nil {
+		return "", err
+	}
+	c.Password = aws.StringValue(result.Parameter.Value)
+	return c.Password, nil
+}
+
+// forgetPassword drops a password read from the parameter
+func (c *RCONClient) forgetPassword() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.PasswordParameter != "" {
+		c.Password = ""
+	}
+}
+
+// unavailable wraps err as a SERVER_UNAVAILABLE error
+func unavailable(err error) error {
+	return &Error{Code: CodeUnavailable, Message: "RCON", Err: err}
+}
+
+// Command implements RCON. The timeout covers the whole exchange, and the
+// output is returned without formatting codes.
+func (c *RCONClient) Command(address, command string) (string, error) {
+	password, err := c.password()
+	if err != nil {
+		return "", err
+	}
+	if password == "" {
+		return "", NewError(CodeUnavailable, "RCON is not configured")
+	}
+	if len(command) > MaxRCONCommand {
+		return "", NewError(CodeInvalidRequest, "command is longer than %d bytes", MaxRCONCommand)
+	}
+	conn, err := net.DialTimeout("tcp", address, c.Timeout)
+	if err != nil {
+		return "", unavailable(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(c.Timeout))
+	r := bufio.NewReader(conn)
+
+	const authID, commandID, markerID = 1, 2, 3
+	err = writeRCONPacket(conn, rconPacket{ID: authID, Type: rconAuth, Body: password})
+	if err != nil {
+		return "", unavailable(err)
+	}
+	for {
+		p, err := readRCONPacket(r)
+		if err != nil {
+			return "", unavailable(err)
+		}
+		// some servers send an empty response ahead of the auth response
+		if p.Type != rconAuthResponse {
+			continue
+		}
+		if p.ID == rconAuthFailed {
+			c.forgetPassword()
+			return "", NewError(CodeUnavailable, "RCON authentication failed")
+		}
+		if p.ID == authID {
+			break
+		}
+	}
+
+	err = writeRCONPacket(conn, rconPacket{ID: commandID, Type: rconCommand, Body: command})
+	if err != nil {
+		return "", unavailable(err)
+	}
+	// the server reads a packet at a time and answers it in full before
+	// reading the next, so the marker is only sent once the answer has begun
+	var output strings.Builder
+	marked := false
+	for {
+		p, err := readRCONPacket(r)
+		if err != nil {
+			return "", unavailable(err)
+		}
+		switch p.ID {
+		case commandID:
+			output.WriteString(p.Body)
+		case markerID:
+			return stripFormatting(output.String()), nil
+		default:
+			return "", unavailable(fmt.Errorf("unexpected RCON packet %d", p.ID))
+		}
+		if !marked {
+			err = writeRCONPacket(conn, rconPacket{ID: markerID, Type: rconMarker})
+			if err != nil {
+				return "", unavailable(err)
+			}
+			marked = true
+		}
+	}
+}
+
+// RCONAddress returns the host:port to reach the server's RCON at: the
+// instance's private IP on cfg.RCONPort. RCON is plaintext, so it is only
+// reached from inside the instance's VPC, never over the internet. It returns a
+// CONFLICT error if the instance is not running.
+func RCONAddress(cfg *Config, svc ec2iface.EC2API) (string, error) {
+	result, err := svc.DescribeInstances(&ec2.DescribeInstancesInput{
+		InstanceIds: []*string{aws.String(cfg.ServerID)},
+	})
+	if err != nil {
+		return "", err
+	}
+	for _, r := range result.Reservations {
+		for _, i := range r.Instances {
+			state := ""
+			if i.State != nil {
+				state = aws.StringValue(i.State.Name)
+			}
+			if state != ec2.InstanceStateNameRunning {
+				return "", NewError(CodeConflict, "Instance %s is %s, not running", cfg.ServerID, state)
+			}
+			host := aws.StringValue(i.PrivateIpAddress)
+			if host == "" {
+				return "", NewError(CodeConflict, "Instance %s has no private IP", cfg.ServerID)
+			}
+			return net.JoinHostPort(host, strconv.Itoa(cfg.RCONPort)), nil
+		}
+	}
+	return "", NewError(CodeNotFound, "Could not find instance with ID %s", cfg.ServerID)
+}
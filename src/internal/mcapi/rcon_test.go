@@ -0,0 +1,167 @@
+package mcapi_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"mcapi"
+	"mcapi/mcapitest"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+func TestRCONClient(t *testing.T) {
+	long := strings.Repeat("steve, alex, ", 1000)
+	tests := []struct {
+		name     string
+		password string
+		command  string
+		preamble bool
+		silent   bool
+		output   string
+		want     string
+		code     mcapi.ErrorCode
+	}{
+		{name: "runs the command", password: "secret", command: "list", output: "There are 0 of a max of 20 players online: ", want: "There are 0 of a max of 20 players online: "},
+		{name: "empty output", password: "secret", command: "save-all"},
+		{name: "assembles fragments", password: "secret", command: "list", output: long, want: long},
+		{name: "strips formatting", password: "secret", command: "list", output: "§6There are §c1§6 players", want: "There are 1 players"},
+		{name: "auth preamble", password: "secret", command: "list", preamble: true, output: "ok", want: "ok"},
+		{name: "wrong password", password: "wrong", command: "list", code: mcapi.CodeUnavailable},
+		{name: "no password", command: "list", code: mcapi.CodeUnavailable},
+		{name: "command too long", password: "secret", command: strings.Repeat("a", mcapi.MaxRCONCommand+1), code: mcapi.CodeInvalidRequest},
+		{name: "no answer", password: "secret", command: "list", silent: true, code: mcapi.CodeUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, err := mcapitest.NewRCONServer("secret")
+			if err != nil {
+				t.Fatal(err)
+			}
+			srv.AuthPreamble, srv.Silent = tt.preamble, tt.silent
+			srv.Output = func(string) string { return tt.output }
+			defer srv.Close()
+
+			c := &mcapi.RCONClient{Password: tt.password, Timeout: 200 * time.Millisecond}
+			got, err := c.Command(srv.Addr(), tt.command)
+			if tt.code != "" {
+				if err == nil || mcapi.Classify(err).Code != tt.code {
+					t.Fatalf("Command error = %v, want %s", err, tt.code)
+				}
+				if cmds := srv.Commands(); len(cmds) != 0 {
+					t.Errorf("server ran %v, want nothing", cmds)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Command = %.80q (%d bytes), want %.80q (%d bytes)", got, len(got), tt.want, len(tt.want))
+			}
+			if cmds := srv.Commands(); len(cmds) != 1 || cmds[0] != tt.command {
+				t.Errorf("server ran %v, want [%s]", cmds, tt.command)
+			}
+		})
+	}
+}
+
+func TestRCONClientClosedPort(t *testing.T) {
+	srv, err := mcapitest.NewRCONServer("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := srv.Addr()
+	srv.Close()
+	c := &mcapi.RCONClient{Password: "secret", Timeout: 200 * time.Millisecond}
+	if _, err := c.Command(addr, "list"); mcapi.Classify(err).Code != mcapi.CodeUnavailable {
+		t.Errorf("Command on a closed port = %v, want SERVER_UNAVAILABLE", err)
+	}
+}
+
+func TestRCONClientPasswordParameter(t *testing.T) {
+	srv, err := mcapitest.NewRCONServer("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	svc := mcapitest.NewFakeSSM()
+	c := &mcapi.RCONClient{PasswordParameter: "/minecraft/rcon-password", SSM: svc, Timeout: 200 * time.Millisecond}
+
+	if _, err := c.Command(srv.Addr(), "list"); mcapi.Classify(err).Code != mcapi.CodeNotFound {
+		t.Errorf("Command without the parameter = %v, want NOT_FOUND", err)
+	}
+	svc.Set("/minecraft/rcon-password", "secret")
+	for i := 0; i < 2; i++ {
+		if _, err := c.Command(srv.Addr(), "list"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if reads := count(svc.Calls(), "GetParameter"); reads != 2 {
+		t.Errorf("parameter read %d times, want once more after it was set", reads)
+	}
+
+	// a changed password is read again once the server refuses the old one
+	svc.Set("/minecraft/rcon-password", "wrong")
+	c.Password = "stale"
+	if _, err := c.Command(srv.Addr(), "list"); mcapi.Classify(err).Code != mcapi.CodeUnavailable {
+		t.Fatalf("Command with a stale password = %v, want SERVER_UNAVAILABLE", err)
+	}
+	svc.Set("/minecraft/rcon-password", "secret")
+	if _, err := c.Command(srv.Addr(), "list"); err != nil {
+		t.Errorf("Command once the password changed = %v", err)
+	}
+}
+
+func count(calls []string, op string) int {
+	n := 0
+	for _, c := range calls {
+		if c == op {
+			n++
+		}
+	}
+	return n
+}
+
+func TestRCONAddress(t *testing.T) {
+	tests := []struct {
+		name    string
+		address string
+		state   string
+		fail    bool
+		want    string
+		code    mcapi.ErrorCode
+	}{
+		{name: "private IP", state: "running", want: "10.0.0.7:25575"},
+		{name: "not the public address players use", address: "mc.example.com", state: "running", want: "10.0.0.7:25575"},
+		{name: "stopped", state: "stopped", code: mcapi.CodeConflict},
+		{name: "unknown instance", code: mcapi.CodeNotFound},
+		{name: "describe fails", state: "running", fail: true, code: mcapi.CodeForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := mcapitest.Config()
+			cfg.ServerAddress = tt.address
+			svc := mcapitest.NewFakeEC2()
+			if tt.state != "" {
+				svc.SetState(cfg.ServerID, tt.state)
+			}
+			svc.SetAddress(cfg.ServerID, "203.0.113.7", "")
+			svc.SetPrivateAddress(cfg.ServerID, "10.0.0.7")
+			if tt.fail {
+				svc.Fail("DescribeInstances", awserr.New("UnauthorizedOperation", "denied", nil))
+			}
+			got, err := mcapi.RCONAddress(cfg, svc)
+			if tt.code != "" {
+				if err == nil || mcapi.Classify(err).Code != tt.code {
+					t.Fatalf("RCONAddress = %q, %v, want %s", got, err, tt.code)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("RCONAddress = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
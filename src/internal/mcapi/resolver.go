@@ -0,0 +1,184 @@
+package mcapi
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+// Profile is a minecraft player as the server knows them
+type Profile struct {
+	UUID     string `json:"uuid" dynamodbav:"UUID"`
+	Username string `json:"username" dynamodbav:"Username"`
+}
+
+// Resolver looks players up by name
+type Resolver interface {
+	// Resolve returns the profile of the player currently named username. It
+	// returns a NOT_FOUND error if nobody is.
+	Resolve(username string) (Profile, error)
+}
+
+// NewResolver returns the resolver matching the server: offline UUIDs in
+// offline mode, otherwise Mojang lookups cached in the login table
+func NewResolver(cfg *Config, svc dynamodbiface.DynamoDBAPI) Resolver {
+	if cfg.OfflineMode {
+		return OfflineResolver{}
+	}
+	return &CachedResolver{Config: cfg, DynamoDB: svc, Resolver: NewMojangResolver()}
+}
+
+// MojangProfileURL returns the profile of the player named after it
+const MojangProfileURL = "https://api.mojang.com/users/profiles/minecraft/"
+
+// mojangTimeout is how long a lookup through the Mojang API may take
+const mojangTimeout = 5 * time.Second
+
+// MojangResolver looks players up through the Mojang API, which is how online
+// mode servers know them
+type MojangResolver struct {
+	URL    string
+	Client *http.Client
+}
+
+// NewMojangResolver creates and returns new MojangResolver calling the Mojang
+// API
+func NewMojangResolver() *MojangResolver {
+	return &MojangResolver{URL: MojangProfileURL, Client: &http.Client{Timeout: mojangTimeout}}
+}
+
+// Resolve implements Resolver. Mojang throttling lookups is returned as a
+// THROTTLED error, and failing to reach it as SERVER_UNAVAILABLE.
+func (r *MojangResolver) Resolve(username string) (Profile, error) {
+	if !IsPlayerName(username) {
+		return Profile{}, NewError(CodeInvalidRequest, "username must be a minecraft player name, got %q", username)
+	}
+	resp, err := r.Client.Get(r.URL + url.PathEscape(username))
+	if err != nil {
+		return Profile{}, NewError(CodeUnavailable, "could not reach Mojang: %v", err)
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNoContent, http.StatusNotFound:
+		return Profile{}, NewError(CodeNotFound, "No player is named %s", username)
+	case http.StatusTooManyRequests:
+		return Profile{}, NewError(CodeThrottled, "Mojang is throttling lookups")
+	default:
+		return Profile{}, NewError(CodeUnavailable, "Mojang answered %s", resp.Status)
+	}
+
+	var body struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&body)
+	if err != nil {
+		return Profile{}, fmt.Errorf("decoding profile of %s: %w", username, err)
+	}
+	if !playerUUID.MatchString(body.ID) {
+		return Profile{}, fmt.Errorf("profile of %s has invalid id %q", username, body.ID)
+	}
+	uuid, _ := NormalizeUUID(body.ID)
+	return Profile{UUID: uuid, Username: body.Name}, nil
+}
+
+// OfflineUUID returns the UUID an offline mode server gives the player named
+// username: the name based (version 3) UUID of "OfflinePlayer:" and the name.
+// Unlike with Mojang, the name is case sensitive.
+func OfflineUUID(username string) string {
+	sum := md5.Sum([]byte("OfflinePlayer:" + username))
+	sum[6] = sum[6]&0x0f | 0x30
+	sum[8] = sum[8]&0x3f | 0x80
+	u := hex.EncodeToString(sum[:])
+	return u[0:8] + "-" + u[8:12] + "-" + u[12:16] + "-" + u[16:20] + "-" + u[20:]
+}
+
+// OfflineResolver resolves players to their offline mode UUIDs, for servers
+// not checking players with Mojang
+type OfflineResolver struct{}
+
+// Resolve implements Resolver. Every valid name resolves.
+func (OfflineResolver) Resolve(username string) (Profile, error) {
+	if !IsPlayerName(username) {
+		return Profile{}, NewError(CodeInvalidRequest, "username must be a minecraft player name, got %q", username)
+	}
+	return Profile{UUID: OfflineUUID(username), Username: username}, nil
+}
+
+// ProfilePartitionKey is the PK of cached profiles in the login table, with
+// the lower case name as SK. Like StatePartitionKey it cannot collide with a
+// player's sessions.
+const ProfilePartitionKey = "#profile"
+
+// profileSortPrefix prefixes the SK of cached profiles, so a player named like
+// a login version does not show up in getLogins results
+const profileSortPrefix = "name#"
+
+// cachedProfile is a profile in the cache, until it expires
+type cachedProfile struct {
+	Profile
+	// Expires is the unix timestamp the profile goes stale at. It is the
+	// table's TTL attribute, so stale profiles are eventually deleted.
+	Expires int64 `dynamodbav:"Expires"`
+}
+
+// CachedResolver caches the profiles another resolver finds in the login
+// table for cfg.ProfileCacheTTL. Failing to use the cache only costs a lookup,
+// so cache errors are logged.
+type CachedResolver struct {
+	Config   *Config
+	DynamoDB dynamodbiface.DynamoDBAPI
+	Resolver Resolver
+}
+
+// Resolve implements Resolver. Players nobody is named like are not cached, as
+// the name may be taken any time.
+func (r *CachedResolver) Resolve(username string) (Profile, error) {
+	now := time.Now()
+	key := itemKey(ProfilePartitionKey, profileSortPrefix+strings.ToLower(username))
+	result, err := r.DynamoDB.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String(r.Config.UserLoginTableName),
+		Key:       key,
+	})
+	var cached cachedProfile
+	if err == nil && len(result.Item) > 0 {
+		err = dynamodbattribute.UnmarshalMap(result.Item, &cached)
+	}
+	if err != nil {
+		fmt.Println("WARNING: could not read cached profile of", username+":", err)
+	}
+	// expired profiles linger until the TTL gets round to deleting them
+	if cached.UUID != "" && cached.Expires > now.Unix() {
+		return cached.Profile, nil
+	}
+
+	profile, err := r.Resolver.Resolve(username)
+	if err != nil {
+		return profile, err
+	}
+	item, err := dynamodbattribute.MarshalMap(cachedProfile{Profile: profile, Expires: now.Add(r.Config.ProfileCacheTTL).Unix()})
+	if err == nil {
+		for k, v := range key {
+			item[k] = v
+		}
+		_, err = r.DynamoDB.PutItem(&dynamodb.PutItemInput{
+			TableName: aws.String(r.Config.UserLoginTableName),
+			Item:      item,
+		})
+	}
+	if err != nil {
+		fmt.Println("WARNING: could not cache profile of", username+":", err)
+	}
+	return profile, nil
+}
@@ -0,0 +1,164 @@
+package mcapi_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"mcapi"
+	"mcapi/mcapitest"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+func TestOfflineUUID(t *testing.T) {
+	for name, want := range map[string]string{
+		"Notch": "b50ad385-829d-3141-a216-7e7d7539ba7f",
+		"notch": mcapi.OfflineUUID("notch"),
+	} {
+		if got := mcapi.OfflineUUID(name); got != want {
+			t.Errorf("OfflineUUID(%q) = %q, want %q", name, got, want)
+		}
+	}
+	if mcapi.OfflineUUID("Notch") == mcapi.OfflineUUID("notch") {
+		t.Error("offline UUIDs do not depend on the case of names")
+	}
+}
+
+func TestMojangResolver(t *testing.T) {
+	tests := []struct {
+		name     string
+		username string
+		status   int
+		body     string
+		want     mcapi.Profile
+		code     mcapi.ErrorCode // of the error, empty for success
+	}{
+		{
+			name:     "found",
+			username: "steve",
+			status:   200,
+			body:     `{"id": "069a79f444e94726a5befca90e38aaf5", "name": "Steve"}`,
+			want:     mcapi.Profile{UUID: "069a79f4-44e9-4726-a5be-fca90e38aaf5", Username: "Steve"},
+		},
+		{name: "nobody", username: "nobody_here", status: 204, code: mcapi.CodeNotFound},
+		{name: "nobody in newer API", username: "nobody_here", status: 404, body: `{"errorMessage": "Couldn't find any profile with name nobody_here"}`, code: mcapi.CodeNotFound},
+		{name: "throttled", username: "steve", status: 429, code: mcapi.CodeThrottled},
+		{name: "down", username: "steve", status: 503, code: mcapi.CodeUnavailable},
+		{name: "invalid name", username: "../steve", code: mcapi.CodeInvalidRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var paths []string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				paths = append(paths, r.URL.Path)
+				w.WriteHeader(tt.status)
+				fmt.Fprint(w, tt.body)
+			}))
+			defer srv.Close()
+			r := mcapi.NewMojangResolver()
+			r.URL = srv.URL + "/users/profiles/minecraft/"
+
+			got, err := r.Resolve(tt.username)
+			var e *mcapi.Error
+			if tt.code != "" {
+				if !errors.As(err, &e) || e.Code != tt.code {
+					t.Errorf("Resolve = %v, want %s", err, tt.code)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("Resolve = %+v, %v, want %+v", got, err, tt.want)
+			}
+			if strings.Join(paths, ",") != "/users/profiles/minecraft/"+tt.username {
+				t.Errorf("requested %v", paths)
+			}
+		})
+	}
+}
+
+func TestCachedResolver(t *testing.T) {
+	cfg := mcapitest.Config()
+	steve := "069a79f4-44e9-4726-a5be-fca90e38aaf5"
+	tests := []struct {
+		name     string
+		cached   int64 // expiry of a cached profile of steve relative to now, 0 for none
+		cacheErr error
+		username string
+		resolved int
+		stored   bool
+		code     mcapi.ErrorCode
+	}{
+		{name: "looked up and cached", username: "Steve", resolved: 1, stored: true},
+		{name: "cached", cached: 3600, username: "STEVE"},
+		{name: "cache expired", cached: -60, username: "steve", resolved: 1, stored: true},
+		{
+			name:     "cache unreadable",
+			cacheErr: awserr.New(dynamodb.ErrCodeInternalServerError, "oops", nil),
+			username: "steve",
+			resolved: 1,
+			stored:   true,
+		},
+		{name: "nobody is not cached", username: "Notch", resolved: 1, code: mcapi.CodeNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := mcapitest.NewClients()
+			c.Resolver.SetProfile("Steve", steve)
+			c.Resolver.SetProfile("Notch", "")
+			if tt.cached != 0 {
+				c.DynamoDB.Put(cfg.UserLoginTableName, map[string]*dynamodb.AttributeValue{
+					"PK":       {S: aws.String(mcapi.ProfilePartitionKey)},
+					"SK":       {S: aws.String("name#steve")},
+					"UUID":     {S: aws.String(steve)},
+					"Username": {S: aws.String("Steve")},
+					"Expires":  {N: aws.String(fmt.Sprint(time.Now().Unix() + tt.cached))},
+				})
+			}
+			c.DynamoDB.Fail("GetItem", tt.cacheErr)
+			r := &mcapi.CachedResolver{Config: cfg, DynamoDB: c.DynamoDB, Resolver: c.Resolver}
+
+			got, err := r.Resolve(tt.username)
+			if tt.code != "" {
+				var e *mcapi.Error
+				if !errors.As(err, &e) || e.Code != tt.code {
+					t.Errorf("Resolve = %v, want %s", err, tt.code)
+				}
+			} else if err != nil || got != (mcapi.Profile{UUID: steve, Username: "Steve"}) {
+				t.Errorf("Resolve = %+v, %v, want Steve", got, err)
+			}
+			if n := len(c.Resolver.Resolved()); n != tt.resolved {
+				t.Errorf("resolved %v, want %d lookups", c.Resolver.Resolved(), tt.resolved)
+			}
+			items := c.DynamoDB.Items(cfg.UserLoginTableName)
+			var stored bool
+			if len(items) == 1 {
+				expires, _ := strconv.ParseInt(aws.StringValue(items[0]["Expires"].N), 10, 64)
+				stored = expires > time.Now().Unix()
+			}
+			if stored != (tt.stored || tt.cached > 0) {
+				t.Errorf("cache = %v, want a fresh profile %t", items, tt.stored)
+			}
+		})
+	}
+}
+
+func TestNewResolver(t *testing.T) {
+	cfg := mcapitest.Config()
+	cfg.OfflineMode = true
+	got, err := mcapi.NewResolver(cfg, nil).Resolve("Notch")
+	if err != nil || got.UUID != "b50ad385-829d-3141-a216-7e7d7539ba7f" || got.Username != "Notch" {
+		t.Errorf("offline Resolve = %+v, %v", got, err)
+	}
+	cfg.OfflineMode = false
+	if _, ok := mcapi.NewResolver(cfg, nil).(*mcapi.CachedResolver); !ok {
+		t.Error("online resolver is not cached")
+	}
+}
@@ -0,0 +1,158 @@
+package mcapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// Response formats
+const (
+	// FormatLegacy returns bare bodies: plain strings for simple results, raw
+	// JSON for lists and the error message for failures. It is what the
+	// website was built against.
+	FormatLegacy = "legacy"
+	// FormatEnvelope wraps every body in an Envelope
+	FormatEnvelope = "envelope"
+)
+
+// EnvelopeVersion is the version of the Envelope layout
+const EnvelopeVersion = 1
+
+// EnvelopeMediaType is the Accept header value requesting the envelope format
+const EnvelopeMediaType = "application/vnd.mcapi.v1+json"
+
+// Envelope is the JSON body returned in the envelope format. Exactly one of
+// Data and Error is set.
+type Envelope struct {
+	Version   int         `json:"version"`
+	Data      interface{} `json:"data"`
+	Error     *APIError   `json:"error,omitempty"`
+	RequestID string      `json:"requestId,omitempty"`
+}
+
+// APIError is the error object of an Envelope
+type APIError struct {
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
+}
+
+// Legacy is implemented by response data whose legacy body is not simply its
+// JSON encoding
+type Legacy interface {
+	LegacyBody() string
+}
+
+// Headers returns the CORS headers sent with every response
+func Headers(origin string) map[string]string {
+	headers := map[string]string{
+		"Access-Control-Allow-Origin":  origin,
+		"Access-Control-Allow-Methods": "OPTIONS,GET,POST,DELETE",
+		"Access-Control-Allow-Headers": "*",
+	}
+	// browsers refuse credentialed requests against a wildcard origin, so only
+	// advertise credentials when the origin is pinned
+	if origin != "*" {
+		headers["Access-Control-Allow-Credentials"] = "true"
+	}
+	return headers
+}
+
+// NewResponse creates and returns new proxy response with CORS headers set
+func NewResponse(origin string, statusCode int, body string) events.APIGatewayProxyResponse {
+	return events.APIGatewayProxyResponse{
+		Headers:    Headers(origin),
+		Body:       body,
+		StatusCode: statusCode,
+	}
+}
+
+// Responder builds the responses to a single request, in the format the
+// request asked for
+type Responder struct {
+	Origin    string
+	Format    string
+	RequestID string
+}
+
+// NewResponder creates and returns new Responder for the request. The format
+// is taken from the format query parameter, then an Accept header of
+// EnvelopeMediaType, then cfg.ResponseFormat, defaulting to legacy.
+func NewResponder(cfg *Config, request events.APIGatewayProxyRequest) *Responder {
+	format := cfg.ResponseFormat
+	if format == "" {
+		format = FormatLegacy
+	}
+	for k, v := range request.Headers {
+		if strings.EqualFold(k, "Accept") && strings.Contains(v, EnvelopeMediaType) {
+			format = FormatEnvelope
+		}
+	}
+	switch f := request.QueryStringParameters["format"]; f {
+	case FormatLegacy, FormatEnvelope:
+		format = f
+	}
+	return &Responder{
+		Origin:    cfg.CloudfrontOrigin,
+		Format:    format,
+		RequestID: request.RequestContext.RequestID,
+	}
+}
+
+// envelope returns the envelope response with the given status
+func (r *Responder) envelope(statusCode int, e Envelope) events.APIGatewayProxyResponse {
+	e.Version = EnvelopeVersion
+	e.RequestID = r.RequestID
+	b, err := json.Marshal(e)
+	if err != nil {
+		// only data can fail to marshal, so this cannot recurse
+		return r.Error(err)
+	}
+	resp := NewResponse(r.Origin, statusCode, string(b))
+	resp.Headers["Content-Type"] = "application/json"
+	return resp
+}
+
+// OK returns a 200 response with data as the body
+func (r *Responder) OK(data interface{}) events.APIGatewayProxyResponse {
+	return r.success(200, data)
+}
+
+// Accepted returns a 202 response with data as the body, for requests whose
+// work carries on after the response
+func (r *Responder) Accepted(data interface{}) events.APIGatewayProxyResponse {
+	return r.success(202, data)
+}
+
+// success returns a successful response with the given status and data as the
+// body
+func (r *Responder) success(statusCode int, data interface{}) events.APIGatewayProxyResponse {
+	if r.Format == FormatEnvelope {
+		return r.envelope(statusCode, Envelope{Data: data})
+	}
+	switch d := data.(type) {
+	case string:
+		return NewResponse(r.Origin, statusCode, d)
+	case Legacy:
+		return NewResponse(r.Origin, statusCode, d.LegacyBody())
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		return r.Error(err)
+	}
+	return NewResponse(r.Origin, statusCode, string(b))
+}
+
+// Error logs err and returns it with the HTTP status of its classified error
+// code
+func (r *Responder) Error(err error) events.APIGatewayProxyResponse {
+	e := Classify(err)
+	status := e.Code.Status()
+	fmt.Println("[Responder]", "status:", status, "code:", e.Code, "aws code:", AWSErrorCode(err), "error:", err)
+	if r.Format == FormatEnvelope {
+		return r.envelope(status, Envelope{Error: &APIError{Code: e.Code, Message: err.Error()}})
+	}
+	return NewResponse(r.Origin, status, err.Error())
+}
@@ -0,0 +1,130 @@
+package mcapi_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"mcapi"
+	"mcapi/mcapitest"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+func TestNewResponderFormat(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   string
+		headers  map[string]string
+		query    map[string]string
+		expected string
+	}{
+		{name: "default", expected: mcapi.FormatLegacy},
+		{name: "configured", config: mcapi.FormatEnvelope, expected: mcapi.FormatEnvelope},
+		{name: "accept header", headers: map[string]string{"accept": mcapi.EnvelopeMediaType}, expected: mcapi.FormatEnvelope},
+		{name: "query", query: map[string]string{"format": "envelope"}, expected: mcapi.FormatEnvelope},
+		{name: "query opts out", config: mcapi.FormatEnvelope, query: map[string]string{"format": "legacy"}, expected: mcapi.FormatLegacy},
+		{name: "unknown query", query: map[string]string{"format": "xml"}, expected: mcapi.FormatLegacy},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := mcapitest.Config()
+			cfg.ResponseFormat = tt.config
+			r := mcapi.NewResponder(cfg, events.APIGatewayProxyRequest{Headers: tt.headers, QueryStringParameters: tt.query})
+			if r.Format != tt.expected {
+				t.Errorf("format = %q, want %q", r.Format, tt.expected)
+			}
+		})
+	}
+}
+
+type legacyData struct {
+	Status string `json:"status"`
+}
+
+func (d legacyData) LegacyBody() string {
+	return d.Status
+}
+
+func TestResponderLegacy(t *testing.T) {
+	r := &mcapi.Responder{Origin: "*", Format: mcapi.FormatLegacy}
+	tests := []struct {
+		name       string
+		resp       events.APIGatewayProxyResponse
+		statusCode int
+		body       string
+	}{
+		{"string", r.OK("success"), 200, "success"},
+		{"legacy data", r.OK(legacyData{Status: "running"}), 200, "running"},
+		{"list", r.OK([]int{1, 2}), 200, "[1,2]"},
+		{"accepted", r.Accepted(legacyData{Status: "stopping"}), 202, "stopping"},
+		{"error", r.Error(errors.New("boom")), 500, "boom"},
+	}
+	for _, tt := range tests {
+		if tt.resp.StatusCode != tt.statusCode || tt.resp.Body != tt.body {
+			t.Errorf("%s: got %d %q, want %d %q", tt.name, tt.resp.StatusCode, tt.resp.Body, tt.statusCode, tt.body)
+		}
+		if tt.resp.Headers["Access-Control-Allow-Origin"] != "*" {
+			t.Errorf("%s: missing CORS headers: %v", tt.name, tt.resp.Headers)
+		}
+	}
+}
+
+func TestResponderEnvelope(t *testing.T) {
+	r := &mcapi.Responder{Origin: "*", Format: mcapi.FormatEnvelope, RequestID: "req-1"}
+	tests := []struct {
+		name       string
+		resp       events.APIGatewayProxyResponse
+		statusCode int
+		body       string
+	}{
+		{"data", r.OK(legacyData{Status: "running"}), 200, `{"version":1,"data":{"status":"running"},"requestId":"req-1"}`},
+		{"accepted", r.Accepted(legacyData{Status: "stopping"}), 202, `{"version":1,"data":{"status":"stopping"},"requestId":"req-1"}`},
+		{"invalid request", r.Error(mcapi.InvalidRequest(errors.New("bad json"))), 400, `{"version":1,"data":null,"error":{"code":"INVALID_REQUEST","message":"bad json"},"requestId":"req-1"}`},
+		{"aws", r.Error(fmt.Errorf("starting: %w", awserr.New("Throttling", "slow down", nil))), 429, `{"version":1,"data":null,"error":{"code":"THROTTLED","message":"starting: Throttling: slow down"},"requestId":"req-1"}`},
+		{"state", r.Error(fmt.Errorf("timer: %w", mcapi.ErrStateNotFound)), 404, `{"version":1,"data":null,"error":{"code":"NOT_FOUND","message":"timer: state not found"},"requestId":"req-1"}`},
+		{"other", r.Error(errors.New("boom")), 500, `{"version":1,"data":null,"error":{"code":"INTERNAL_ERROR","message":"boom"},"requestId":"req-1"}`},
+	}
+	for _, tt := range tests {
+		if tt.resp.StatusCode != tt.statusCode || tt.resp.Body != tt.body {
+			t.Errorf("%s: got %d %s, want %d %s", tt.name, tt.resp.StatusCode, tt.resp.Body, tt.statusCode, tt.body)
+		}
+		if tt.resp.Headers["Content-Type"] != "application/json" {
+			t.Errorf("%s: Content-Type = %q", tt.name, tt.resp.Headers["Content-Type"])
+		}
+		var e mcapi.Envelope
+		if err := json.Unmarshal([]byte(tt.resp.Body), &e); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+	}
+}
+
+func TestClassifyStatus(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		code       mcapi.ErrorCode
+		statusCode int
+	}{
+		{"invalid request", mcapi.InvalidRequest(errors.New("bad json")), mcapi.CodeInvalidRequest, 400},
+		{"aws validation", awserr.New("ValidationException", "bad", nil), mcapi.CodeInvalidRequest, 400},
+		{"iam denial", awserr.New("UnauthorizedOperation", "denied", nil), mcapi.CodeForbidden, 403},
+		{"missing parameter", awserr.New("ParameterNotFound", "missing", nil), mcapi.CodeNotFound, 404},
+		{"missing instance", awserr.New("InvalidInstanceID.NotFound", "missing", nil), mcapi.CodeNotFound, 404},
+		{"missing state", fmt.Errorf("timer: %w", mcapi.ErrStateNotFound), mcapi.CodeNotFound, 404},
+		{"wrong instance state", awserr.New("IncorrectInstanceState", "stopping", nil), mcapi.CodeConflict, 409},
+		{"throttled", fmt.Errorf("query: %w", awserr.New("ThrottlingException", "slow down", nil)), mcapi.CodeThrottled, 429},
+		{"other aws", awserr.New("InternalError", "oops", nil), mcapi.CodeAWS, 502},
+		{"other", errors.New("boom"), mcapi.CodeInternal, 500},
+		{"explicit", mcapi.NewError(mcapi.CodeNotFound, "no instance"), mcapi.CodeNotFound, 404},
+		{"server unavailable", mcapi.NewError(mcapi.CodeUnavailable, "RCON authentication failed"), mcapi.CodeUnavailable, 503},
+	}
+	for _, tt := range tests {
+		e := mcapi.Classify(tt.err)
+		if e.Code != tt.code || e.Code.Status() != tt.statusCode {
+			t.Errorf("%s: got %s %d, want %s %d", tt.name, e.Code, e.Code.Status(), tt.code, tt.statusCode)
+		}
+	}
+}
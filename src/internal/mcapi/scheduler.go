@@ -0,0 +1,138 @@
+package mcapi
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchevents"
+	"github.com/aws/aws-sdk-go/service/cloudwatchevents/cloudwatcheventsiface"
+)
+
+// Scheduler arms the one-time invocation of stopServer that stops the server
+// once its session runs out
+type Scheduler interface {
+	// Schedule arms the stop for stopTime, replacing any earlier schedule
+	Schedule(stopTime time.Time) error
+	// Cancel disarms the stop. Cancelling when nothing is armed is not an
+	// error.
+	Cancel() error
+	// Scheduled returns the time the stop is armed for, or false if it is not
+	// armed. The time is zero for a stop that is armed but not one-time.
+	Scheduled() (time.Time, bool, error)
+}
+
+// cronLayout is the one-time cron expression for a minute in UTC. Pinning the
+// year makes the rule fire once.
+const cronLayout = "cron(%d %d %d %d ? %d)"
+
+// EventsScheduler schedules the stop as a CloudWatch Events rule with a cron
+// expression pinned to the minute of the stop time, targeting stopServer.
+// Rules fire at minute granularity, so the stop fires up to a minute late.
+//
+// Without a TargetArn it only moves the rule and keeps its targets. That is how
+// stopServer, which cannot be given its own ARN, reschedules a stop that fired
+// early.
+type EventsScheduler struct {
+	Events    cloudwatcheventsiface.CloudWatchEventsAPI
+	RuleName  string
+	TargetArn string
+}
+
+// NewEventsScheduler creates and returns new EventsScheduler for the
+// configured rule and stopServer lambda
+func NewEventsScheduler(cfg *Config, svc cloudwatcheventsiface.CloudWatchEventsAPI) *EventsScheduler {
+	return &EventsScheduler{Events: svc, RuleName: cfg.CloudwatchRuleName, TargetArn: cfg.StopServerArn}
+}
+
+// CronExpression returns the one-time cron expression firing in the minute at
+// or after t
+func CronExpression(t time.Time) string {
+	t = t.UTC()
+	at := t.Truncate(time.Minute)
+	if at.Before(t) {
+		at = at.Add(time.Minute)
+	}
+	return fmt.Sprintf(cronLayout, at.Minute(), at.Hour(), at.Day(), int(at.Month()), at.Year())
+}
+
+// parseCronExpression returns the time a one-time cron expression fires at, or
+// false if it is not one
+func parseCronExpression(expression string) (time.Time, bool) {
+	var minute, hour, day, month, year int
+	_, err := fmt.Sscanf(expression, cronLayout, &minute, &hour, &day, &month, &year)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Date(year, time.Month(month), day, hour, minute, 0, 0, time.UTC), true
+}
+
+// Schedule implements Scheduler
+func (s *EventsScheduler) Schedule(stopTime time.Time) error {
+	expression := CronExpression(stopTime)
+	fmt.Println("[EventsScheduler]", "scheduling stop:", expression)
+
+	// we must first create the schedule, then set the target (2 calls)
+	_, err := s.Events.PutRule(&cloudwatchevents.PutRuleInput{
+		Description:        aws.String("Stops the minecraft server once its session runs out"),
+		Name:               aws.String(s.RuleName),
+		ScheduleExpression: aws.String(expression),
+		State:              aws.String(cloudwatchevents.RuleStateEnabled),
+	})
+	if err != nil || s.TargetArn == "" {
+		return err
+	}
+	_, err = s.Events.PutTargets(&cloudwatchevents.PutTargetsInput{
+		Rule: aws.String(s.RuleName),
+		Targets: []*cloudwatchevents.Target{{
+			Id:  aws.String(StopTargetID),
+			Arn: aws.String(s.TargetArn),
+		}},
+	})
+	return err
+}
+
+// Cancel implements Scheduler. The target is removed first, as a rule with
+// targets cannot be deleted.
+func (s *EventsScheduler) Cancel() error {
+	fmt.Println("[EventsScheduler]", "cancelling stop")
+	_, err := s.Events.RemoveTargets(&cloudwatchevents.RemoveTargetsInput{
+		Ids:  []*string{aws.String(StopTargetID)},
+		Rule: aws.String(s.RuleName),
+	})
+	if AWSErrorCode(err) == cloudwatchevents.ErrCodeResourceNotFoundException {
+		// a missing rule has no target to remove, and nothing to delete
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	_, err = s.Events.DeleteRule(&cloudwatchevents.DeleteRuleInput{Name: aws.String(s.RuleName)})
+	return err
+}
+
+// Scheduled implements Scheduler. The stop is armed if the rule is enabled and
+// targets stopServer.
+func (s *EventsScheduler) Scheduled() (time.Time, bool, error) {
+	rule, err := s.Events.DescribeRule(&cloudwatchevents.DescribeRuleInput{Name: aws.String(s.RuleName)})
+	if AWSErrorCode(err) == cloudwatchevents.ErrCodeResourceNotFoundException {
+		return time.Time{}, false, nil
+	}
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	if aws.StringValue(rule.State) != cloudwatchevents.RuleStateEnabled {
+		return time.Time{}, false, nil
+	}
+	targets, err := s.Events.ListTargetsByRule(&cloudwatchevents.ListTargetsByRuleInput{Rule: aws.String(s.RuleName)})
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	for _, t := range targets.Targets {
+		if aws.StringValue(t.Id) == StopTargetID {
+			at, _ := parseCronExpression(aws.StringValue(rule.ScheduleExpression))
+			return at, true, nil
+		}
+	}
+	return time.Time{}, false, nil
+}
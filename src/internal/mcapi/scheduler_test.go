@@ -0,0 +1,133 @@
+package mcapi_test
+
+import (
+	"testing"
+	"time"
+
+	"mcapi"
+	"mcapi/mcapitest"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchevents"
+)
+
+func TestCronExpression(t *testing.T) {
+	tests := []struct {
+		at   time.Time
+		want string
+	}{
+		{time.Date(2026, 10, 17, 14, 30, 0, 0, time.UTC), "cron(30 14 17 10 ? 2026)"},
+		{time.Date(2026, 10, 17, 14, 30, 1, 0, time.UTC), "cron(31 14 17 10 ? 2026)"},
+		{time.Date(2026, 12, 31, 23, 59, 30, 0, time.UTC), "cron(0 0 1 1 ? 2027)"},
+		{time.Date(2026, 10, 17, 16, 30, 0, 0, time.FixedZone("CEST", 2*3600)), "cron(30 14 17 10 ? 2026)"},
+	}
+	for _, tt := range tests {
+		if got := mcapi.CronExpression(tt.at); got != tt.want {
+			t.Errorf("CronExpression(%v) = %q, want %q", tt.at, got, tt.want)
+		}
+	}
+}
+
+func TestEventsScheduler(t *testing.T) {
+	cfg := mcapitest.Config()
+	events := mcapitest.NewFakeEvents()
+	s := mcapi.NewEventsScheduler(cfg, events)
+
+	if _, ok, err := s.Scheduled(); ok || err != nil {
+		t.Fatalf("Scheduled before scheduling = %t, %v", ok, err)
+	}
+	if err := s.Cancel(); err != nil {
+		t.Fatalf("Cancel with nothing scheduled: %v", err)
+	}
+
+	stopTime := time.Date(2026, 10, 17, 14, 29, 10, 0, time.UTC)
+	if err := s.Schedule(stopTime); err != nil {
+		t.Fatal(err)
+	}
+	rule := events.Rule(cfg.CloudwatchRuleName)
+	if got := aws.StringValue(rule.ScheduleExpression); got != "cron(30 14 17 10 ? 2026)" {
+		t.Errorf("schedule expression = %q", got)
+	}
+	target := events.Targets(cfg.CloudwatchRuleName)[mcapi.StopTargetID]
+	if target == nil || aws.StringValue(target.Arn) != cfg.StopServerArn {
+		t.Errorf("stop target = %v, want arn %s", target, cfg.StopServerArn)
+	}
+	at, ok, err := s.Scheduled()
+	if !ok || err != nil || !at.Equal(stopTime.Add(50*time.Second)) {
+		t.Errorf("Scheduled = %v, %t, %v, want %v", at, ok, err, stopTime.Add(50*time.Second))
+	}
+
+	// rescheduling replaces the expression
+	if err := s.Schedule(stopTime.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if got := aws.StringValue(events.Rule(cfg.CloudwatchRuleName).ScheduleExpression); got != "cron(30 15 17 10 ? 2026)" {
+		t.Errorf("rescheduled expression = %q", got)
+	}
+
+	if err := s.Cancel(); err != nil {
+		t.Fatal(err)
+	}
+	if events.Rule(cfg.CloudwatchRuleName) != nil {
+		t.Error("rule not deleted")
+	}
+	if _, ok, _ := s.Scheduled(); ok {
+		t.Error("still armed after Cancel")
+	}
+}
+
+func TestEventsSchedulerWithoutTarget(t *testing.T) {
+	cfg := mcapitest.Config()
+	events := mcapitest.NewFakeEvents()
+	stopTime := time.Date(2026, 10, 17, 14, 30, 0, 0, time.UTC)
+	if err := mcapi.NewEventsScheduler(cfg, events).Schedule(stopTime); err != nil {
+		t.Fatal(err)
+	}
+
+	// moving the rule keeps the target put on by the first scheduler
+	cfg.StopServerArn = ""
+	s := mcapi.NewEventsScheduler(cfg, events)
+	if err := s.Schedule(stopTime.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	puts := 0
+	for _, op := range events.Calls() {
+		if op == "PutTargets" {
+			puts++
+		}
+	}
+	if puts != 1 {
+		t.Errorf("calls = %v, want a single PutTargets from the first scheduler", events.Calls())
+	}
+	at, ok, err := s.Scheduled()
+	if !ok || err != nil || !at.Equal(stopTime.Add(time.Hour)) {
+		t.Errorf("Scheduled = %v, %t, %v, want %v", at, ok, err, stopTime.Add(time.Hour))
+	}
+}
+
+func TestEventsSchedulerPollingRule(t *testing.T) {
+	// the rate rule armed by earlier versions still counts as armed
+	cfg := mcapitest.Config()
+	events := mcapitest.NewFakeEvents()
+	events.PutRule(&cloudwatchevents.PutRuleInput{
+		Name:               aws.String(cfg.CloudwatchRuleName),
+		ScheduleExpression: aws.String("rate(1 minute)"),
+		State:              aws.String(cloudwatchevents.RuleStateEnabled),
+	})
+	events.PutTargets(&cloudwatchevents.PutTargetsInput{
+		Rule:    aws.String(cfg.CloudwatchRuleName),
+		Targets: []*cloudwatchevents.Target{{Id: aws.String(mcapi.StopTargetID), Arn: aws.String(cfg.StopServerArn)}},
+	})
+	s := mcapi.NewEventsScheduler(cfg, events)
+	at, ok, err := s.Scheduled()
+	if !ok || err != nil || !at.IsZero() {
+		t.Errorf("Scheduled = %v, %t, %v, want armed with no time", at, ok, err)
+	}
+	events.PutRule(&cloudwatchevents.PutRuleInput{
+		Name:  aws.String(cfg.CloudwatchRuleName),
+		State: aws.String(cloudwatchevents.RuleStateDisabled),
+	})
+	if _, ok, _ := s.Scheduled(); ok {
+		t.Error("disabled rule reported as armed")
+	}
+}
@@ -0,0 +1,70 @@
+package mcapi
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrStateNotFound is returned by a StateStore for keys that have no value
+var ErrStateNotFound = errors.New("state not found")
+
+// ErrStateConflict is returned by StateStore.Swap when the value changed
+// before it could be swapped
+var ErrStateConflict = errors.New("state changed meanwhile")
+
+// StateStore holds the server's runtime state, such as the service status and
+// the stop timer, as string values keyed by the configured key names
+type StateStore interface {
+	// Get returns the value of key, or an error wrapping ErrStateNotFound if
+	// it is not set
+	Get(key string) (string, error)
+	// Put creates or overwrites the value of key
+	Put(key, value string) error
+	// Swap sets key to value only if it still holds old, or is still unset
+	// if old is empty, returning an error wrapping ErrStateConflict if not
+	Swap(key, old, value string) error
+	// Delete removes key, returning an error wrapping ErrStateNotFound if it
+	// is not set
+	Delete(key string) error
+}
+
+// notFound returns an error wrapping ErrStateNotFound for key
+func notFound(key string) error {
+	return fmt.Errorf("%s: %w", key, ErrStateNotFound)
+}
+
+// conflict returns an error wrapping ErrStateConflict for key
+func conflict(key string) error {
+	return fmt.Errorf("%s: %w", key, ErrStateConflict)
+}
+
+// NewStateStore creates and returns the StateStore selected by
+// cfg.StateBackend, defaulting to parameter store
+func NewStateStore(cfg *Config, clients *Clients) (StateStore, error) {
+	fmt.Println("[NewStateStore]", "backend:", cfg.StateBackend)
+	switch cfg.StateBackend {
+	case "", "ssm":
+		return NewSSMStateStore(cfg, clients.SSM), nil
+	case "dynamodb":
+		return NewDynamoDBStateStore(clients.DynamoDB, cfg.UserLoginTableName), nil
+	case "memory":
+		return NewMemoryStateStore(), nil
+	case "file":
+		if cfg.StateFile == "" {
+			return nil, errors.New("file state backend needs StateFile to be set")
+		}
+		return NewFileStateStore(cfg.StateFile), nil
+	default:
+		return nil, fmt.Errorf("unknown state backend %q", cfg.StateBackend)
+	}
+}
+
+// MustStateStore is like NewStateStore but panics on misconfiguration. It is
+// meant for lambda main functions, where a bad config cannot be recovered from.
+func MustStateStore(cfg *Config, clients *Clients) StateStore {
+	store, err := NewStateStore(cfg, clients)
+	if err != nil {
+		panic(err)
+	}
+	return store
+}
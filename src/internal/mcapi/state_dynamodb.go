@@ -0,0 +1,103 @@
+package mcapi
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+// StatePartitionKey is the PK of state items in the login table. Minecraft
+// usernames cannot contain '#', so it never collides with a user's sessions.
+const StatePartitionKey = "#state"
+
+// DynamoDBStateStore keeps state as items in the login table, one item per key
+// under StatePartitionKey with the key name as SK. State items have no
+// LoginTime, so they stay out of the Username index, and their SK never
+// matches a login version, so they stay out of getLogins results.
+type DynamoDBStateStore struct {
+	DynamoDB  dynamodbiface.DynamoDBAPI
+	TableName string
+}
+
+// NewDynamoDBStateStore creates and returns new DynamoDBStateStore
+func NewDynamoDBStateStore(svc dynamodbiface.DynamoDBAPI, tableName string) *DynamoDBStateStore {
+	return &DynamoDBStateStore{DynamoDB: svc, TableName: tableName}
+}
+
+// itemKey returns the primary key of the item holding key
+func (s *DynamoDBStateStore) itemKey(key string) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		"PK": {S: aws.String(StatePartitionKey)},
+		"SK": {S: aws.String(key)},
+	}
+}
+
+// Get implements StateStore
+func (s *DynamoDBStateStore) Get(key string) (string, error) {
+	result, err := s.DynamoDB.GetItem(&dynamodb.GetItemInput{
+		TableName:      aws.String(s.TableName),
+		Key:            s.itemKey(key),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return "", err
+	}
+	value, ok := result.Item["Value"]
+	if !ok {
+		return "", notFound(key)
+	}
+	return aws.StringValue(value.S), nil
+}
+
+// Put implements StateStore
+func (s *DynamoDBStateStore) Put(key, value string) error {
+	fmt.Println("[DynamoDBStateStore]", key+":", value)
+	item := s.itemKey(key)
+	item["Value"] = &dynamodb.AttributeValue{S: aws.String(value)}
+	_, err := s.DynamoDB.PutItem(&dynamodb.PutItemInput{
+		TableName: aws.String(s.TableName),
+		Item:      item,
+	})
+	return err
+}
+
+// Swap implements StateStore
+func (s *DynamoDBStateStore) Swap(key, old, value string) error {
+	fmt.Println("[DynamoDBStateStore]", key+":", old, "->", value)
+	item := s.itemKey(key)
+	item["Value"] = &dynamodb.AttributeValue{S: aws.String(value)}
+	input := &dynamodb.PutItemInput{
+		TableName:                aws.String(s.TableName),
+		Item:                     item,
+		ConditionExpression:      aws.String("attribute_not_exists(#value)"),
+		ExpressionAttributeNames: map[string]*string{"#value": aws.String("Value")},
+	}
+	if old != "" {
+		input.ConditionExpression = aws.String("#value = :old")
+		input.ExpressionAttributeValues = map[string]*dynamodb.AttributeValue{":old": {S: aws.String(old)}}
+	}
+	_, err := s.DynamoDB.PutItem(input)
+	if AWSErrorCode(err) == dynamodb.ErrCodeConditionalCheckFailedException {
+		return conflict(key)
+	}
+	return err
+}
+
+// Delete implements StateStore
+func (s *DynamoDBStateStore) Delete(key string) error {
+	fmt.Println("[DynamoDBStateStore]", "deleting", key+"...")
+	result, err := s.DynamoDB.DeleteItem(&dynamodb.DeleteItemInput{
+		TableName:    aws.String(s.TableName),
+		Key:          s.itemKey(key),
+		ReturnValues: aws.String(dynamodb.ReturnValueAllOld),
+	})
+	if err != nil {
+		return err
+	}
+	if len(result.Attributes) == 0 {
+		return notFound(key)
+	}
+	return nil
+}
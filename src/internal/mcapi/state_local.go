@@ -0,0 +1,171 @@
+package mcapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// MemoryStateStore keeps state in memory. It is meant for tests and local
+// development, as a lambda's memory does not outlive its container.
+type MemoryStateStore struct {
+	mu     sync.Mutex
+	values map[string]string
+}
+
+// NewMemoryStateStore creates and returns new empty MemoryStateStore
+func NewMemoryStateStore() *MemoryStateStore {
+	return &MemoryStateStore{values: map[string]string{}}
+}
+
+// Get implements StateStore
+func (s *MemoryStateStore) Get(key string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	value, ok := s.values[key]
+	if !ok {
+		return "", notFound(key)
+	}
+	return value, nil
+}
+
+// Put implements StateStore
+func (s *MemoryStateStore) Put(key, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values[key] = value
+	return nil
+}
+
+// Swap implements StateStore
+func (s *MemoryStateStore) Swap(key, old, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.values[key] != old {
+		return conflict(key)
+	}
+	s.values[key] = value
+	return nil
+}
+
+// Delete implements StateStore
+func (s *MemoryStateStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.values[key]; !ok {
+		return notFound(key)
+	}
+	delete(s.values, key)
+	return nil
+}
+
+// FileStateStore keeps state as a JSON object in a local file, so local
+// development state survives restarts. A missing file is treated as empty.
+type FileStateStore struct {
+	mu   sync.Mutex
+	Path string
+}
+
+// NewFileStateStore creates and returns new FileStateStore backed by path
+func NewFileStateStore(path string) *FileStateStore {
+	return &FileStateStore{Path: path}
+}
+
+// load reads every value from the file. The caller must hold s.mu.
+func (s *FileStateStore) load() (map[string]string, error) {
+	values := map[string]string{}
+	b, err := ioutil.ReadFile(s.Path)
+	if os.IsNotExist(err) {
+		return values, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &values); err != nil {
+		return nil, fmt.Errorf("reading state file %s: %w", s.Path, err)
+	}
+	return values, nil
+}
+
+// save replaces the file with values, writing to a temporary file first so a
+// crash never leaves it half written. The caller must hold s.mu.
+func (s *FileStateStore) save(values map[string]string) error {
+	b, err := json.MarshalIndent(values, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(s.Path), filepath.Base(s.Path)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), s.Path)
+}
+
+// Get implements StateStore
+func (s *FileStateStore) Get(key string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	values, err := s.load()
+	if err != nil {
+		return "", err
+	}
+	value, ok := values[key]
+	if !ok {
+		return "", notFound(key)
+	}
+	return value, nil
+}
+
+// Put implements StateStore
+func (s *FileStateStore) Put(key, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	values, err := s.load()
+	if err != nil {
+		return err
+	}
+	values[key] = value
+	return s.save(values)
+}
+
+// Swap implements StateStore
+func (s *FileStateStore) Swap(key, old, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	values, err := s.load()
+	if err != nil {
+		return err
+	}
+	if values[key] != old {
+		return conflict(key)
+	}
+	values[key] = value
+	return s.save(values)
+}
+
+// Delete implements StateStore
+func (s *FileStateStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	values, err := s.load()
+	if err != nil {
+		return err
+	}
+	if _, ok := values[key]; !ok {
+		return notFound(key)
+	}
+	delete(values, key)
+	return s.save(values)
+}
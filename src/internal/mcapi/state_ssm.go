@@ -0,0 +1,136 @@
+package mcapi
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
+)
+
+// SSMStateStore keeps state as String parameters in parameter store, one
+// parameter per key
+type SSMStateStore struct {
+	SSM ssmiface.SSMAPI
+	// Descriptions holds the parameter description written for each key
+	Descriptions map[string]string
+}
+
+// NewSSMStateStore creates and returns new SSMStateStore describing the
+// configured status, lifecycle, session and timer parameters
+func NewSSMStateStore(cfg *Config, svc ssmiface.SSMAPI) *SSMStateStore {
+	return &SSMStateStore{
+		SSM: svc,
+		Descriptions: map[string]string{
+			cfg.ServerStatusKeyName: StatusDescription,
+			cfg.LifecycleKeyName:    LifecycleDescription,
+			cfg.SessionKeyName:      SessionDescription,
+			cfg.TimerKeyName:        TimerDescription,
+		},
+	}
+}
+
+// isParameterNotFound reports whether err is parameter store's not found error
+func isParameterNotFound(err error) bool {
+	return AWSErrorCode(err) == ssm.ErrCodeParameterNotFound
+}
+
+// Get implements StateStore
+func (s *SSMStateStore) Get(key string) (string, error) {
+	value, err := GetParameter(s.SSM, key)
+	if isParameterNotFound(err) {
+		return "", notFound(key)
+	}
+	return value, err
+}
+
+// Put implements StateStore
+func (s *SSMStateStore) Put(key, value string) error {
+	return PutParameter(s.SSM, key, value, s.Descriptions[key])
+}
+
+// Swap implements StateStore. Parameter store has no conditional put, so an
+// unset key is created without overwriting, and a set key is overwritten and
+// checked to have gone up exactly one version from the one compared with. A
+// write that lands in between is only seen afterwards, so the swap that lost
+// puts the value that won back over its own before reporting the conflict.
+func (s *SSMStateStore) Swap(key, old, value string) error {
+	fmt.Println("[SSMStateStore]", key+":", old, "->", value)
+	input := &ssm.PutParameterInput{
+		Description: aws.String(s.Descriptions[key]),
+		Name:        aws.String(key),
+		Value:       aws.String(value),
+		Type:        aws.String(ssm.ParameterTypeString),
+	}
+	if old == "" {
+		_, err := s.SSM.PutParameter(input)
+		if AWSErrorCode(err) == ssm.ErrCodeParameterAlreadyExists {
+			return conflict(key)
+		}
+		return err
+	}
+
+	current, err := s.SSM.GetParameter(&ssm.GetParameterInput{Name: aws.String(key)})
+	if isParameterNotFound(err) {
+		return conflict(key)
+	}
+	if err != nil {
+		return err
+	}
+	if aws.StringValue(current.Parameter.Value) != old {
+		return conflict(key)
+	}
+	input.Overwrite = aws.Bool(true)
+	result, err := s.SSM.PutParameter(input)
+	if err != nil {
+		return err
+	}
+	won := aws.Int64Value(current.Parameter.Version) + 1
+	if aws.Int64Value(result.Version) != won {
+		err = s.rollBack(key, won)
+		if err != nil {
+			return err
+		}
+		return conflict(key)
+	}
+	return nil
+}
+
+// rollBack puts the value key held at version back, over the write of a swap
+// that lost the race to it
+func (s *SSMStateStore) rollBack(key string, version int64) error {
+	input := &ssm.GetParameterHistoryInput{Name: aws.String(key)}
+	for {
+		result, err := s.SSM.GetParameterHistory(input)
+		if err != nil {
+			return err
+		}
+		for _, p := range result.Parameters {
+			if aws.Int64Value(p.Version) != version {
+				continue
+			}
+			fmt.Println("[SSMStateStore]", key, "lost the swap, putting back", aws.StringValue(p.Value))
+			_, err = s.SSM.PutParameter(&ssm.PutParameterInput{
+				Description: aws.String(s.Descriptions[key]),
+				Name:        aws.String(key),
+				Value:       p.Value,
+				Type:        aws.String(ssm.ParameterTypeString),
+				Overwrite:   aws.Bool(true),
+			})
+			return err
+		}
+		if result.NextToken == nil {
+			return fmt.Errorf("version %d of %s not found to roll back to", version, key)
+		}
+		input.NextToken = result.NextToken
+	}
+}
+
+// Delete implements StateStore
+func (s *SSMStateStore) Delete(key string) error {
+	err := DeleteParameter(s.SSM, key)
+	if isParameterNotFound(err) {
+		return notFound(key)
+	}
+	return err
+}
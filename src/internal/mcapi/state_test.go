@@ -0,0 +1,164 @@
+package mcapi_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"mcapi"
+	"mcapi/mcapitest"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ssm"
+)
+
+// tempDir creates a directory for a test, which the caller removes
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "mcapi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestStateStores(t *testing.T) {
+	cfg := mcapitest.Config()
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	stores := map[string]func(t *testing.T) mcapi.StateStore{
+		"ssm": func(t *testing.T) mcapi.StateStore {
+			return mcapi.NewSSMStateStore(cfg, mcapitest.NewFakeSSM())
+		},
+		"dynamodb": func(t *testing.T) mcapi.StateStore {
+			return mcapi.NewDynamoDBStateStore(mcapitest.NewFakeDynamoDB(), cfg.UserLoginTableName)
+		},
+		"memory": func(t *testing.T) mcapi.StateStore {
+			return mcapi.NewMemoryStateStore()
+		},
+		"file": func(t *testing.T) mcapi.StateStore {
+			return mcapi.NewFileStateStore(filepath.Join(dir, "state.json"))
+		},
+	}
+
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			s := newStore(t)
+			key := cfg.TimerKeyName
+
+			if _, err := s.Get(key); !errors.Is(err, mcapi.ErrStateNotFound) {
+				t.Errorf("Get of unset key: err = %v, want ErrStateNotFound", err)
+			}
+			if err := s.Delete(key); !errors.Is(err, mcapi.ErrStateNotFound) {
+				t.Errorf("Delete of unset key: err = %v, want ErrStateNotFound", err)
+			}
+			for _, value := range []string{"100", "200"} {
+				if err := s.Put(key, value); err != nil {
+					t.Fatalf("Put(%q): %v", value, err)
+				}
+				if got, err := s.Get(key); err != nil || got != value {
+					t.Errorf("Get = %q, %v, want %q", got, err, value)
+				}
+			}
+			if err := s.Put(cfg.ServerStatusKeyName, "started"); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Delete(key); err != nil {
+				t.Fatalf("Delete: %v", err)
+			}
+			if _, err := s.Get(key); !errors.Is(err, mcapi.ErrStateNotFound) {
+				t.Errorf("Get after Delete: err = %v, want ErrStateNotFound", err)
+			}
+			if got, err := s.Get(cfg.ServerStatusKeyName); err != nil || got != "started" {
+				t.Errorf("other key = %q, %v, want started", got, err)
+			}
+
+			swap := cfg.LifecycleKeyName
+			if err := s.Swap(swap, "stopped", "starting"); !errors.Is(err, mcapi.ErrStateConflict) {
+				t.Errorf("Swap of unset key from a value: err = %v, want ErrStateConflict", err)
+			}
+			if err := s.Swap(swap, "", "starting"); err != nil {
+				t.Fatalf("Swap of unset key: %v", err)
+			}
+			if err := s.Swap(swap, "", "starting"); !errors.Is(err, mcapi.ErrStateConflict) {
+				t.Errorf("Swap of set key as unset: err = %v, want ErrStateConflict", err)
+			}
+			if err := s.Swap(swap, "stopped", "stopping"); !errors.Is(err, mcapi.ErrStateConflict) {
+				t.Errorf("Swap from wrong value: err = %v, want ErrStateConflict", err)
+			}
+			if err := s.Swap(swap, "starting", "started"); err != nil {
+				t.Fatalf("Swap: %v", err)
+			}
+			if got, err := s.Get(swap); err != nil || got != "started" {
+				t.Errorf("Get after Swap = %q, %v, want started", got, err)
+			}
+		})
+	}
+}
+
+// racingSSM lands another request's write just before the first overwrite
+type racingSSM struct {
+	*mcapitest.FakeSSM
+	value string
+}
+
+func (r *racingSSM) PutParameter(input *ssm.PutParameterInput) (*ssm.PutParameterOutput, error) {
+	if aws.BoolValue(input.Overwrite) && r.value != "" {
+		r.FakeSSM.Set(aws.StringValue(input.Name), r.value)
+		r.value = ""
+	}
+	return r.FakeSSM.PutParameter(input)
+}
+
+func TestSSMStateStoreSwapLost(t *testing.T) {
+	cfg := mcapitest.Config()
+	fake := mcapitest.NewFakeSSM()
+	fake.Set(cfg.LifecycleKeyName, "stopped")
+	s := mcapi.NewSSMStateStore(cfg, &racingSSM{FakeSSM: fake, value: "restoring"})
+
+	if err := s.Swap(cfg.LifecycleKeyName, "stopped", "starting"); !errors.Is(err, mcapi.ErrStateConflict) {
+		t.Errorf("Swap raced by another write: err = %v, want ErrStateConflict", err)
+	}
+	if got, _ := fake.Get(cfg.LifecycleKeyName); got != "restoring" {
+		t.Errorf("value after losing the race = %q, want the winner's restoring", got)
+	}
+}
+
+func TestFileStateStorePersists(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "state.json")
+	if err := mcapi.NewFileStateStore(path).Put("key", "value"); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := mcapi.NewFileStateStore(path).Get("key"); err != nil || got != "value" {
+		t.Errorf("Get from new store = %q, %v, want value", got, err)
+	}
+}
+
+func TestNewStateStore(t *testing.T) {
+	clients := mcapitest.NewClients().Clients()
+	tests := []struct {
+		backend string
+		file    string
+		ok      bool
+	}{
+		{"", "", true},
+		{"ssm", "", true},
+		{"dynamodb", "", true},
+		{"memory", "", true},
+		{"file", "state.json", true},
+		{"file", "", false},
+		{"redis", "", false},
+	}
+	for _, tt := range tests {
+		cfg := mcapitest.Config()
+		cfg.StateBackend = tt.backend
+		cfg.StateFile = tt.file
+		_, err := mcapi.NewStateStore(cfg, clients)
+		if (err == nil) != tt.ok {
+			t.Errorf("NewStateStore(%q, %q): err = %v, want ok %t", tt.backend, tt.file, err, tt.ok)
+		}
+	}
+}
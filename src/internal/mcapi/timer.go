@@ -0,0 +1,102 @@
+package mcapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// GetStopTime returns the stop time kept in the store as a unix timestamp
+func GetStopTime(cfg *Config, store StateStore) (time.Time, error) {
+	value, err := store.Get(cfg.TimerKeyName)
+	if err != nil {
+		return time.Time{}, err
+	}
+	stopTime, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid stop time %q: %w", value, err)
+	}
+	return time.Unix(stopTime, 0), nil
+}
+
+// PutStopTime stores stopTime as a unix timestamp
+func PutStopTime(cfg *Config, store StateStore, stopTime time.Time) error {
+	fmt.Println("[PutStopTime]", "stopTime:", stopTime.Unix())
+	return store.Put(cfg.TimerKeyName, strconv.FormatInt(stopTime.Unix(), 10))
+}
+
+// ClampStopTime caps stopTime at cfg.MaxSession from now, reporting whether it
+// had to
+func ClampStopTime(cfg *Config, now, stopTime time.Time) (time.Time, bool) {
+	max := now.Add(cfg.MaxSession)
+	if stopTime.After(max) {
+		return max, true
+	}
+	return stopTime, false
+}
+
+// CheckTime returns when the scheduled stop should fire for stopTime: the stop
+// time itself, or sooner if an idle check or shutdown warning is due first. An
+// early check schedules the next one.
+func CheckTime(cfg *Config, now, stopTime time.Time) time.Time {
+	next := stopTime
+	if cfg.IdleTimeout > 0 {
+		if idle := now.Add(cfg.IdleTimeout); idle.Before(next) {
+			next = idle
+		}
+	}
+	if warning, ok := NextWarning(cfg, now, stopTime); ok && warning.Before(next) {
+		next = warning
+	}
+	return next
+}
+
+// Session describes the running server session, next to its stop time. Once
+// the server is stopped it describes the last session, until the next start
+// replaces it.
+type Session struct {
+	// StartTime is the unix timestamp the server was started at
+	StartTime int64 `json:"startTime"`
+	// Extensions counts the times the session was extended
+	Extensions int `json:"extensions"`
+	// GraceExtensions counts the times the scheduled stop was put off because
+	// players were online
+	GraceExtensions int `json:"graceExtensions,omitempty"`
+	// StopTime is the unix timestamp the server was stopped at, set once the
+	// session is over
+	StopTime int64 `json:"stopTime,omitempty"`
+	// StopReason is what stopped the server: scheduled or manual
+	StopReason string `json:"stopReason,omitempty"`
+	// Warnings are the shutdown warnings broadcast so far
+	Warnings []Warning `json:"warnings,omitempty"`
+	// StartedBy is the website user who started the session
+	StartedBy *Actor `json:"startedBy,omitempty"`
+	// StoppedBy is the website user who stopped the server, unset for
+	// scheduled stops
+	StoppedBy *Actor `json:"stoppedBy,omitempty"`
+}
+
+// GetSession returns the session kept in the store, or an error wrapping
+// ErrStateNotFound if there is none
+func GetSession(cfg *Config, store StateStore) (Session, error) {
+	var session Session
+	value, err := store.Get(cfg.SessionKeyName)
+	if err != nil {
+		return session, err
+	}
+	err = json.Unmarshal([]byte(value), &session)
+	if err != nil {
+		return session, fmt.Errorf("invalid session %q: %w", value, err)
+	}
+	return session, nil
+}
+
+// PutSession stores the session as JSON
+func PutSession(cfg *Config, store StateStore, session Session) error {
+	b, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	return store.Put(cfg.SessionKeyName, string(b))
+}
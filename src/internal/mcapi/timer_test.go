@@ -0,0 +1,59 @@
+package mcapi_test
+
+import (
+	"testing"
+	"time"
+
+	"mcapi"
+	"mcapi/mcapitest"
+)
+
+func TestCheckTime(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	tests := []struct {
+		name     string
+		idle     time.Duration
+		stopTime time.Time
+		want     time.Time
+	}{
+		{"idle check disabled", 0, now.Add(time.Hour), now.Add(time.Hour)},
+		{"idle check first", 15 * time.Minute, now.Add(time.Hour), now.Add(15 * time.Minute)},
+		{"stop time first", 15 * time.Minute, now.Add(10 * time.Minute), now.Add(10 * time.Minute)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := mcapitest.Config()
+			cfg.IdleTimeout = tt.idle
+			if got := mcapi.CheckTime(cfg, now, tt.stopTime); !got.Equal(tt.want) {
+				t.Errorf("CheckTime = %d, want %d", got.Unix(), tt.want.Unix())
+			}
+		})
+	}
+}
+
+func TestCheckTimeWarnings(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	tests := []struct {
+		name     string
+		warnings []time.Duration
+		rcon     string
+		stopTime time.Time
+		want     time.Time
+	}{
+		{"first warning", mcapi.DefaultShutdownWarnings, "pw", now.Add(time.Hour), now.Add(50 * time.Minute)},
+		{"next warning", mcapi.DefaultShutdownWarnings, "pw", now.Add(7 * time.Minute), now.Add(2 * time.Minute)},
+		{"past the last warning", mcapi.DefaultShutdownWarnings, "pw", now.Add(30 * time.Second), now.Add(30 * time.Second)},
+		{"warnings disabled", nil, "pw", now.Add(time.Hour), now.Add(time.Hour)},
+		{"cannot broadcast", mcapi.DefaultShutdownWarnings, "", now.Add(time.Hour), now.Add(time.Hour)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := mcapitest.Config()
+			cfg.ShutdownWarnings = tt.warnings
+			cfg.RCONPasswordParameter = tt.rcon
+			if got := mcapi.CheckTime(cfg, now, tt.stopTime); !got.Equal(tt.want) {
+				t.Errorf("CheckTime = %d, want %d", got.Unix(), tt.want.Unix())
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package mcapi
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// broadcastTimeout is how long broadcasting a message through the shutdown
+// document may take
+const broadcastTimeout = 30 * time.Second
+
+// Warning records a shutdown warning broadcast to the players
+type Warning struct {
+	// StopTime is the unix timestamp of the stop warned of. Warnings of an
+	// earlier stop time no longer count once the stop is put off.
+	StopTime int64 `json:"stopTime"`
+	// Minutes is the warning, in minutes before the stop
+	Minutes int `json:"minutes"`
+	// SentAt is the unix timestamp the warning was broadcast at
+	SentAt int64 `json:"sentAt"`
+	// Error is why the broadcast failed, empty if it went out
+	Error string `json:"error,omitempty"`
+}
+
+// CanBroadcast reports whether messages can be broadcast to the players:
+// over RCON, or with the broadcast command through the shutdown document
+func CanBroadcast(cfg *Config) bool {
+	return cfg.RCONPasswordParameter != "" || (cfg.ShutdownDocument != "" && cfg.BroadcastCommand != "")
+}
+
+// shellQuote quotes s as a single shell word
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// Broadcast sends message to everyone on the server, over RCON if it is
+// configured and otherwise with the broadcast command
+func Broadcast(cfg *Config, clients *Clients, message string) error {
+	if cfg.RCONPasswordParameter != "" {
+		address, err := RCONAddress(cfg, clients.EC2)
+		if err != nil {
+			return err
+		}
+		_, err = clients.RCON.Command(address, "say "+message)
+		return err
+	}
+	if cfg.ShutdownDocument == "" || cfg.BroadcastCommand == "" {
+		return NewError(CodeUnavailable, "broadcasting is not configured")
+	}
+	command := strings.Replace(cfg.BroadcastCommand, "{message}", shellQuote(message), -1)
+	return clients.Commands.Run(cfg.ShutdownDocument, []string{command}, broadcastTimeout)
+}
+
+// NextWarning returns when the next shutdown warning of stopTime is due after
+// now, and false if none is left or they cannot be broadcast
+func NextWarning(cfg *Config, now, stopTime time.Time) (time.Time, bool) {
+	if !CanBroadcast(cfg) {
+		return time.Time{}, false
+	}
+	for _, w := range cfg.ShutdownWarnings {
+		if at := stopTime.Add(-w); at.After(now) {
+			return at, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// DueWarning returns the shutdown warning of stopTime due at now: the
+// shortest warning still at least as long as the time left. It returns false
+// if none is due, or it was already broadcast according to sent. The warning
+// only tells which were sent; the time left is what players are told, as a
+// warning can go out late.
+func DueWarning(cfg *Config, now, stopTime time.Time, sent []Warning) (time.Duration, bool) {
+	left := stopTime.Sub(now)
+	if left <= 0 || !CanBroadcast(cfg) {
+		return 0, false
+	}
+	due := time.Duration(0)
+	for _, w := range cfg.ShutdownWarnings {
+		if w >= left && (due == 0 || w < due) {
+			due = w
+		}
+	}
+	if due == 0 {
+		return 0, false
+	}
+	for _, s := range sent {
+		if s.StopTime == stopTime.Unix() && time.Duration(s.Minutes)*time.Minute == due {
+			return 0, false
+		}
+	}
+	return due, true
+}
+
+// WarningMessage returns the message warning the players of a stop in d,
+// rounded to whole minutes
+func WarningMessage(d time.Duration) string {
+	minutes := int(d.Round(time.Minute) / time.Minute)
+	switch {
+	case minutes < 1:
+		return "Server stopping in less than a minute"
+	case minutes == 1:
+		return "Server stopping in 1 minute"
+	}
+	return fmt.Sprintf("Server stopping in %d minutes", minutes)
+}
@@ -0,0 +1,89 @@
+package mcapi_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"mcapi"
+	"mcapi/mcapitest"
+)
+
+func TestDueWarning(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	stopTime := now.Add(4 * time.Minute)
+	tests := []struct {
+		name     string
+		stopTime time.Time
+		sent     []mcapi.Warning
+		want     time.Duration
+		ok       bool
+	}{
+		{"shortest warning covering the time left", stopTime, nil, 5 * time.Minute, true},
+		{"on time", now.Add(10 * time.Minute), nil, 10 * time.Minute, true},
+		{"before the first warning", now.Add(11 * time.Minute), nil, 0, false},
+		{"already sent", stopTime, []mcapi.Warning{{StopTime: stopTime.Unix(), Minutes: 5}}, 0, false},
+		{"sent for another stop time", stopTime, []mcapi.Warning{{StopTime: stopTime.Unix() - 60, Minutes: 5}}, 5 * time.Minute, true},
+		{"stop time passed", now, nil, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := mcapitest.Config()
+			cfg.ShutdownWarnings = mcapi.DefaultShutdownWarnings
+			got, ok := mcapi.DueWarning(cfg, now, tt.stopTime, tt.sent)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("DueWarning = %s, %t, want %s, %t", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestWarningMessage(t *testing.T) {
+	for d, want := range map[time.Duration]string{
+		time.Minute:                    "Server stopping in 1 minute",
+		10 * time.Minute:               "Server stopping in 10 minutes",
+		10*time.Minute - 5*time.Second: "Server stopping in 10 minutes",
+		8*time.Minute + 10*time.Second: "Server stopping in 8 minutes",
+		90 * time.Second:               "Server stopping in 2 minutes",
+		20 * time.Second:               "Server stopping in less than a minute",
+	} {
+		if got := mcapi.WarningMessage(d); got != want {
+			t.Errorf("WarningMessage(%s) = %q, want %q", d, got, want)
+		}
+	}
+}
+
+func TestBroadcast(t *testing.T) {
+	t.Run("over RCON", func(t *testing.T) {
+		c := mcapitest.NewClients()
+		c.EC2.SetState(mcapitest.InstanceID, "running")
+		cfg := mcapitest.Config()
+		if err := mcapi.Broadcast(cfg, c.Clients(), "hello"); err != nil {
+			t.Fatal(err)
+		}
+		if got := fmt.Sprint(c.RCON.Addresses(), c.RCON.Commands()); got != "[10.0.0.7:25575] [say hello]" {
+			t.Errorf("RCON got %s", got)
+		}
+	})
+	t.Run("with the broadcast command", func(t *testing.T) {
+		c := mcapitest.NewClients()
+		cfg := mcapitest.Config()
+		cfg.RCONPasswordParameter = ""
+		cfg.BroadcastCommand = "echo say {message} > /run/minecraft.stdin"
+		if err := mcapi.Broadcast(cfg, c.Clients(), "it's late"); err != nil {
+			t.Fatal(err)
+		}
+		want := `[[AWS-RunShellScript echo say 'it'\''s late' > /run/minecraft.stdin]]`
+		if got := fmt.Sprint(c.Commands.Ran()); got != want {
+			t.Errorf("ran %s, want %s", got, want)
+		}
+	})
+	t.Run("not configured", func(t *testing.T) {
+		c := mcapitest.NewClients()
+		cfg := mcapitest.Config()
+		cfg.RCONPasswordParameter = ""
+		if err := mcapi.Broadcast(cfg, c.Clients(), "hello"); err == nil {
+			t.Error("Broadcast succeeded without RCON or broadcast command")
+		}
+	})
+}
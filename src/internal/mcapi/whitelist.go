@@ -0,0 +1,345 @@
+package mcapi
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+// WhitelistPartitionKey is the PK of whitelist entries in the login table.
+// Like StatePartitionKey it cannot collide with a player's sessions.
+const WhitelistPartitionKey = "#whitelist"
+
+// whitelistSortPrefix prefixes the SK of whitelist entries, so a player named
+// like a login version does not show up in getLogins results
+const whitelistSortPrefix = "player#"
+
+// whitelistImportedKey is the SK of the item marking that the server's own
+// whitelist was imported by the first sync
+const whitelistImportedKey = "#imported"
+
+// playerName matches valid minecraft player names
+var playerName = regexp.MustCompile(`^[A-Za-z0-9_]{1,16}$`)
+
+// IsPlayerName reports whether name is a valid minecraft player name
+func IsPlayerName(name string) bool {
+	return playerName.MatchString(name)
+}
+
+// playerUUID matches player UUIDs, with or without dashes
+var playerUUID = regexp.MustCompile(`^[0-9a-fA-F]{8}-?[0-9a-fA-F]{4}-?[0-9a-fA-F]{4}-?[0-9a-fA-F]{4}-?[0-9a-fA-F]{12}$`)
+
+// NormalizeUUID returns the player UUID in its lower case, dashed form. It
+// returns an INVALID_REQUEST error if uuid is not one.
+func NormalizeUUID(uuid string) (string, error) {
+	if !playerUUID.MatchString(uuid) {
+		return "", NewError(CodeInvalidRequest, "uuid must be a player UUID, got %q", uuid)
+	}
+	u := strings.ToLower(strings.Replace(uuid, "-", "", -1))
+	return u[0:8] + "-" + u[8:12] + "-" + u[12:16] + "-" + u[16:20] + "-" + u[20:], nil
+}
+
+// WhitelistEntry is a player allowed on the server, kept in the login table
+// under WhitelistPartitionKey. Entries have no LoginTime, so they stay out of
+// the Username index.
+type WhitelistEntry struct {
+	Username string `json:"username" dynamodbav:"Username"`
+	// UUID is the player's UUID, if known
+	UUID string `json:"uuid,omitempty" dynamodbav:"UUID,omitempty"`
+	// CognitoUser is the website user the player was whitelisted by, and
+	// belongs to
+	CognitoUser string `json:"cognitoUser,omitempty" dynamodbav:"CognitoUser,omitempty"`
+	// AddedAt is the unix timestamp the player was whitelisted at
+	AddedAt int64 `json:"addedAt" dynamodbav:"AddedAt"`
+}
+
+// whitelistKey returns the primary key of the entry of username. Player names
+// are not case sensitive, so neither is the key.
+func whitelistKey(username string) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		"PK": {S: aws.String(WhitelistPartitionKey)},
+		"SK": {S: aws.String(whitelistSortPrefix + strings.ToLower(username))},
+	}
+}
+
+// GetWhitelist returns every whitelist entry, sorted by lower case username
+func GetWhitelist(cfg *Config, svc dynamodbiface.DynamoDBAPI) ([]WhitelistEntry, error) {
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(cfg.UserLoginTableName),
+		KeyConditionExpression: aws.String("PK = :pk"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":pk": {S: aws.String(WhitelistPartitionKey)},
+		},
+		ConsistentRead: aws.Bool(true),
+	}
+	entries := []WhitelistEntry{}
+	for {
+		result, err := svc.Query(input)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range result.Items {
+			if !strings.HasPrefix(aws.StringValue(item["SK"].S), whitelistSortPrefix) {
+				continue
+			}
+			var entry WhitelistEntry
+			err = dynamodbattribute.UnmarshalMap(item, &entry)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, entry)
+		}
+		if len(result.LastEvaluatedKey) == 0 {
+			return entries, nil
+		}
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+}
+
+// PutWhitelistEntry whitelists the player of entry, replacing any entry of the
+// same name
+func PutWhitelistEntry(cfg *Config, svc dynamodbiface.DynamoDBAPI, entry WhitelistEntry) error {
+	item, err := dynamodbattribute.MarshalMap(entry)
+	if err != nil {
+		return err
+	}
+	for k, v := range whitelistKey(entry.Username) {
+		item[k] = v
+	}
+	_, err = svc.PutItem(&dynamodb.PutItemInput{
+		TableName: aws.String(cfg.UserLoginTableName),
+		Item:      item,
+	})
+	return err
+}
+
+// DeleteWhitelistEntry removes username from the whitelist, returning its
+// entry. It returns a NOT_FOUND error if the player is not whitelisted.
+func DeleteWhitelistEntry(cfg *Config, svc dynamodbiface.DynamoDBAPI, username string) (WhitelistEntry, error) {
+	var entry WhitelistEntry
+	result, err := svc.DeleteItem(&dynamodb.DeleteItemInput{
+		TableName:    aws.String(cfg.UserLoginTableName),
+		Key:          whitelistKey(username),
+		ReturnValues: aws.String(dynamodb.ReturnValueAllOld),
+	})
+	if err != nil {
+		return entry, err
+	}
+	if len(result.Attributes) == 0 {
+		return entry, NewError(CodeNotFound, "%s is not whitelisted", username)
+	}
+	err = dynamodbattribute.UnmarshalMap(result.Attributes, &entry)
+	return entry, err
+}
+
+// NewWhitelistEntry returns the entry whitelisting username at now on behalf
+// of cognitoUser, validating the name and normalizing the UUID if given
+func NewWhitelistEntry(username, uuid, cognitoUser string, now time.Time) (WhitelistEntry, error) {
+	if !IsPlayerName(username) {
+		return WhitelistEntry{}, NewError(CodeInvalidRequest, "username must be a minecraft player name, got %q", username)
+	}
+	entry := WhitelistEntry{Username: username, CognitoUser: cognitoUser, AddedAt: now.Unix()}
+	if uuid != "" {
+		var err error
+		entry.UUID, err = NormalizeUUID(uuid)
+		if err != nil {
+			return WhitelistEntry{}, err
+		}
+	}
+	return entry, nil
+}
+
+// WhitelistChange is the outcome of adding a player to the whitelist or
+// removing one
+type WhitelistChange struct {
+	WhitelistEntry
+	// Synced reports whether the change reached the running server. Changes
+	// made while it is not started reach it with the next sync.
+	Synced bool `json:"synced"`
+	// SyncError is why the change did not reach the started server
+	SyncError string `json:"syncError,omitempty"`
+}
+
+// AddToWhitelist stores entry in the login table, replacing any entry of the
+// player, and pushes it to the server if it is started
+func AddToWhitelist(cfg *Config, clients *Clients, store StateStore, entry WhitelistEntry) (WhitelistChange, error) {
+	err := PutWhitelistEntry(cfg, clients.DynamoDB, entry)
+	if err != nil {
+		return WhitelistChange{}, err
+	}
+	return PushWhitelistChange(cfg, clients, store, entry, "add"), nil
+}
+
+// PushWhitelistChange runs whitelist action, add or remove, for the player of
+// entry on the server if it is started. The change is already stored, so
+// failures are only logged and reported in the result.
+func PushWhitelistChange(cfg *Config, clients *Clients, store StateStore, entry WhitelistEntry, action string) WhitelistChange {
+	change := WhitelistChange{WhitelistEntry: entry}
+	lifecycle, err := GetLifecycle(cfg, store)
+	if err == nil && lifecycle != LifecycleStarted {
+		fmt.Println("Server is", lifecycle, "so", entry.Username, "is synced when it starts")
+		return change
+	}
+	if err == nil {
+		_, err = WhitelistCommand(cfg, clients, action, entry.Username)
+	}
+	if err != nil {
+		fmt.Println("WARNING: could not", action, entry.Username, "on the server:", err)
+		change.SyncError = err.Error()
+		return change
+	}
+	change.Synced = true
+	return change
+}
+
+// WhitelistCommand runs a whitelist console command over RCON: add or remove
+// with a player name, or list
+func WhitelistCommand(cfg *Config, clients *Clients, args ...string) (string, error) {
+	address, err := RCONAddress(cfg, clients.EC2)
+	if err != nil {
+		return "", err
+	}
+	return clients.RCON.Command(address, strings.Join(append([]string{"whitelist"}, args...), " "))
+}
+
+// parseWhitelist returns the player names in the output of whitelist list,
+// such as "There are 2 whitelisted player(s): alex, steve". Servers with
+// nobody whitelisted answer without a colon.
+func parseWhitelist(output string) []string {
+	n := strings.Index(output, ":")
+	if n < 0 {
+		return nil
+	}
+	var names []string
+	for _, name := range strings.Split(output[n+1:], ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// WhitelistSync is the outcome of SyncWhitelist
+type WhitelistSync struct {
+	// Imported lists the players taken into the login table from the server's
+	// whitelist by the first sync
+	Imported []string `json:"imported"`
+	Added    []string `json:"added"`
+	Removed  []string `json:"removed"`
+}
+
+// whitelistImported reports whether the server's whitelist was imported
+func whitelistImported(cfg *Config, svc dynamodbiface.DynamoDBAPI) (bool, error) {
+	result, err := svc.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String(cfg.UserLoginTableName),
+		Key: map[string]*dynamodb.AttributeValue{
+			"PK": {S: aws.String(WhitelistPartitionKey)},
+			"SK": {S: aws.String(whitelistImportedKey)},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return false, err
+	}
+	return len(result.Item) != 0, nil
+}
+
+// importWhitelist stores an entry for each of names, the players whitelisted
+// on the server, and marks the whitelist imported
+func importWhitelist(cfg *Config, svc dynamodbiface.DynamoDBAPI, names []string, now time.Time) error {
+	for _, name := range names {
+		err := PutWhitelistEntry(cfg, svc, WhitelistEntry{Username: name, AddedAt: now.Unix()})
+		if err != nil {
+			return err
+		}
+	}
+	_, err := svc.PutItem(&dynamodb.PutItemInput{
+		TableName: aws.String(cfg.UserLoginTableName),
+		Item: map[string]*dynamodb.AttributeValue{
+			"PK":      {S: aws.String(WhitelistPartitionKey)},
+			"SK":      {S: aws.String(whitelistImportedKey)},
+			"AddedAt": {N: aws.String(strconv.FormatInt(now.Unix(), 10))},
+		},
+	})
+	return err
+}
+
+// SyncWhitelist makes the whitelist of the running server match the entries
+// in the login table over RCON: players missing from the server are added,
+// and players whitelisted on the server only are removed. The first sync
+// imports the players whitelisted on the server only instead, so the server's
+// existing whitelist is kept rather than emptied. It stops at the first
+// command that fails.
+func SyncWhitelist(cfg *Config, clients *Clients) (WhitelistSync, error) {
+	var sync WhitelistSync
+	entries, err := GetWhitelist(cfg, clients.DynamoDB)
+	if err != nil {
+		return sync, err
+	}
+	imported, err := whitelistImported(cfg, clients.DynamoDB)
+	if err != nil {
+		return sync, err
+	}
+	output, err := WhitelistCommand(cfg, clients, "list")
+	if err != nil {
+		return sync, err
+	}
+
+	onServer := map[string]string{}
+	for _, name := range parseWhitelist(output) {
+		onServer[strings.ToLower(name)] = name
+	}
+	if !imported {
+		stored := map[string]bool{}
+		for _, e := range entries {
+			stored[strings.ToLower(e.Username)] = true
+		}
+		for key, name := range onServer {
+			if !stored[key] {
+				sync.Imported = append(sync.Imported, name)
+			}
+		}
+		sort.Strings(sync.Imported)
+		fmt.Println("[SyncWhitelist]", "importing the server's whitelist:", sync.Imported)
+		err = importWhitelist(cfg, clients.DynamoDB, sync.Imported, time.Now())
+		if err != nil {
+			return sync, err
+		}
+		for _, name := range sync.Imported {
+			delete(onServer, strings.ToLower(name))
+		}
+	}
+	for _, e := range entries {
+		key := strings.ToLower(e.Username)
+		if _, ok := onServer[key]; ok {
+			delete(onServer, key)
+			continue
+		}
+		_, err = WhitelistCommand(cfg, clients, "add", e.Username)
+		if err != nil {
+			return sync, err
+		}
+		sync.Added = append(sync.Added, e.Username)
+	}
+	var extra []string
+	for _, name := range onServer {
+		extra = append(extra, name)
+	}
+	sort.Strings(extra)
+	for _, name := range extra {
+		_, err = WhitelistCommand(cfg, clients, "remove", name)
+		if err != nil {
+			return sync, err
+		}
+		sync.Removed = append(sync.Removed, name)
+	}
+	return sync, nil
+}
@@ -0,0 +1,149 @@
+package mcapi_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"mcapi"
+	"mcapi/mcapitest"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+func TestNormalizeUUID(t *testing.T) {
+	for uuid, want := range map[string]string{
+		"069A79F444E94726A5BEFCA90E38AAF5":     "069a79f4-44e9-4726-a5be-fca90e38aaf5",
+		"069a79f4-44e9-4726-a5be-fca90e38aaf5": "069a79f4-44e9-4726-a5be-fca90e38aaf5",
+		"069a79f4":                             "",
+		"not-a-uuid-at-all-not-a-uuid-at-all!": "",
+	} {
+		got, err := mcapi.NormalizeUUID(uuid)
+		if got != want || (err != nil) != (want == "") {
+			t.Errorf("NormalizeUUID(%q) = %q, %v, want %q", uuid, got, err, want)
+		}
+	}
+}
+
+func TestWhitelist(t *testing.T) {
+	cfg := mcapitest.Config()
+	c := mcapitest.NewClients()
+	now := time.Unix(1600000000, 0)
+	for _, name := range []string{"steve", "Alex", "v1"} {
+		entry, err := mcapi.NewWhitelistEntry(name, "", "admin", now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = mcapi.PutWhitelistEntry(cfg, c.DynamoDB, entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := mcapi.GetWhitelist(cfg, c.DynamoDB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(entries); got != "[{Alex  admin 1600000000} {steve  admin 1600000000} {v1  admin 1600000000}]" {
+		t.Errorf("GetWhitelist = %s", got)
+	}
+	// a player named like the login version stays out of getLogins
+	if logins, err := mcapi.GetLogins(cfg, c.DynamoDB); err != nil || len(logins) != 0 {
+		t.Errorf("GetLogins = %v, %v, want no logins", logins, err)
+	}
+
+	entry, err := mcapi.DeleteWhitelistEntry(cfg, c.DynamoDB, "STEVE")
+	if err != nil || entry.Username != "steve" {
+		t.Errorf("DeleteWhitelistEntry = %+v, %v, want steve's entry", entry, err)
+	}
+	_, err = mcapi.DeleteWhitelistEntry(cfg, c.DynamoDB, "steve")
+	var e *mcapi.Error
+	if !errors.As(err, &e) || e.Code != mcapi.CodeNotFound {
+		t.Errorf("deleting again = %v, want NOT_FOUND", err)
+	}
+}
+
+func TestNewWhitelistEntry(t *testing.T) {
+	if _, err := mcapi.NewWhitelistEntry("no spaces", "", "", time.Now()); err == nil {
+		t.Error("invalid username accepted")
+	}
+	if _, err := mcapi.NewWhitelistEntry("steve", "nope", "", time.Now()); err == nil {
+		t.Error("invalid UUID accepted")
+	}
+}
+
+func TestSyncWhitelist(t *testing.T) {
+	cfg := mcapitest.Config()
+	c := mcapitest.NewClients()
+	c.EC2.SetState(cfg.ServerID, "running")
+	for _, name := range []string{"alex", "steve"} {
+		mcapi.PutWhitelistEntry(cfg, c.DynamoDB, mcapi.WhitelistEntry{Username: name})
+	}
+	c.RCON.SetOutput("whitelist list", "There are 3 whitelisted player(s): Alex, griefer, notch")
+
+	// the first sync keeps the players only the server had whitelisted
+	sync, err := mcapi.SyncWhitelist(cfg, c.Clients())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(sync.Imported, sync.Added, sync.Removed); got != "[griefer notch] [steve] []" {
+		t.Errorf("imported, added and removed %s, want [griefer notch] [steve] []", got)
+	}
+	entries, err := mcapi.GetWhitelist(cfg, c.DynamoDB)
+	if err != nil || len(entries) != 4 {
+		t.Errorf("GetWhitelist = %v, %v, want alex, griefer, notch and steve", entries, err)
+	}
+
+	if _, err = mcapi.DeleteWhitelistEntry(cfg, c.DynamoDB, "griefer"); err != nil {
+		t.Fatal(err)
+	}
+	c.RCON.SetOutput("whitelist list", "There are 4 whitelisted player(s): Alex, griefer, notch, steve")
+	sync, err = mcapi.SyncWhitelist(cfg, c.Clients())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(sync.Imported, sync.Added, sync.Removed); got != "[] [] [griefer]" {
+		t.Errorf("imported, added and removed %s, want [] [] [griefer]", got)
+	}
+	want := "[whitelist list whitelist add steve whitelist list whitelist remove griefer]"
+	if got := fmt.Sprint(c.RCON.Commands()); got != want {
+		t.Errorf("RCON commands = %s, want %s", got, want)
+	}
+}
+
+func TestPushWhitelistChange(t *testing.T) {
+	entry := mcapi.WhitelistEntry{Username: "steve"}
+	denied := awserr.New("AccessDeniedException", "denied", nil)
+	tests := []struct {
+		name      string
+		lifecycle string
+		rconFail  error
+		stateFail error
+		synced    bool
+		commands  string
+	}{
+		{name: "started", lifecycle: "started", synced: true, commands: "[whitelist add steve]"},
+		{name: "stopped", lifecycle: "stopped", commands: "[]"},
+		{name: "RCON fails", lifecycle: "started", rconFail: mcapi.NewError(mcapi.CodeUnavailable, "RCON"), commands: "[]"},
+		{name: "lifecycle unknown", lifecycle: "started", stateFail: denied, commands: "[]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := mcapitest.Config()
+			c := mcapitest.NewClients()
+			c.EC2.SetState(cfg.ServerID, "running")
+			c.SSM.Set(cfg.LifecycleKeyName, tt.lifecycle)
+			c.RCON.Fail("Command", tt.rconFail)
+			c.SSM.Fail("GetParameter", tt.stateFail)
+
+			change := mcapi.PushWhitelistChange(cfg, c.Clients(), mcapi.NewSSMStateStore(cfg, c.SSM), entry, "add")
+			failed := tt.rconFail != nil || tt.stateFail != nil
+			if change.Synced != tt.synced || (change.SyncError != "") != failed {
+				t.Errorf("change = %+v, want synced %t", change, tt.synced)
+			}
+			if got := fmt.Sprint(c.RCON.Commands()); got != tt.commands {
+				t.Errorf("RCON commands = %s, want %s", got, tt.commands)
+			}
+		})
+	}
+}